@@ -2,26 +2,38 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	stateDir           = "/var/lib/cslite"
+	logUploadChunkSize = 1024 * 1024
+)
+
 type Agent struct {
 	config       *Config
 	client       *http.Client
+	pollClient   *http.Client
 	agentID      string
 	deviceID     string
 	stopChan     chan struct{}
 	wg           sync.WaitGroup
 	commandQueue chan *Command
 	executor     *CommandExecutor
+	spool        *resultSpool
+	metrics      *metricsSampler
 }
 
 type Config struct {
@@ -29,6 +41,8 @@ type Config struct {
 	APIKey              string
 	HeartbeatInterval   int
 	CommandPollInterval int
+	LongPollWait        int
+	MaxConcurrency      int
 	LogPath             string
 }
 
@@ -38,11 +52,16 @@ func NewAgent(config *Config) (*Agent, error) {
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		pollClient: &http.Client{
+			Timeout: time.Duration(config.LongPollWait)*time.Second + 30*time.Second,
+		},
 		stopChan:     make(chan struct{}),
-		commandQueue: make(chan *Command, 10),
+		commandQueue: make(chan *Command, config.MaxConcurrency),
 	}
 
 	agent.executor = NewCommandExecutor(agent)
+	agent.spool = newResultSpool(agent, filepath.Join(stateDir, "spool"))
+	agent.metrics = newMetricsSampler()
 
 	if err := agent.loadOrRegister(); err != nil {
 		return nil, fmt.Errorf("failed to register agent: %w", err)
@@ -53,10 +72,11 @@ func NewAgent(config *Config) (*Agent, error) {
 
 func (a *Agent) Start() error {
 	a.wg.Add(3)
-	
+
 	go a.heartbeatLoop()
 	go a.commandPollLoop()
-	go a.executor.Start()
+	go a.spoolLoop()
+	a.executor.Start()
 
 	return nil
 }
@@ -68,7 +88,7 @@ func (a *Agent) Stop() {
 }
 
 func (a *Agent) loadOrRegister() error {
-	stateFile := "/var/lib/cslite/agent.state"
+	stateFile := filepath.Join(stateDir, "agent.state")
 	
 	data, err := os.ReadFile(stateFile)
 	if err == nil {
@@ -123,13 +143,19 @@ func (a *Agent) loadOrRegister() error {
 		"device_id": a.deviceID,
 	}
 	stateData, _ := json.Marshal(state)
-	os.MkdirAll("/var/lib/cslite", 0755)
+	os.MkdirAll(stateDir, 0755)
 	os.WriteFile(stateFile, stateData, 0600)
 
 	logrus.Info("Agent registered successfully")
 	return nil
 }
 
+func (a *Agent) spoolLoop() {
+	defer a.wg.Done()
+
+	a.spool.loop(a.stopChan)
+}
+
 func (a *Agent) heartbeatLoop() {
 	defer a.wg.Done()
 
@@ -149,12 +175,13 @@ func (a *Agent) heartbeatLoop() {
 }
 
 func (a *Agent) sendHeartbeat() error {
-	metrics := collectMetrics()
+	metrics := a.metrics.collect()
 	
 	req := HeartbeatRequest{
 		AgentID:   a.agentID,
 		Metrics:   metrics,
 		Timestamp: time.Now().Format(time.RFC3339),
+		Interval:  a.config.HeartbeatInterval,
 	}
 
 	_, err := a.apiCall("POST", "/agent/heartbeat", req)
@@ -169,25 +196,67 @@ func (a *Agent) sendHeartbeat() error {
 func (a *Agent) commandPollLoop() {
 	defer a.wg.Done()
 
-	ticker := time.NewTicker(time.Duration(a.config.CommandPollInterval) * time.Second)
-	defer ticker.Stop()
+	interval := time.Duration(a.config.CommandPollInterval) * time.Second
+	longPoll := a.config.LongPollWait > 0
 
 	for {
-		select {
-		case <-ticker.C:
-			if err := a.pollCommands(); err != nil {
-				logrus.Error("Failed to poll commands:", err)
+		capacity := a.executor.Capacity()
+		wait := 0
+		if longPoll && capacity > 0 {
+			wait = a.config.LongPollWait
+		}
+
+		supported, err := a.pollCommands(wait, capacity)
+		delay := interval
+		switch {
+		case err != nil:
+			logrus.Error("Failed to poll commands:", err)
+		case longPoll && !supported:
+			logrus.Warn("Server does not support long-poll, falling back to interval polling")
+			longPoll = false
+		case longPoll && capacity > 0:
+			delay = 0
+		}
+
+		if delay == 0 {
+			select {
+			case <-a.stopChan:
+				return
+			default:
+				continue
 			}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-a.executor.Freed():
 		case <-a.stopChan:
 			return
 		}
 	}
 }
 
-func (a *Agent) pollCommands() error {
-	resp, err := a.apiCall("GET", fmt.Sprintf("/agent/commands?agent_id=%s", a.agentID), nil)
+func (a *Agent) pollCommands(wait, capacity int) (bool, error) {
+	path := fmt.Sprintf("/agent/commands?agent_id=%s&capacity=%d", a.agentID, capacity)
+	client := a.client
+	if wait > 0 {
+		path += fmt.Sprintf("&wait=%d", wait)
+		client = a.pollClient
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-a.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	resp, err := a.apiCallWithClient(ctx, client, "GET", path, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	var result struct {
@@ -195,66 +264,243 @@ func (a *Agent) pollCommands() error {
 		Message string `json:"message"`
 		Data    struct {
 			Commands []Command `json:"commands"`
+			Controls []Control `json:"controls"`
+			Wait     *int      `json:"wait"`
 		} `json:"data"`
 	}
 
 	if err := json.Unmarshal(resp, &result); err != nil {
-		return err
+		return false, err
 	}
 
 	if result.Code != 20000 {
-		return fmt.Errorf("failed to poll commands: %s", result.Message)
+		return false, fmt.Errorf("failed to poll commands: %s", result.Message)
 	}
 
-	for _, cmd := range result.Data.Commands {
-		select {
-		case a.commandQueue <- &cmd:
+	a.executor.ApplyControls(result.Data.Controls)
+
+	var acks []AckExecution
+	for i := range result.Data.Commands {
+		cmd := &result.Data.Commands[i]
+		if a.executor.Tracking(cmd.ExecutionID) {
+			acks = append(acks, AckExecution{ExecutionID: cmd.ExecutionID, Attempt: cmd.Attempt})
+			continue
+		}
+		if a.executor.Enqueue(cmd) {
 			logrus.Infof("Queued command: %s", cmd.CommandID)
-		default:
-			logrus.Warn("Command queue full, dropping command")
+			acks = append(acks, AckExecution{ExecutionID: cmd.ExecutionID, Attempt: cmd.Attempt})
+		} else {
+			logrus.Warn("Command queue full, server will redeliver after the lease expires")
+		}
+	}
+
+	if len(acks) > 0 {
+		if err := a.ackCommands(acks); err != nil {
+			logrus.Error("Failed to acknowledge commands:", err)
 		}
 	}
 
+	supported := result.Data.Wait != nil && (wait == 0 || *result.Data.Wait > 0)
+	return supported, nil
+}
+
+func (a *Agent) ackCommands(acks []AckExecution) error {
+	req := AckRequest{
+		AgentID:    a.agentID,
+		Executions: acks,
+	}
+
+	resp, err := a.apiCall("POST", "/agent/ack", req)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return err
+	}
+
+	if result.Code != 20000 {
+		return fmt.Errorf("failed to acknowledge commands: %s", result.Message)
+	}
 	return nil
 }
 
+type rejectedError struct {
+	code    int
+	message string
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("rejected by server: %d %s", e.code, e.message)
+}
+
 func (a *Agent) ReportResult(result *ExecutionResult) error {
-	_, err := a.apiCall("POST", "/agent/result", result)
+	resp, err := a.apiCall("POST", "/agent/result", result)
 	if err != nil {
 		return err
 	}
 
+	var response struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(resp, &response); err != nil {
+		return err
+	}
+
+	if response.Code != 20000 {
+		if response.Code >= 40004 && response.Code < 50000 {
+			return &rejectedError{code: response.Code, message: response.Message}
+		}
+		return fmt.Errorf("failed to report result: %d %s", response.Code, response.Message)
+	}
+
 	logrus.Infof("Reported result for execution: %s", result.ExecutionID)
 	return nil
 }
 
+func (a *Agent) UploadLog(result *ExecutionResult, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	buf := make([]byte, logUploadChunkSize)
+	var offset int64
+	resyncs := 0
+	for {
+		n, err := file.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		final := offset+int64(n) >= size
+
+		query := url.Values{}
+		query.Set("execution_id", result.ExecutionID)
+		query.Set("device_id", result.DeviceID)
+		query.Set("attempt", strconv.Itoa(result.Attempt))
+		query.Set("offset", strconv.FormatInt(offset, 10))
+		query.Set("final", strconv.FormatBool(final))
+
+		resp, err := a.apiRequest(context.Background(), a.client, "POST", "/agent/result/log?"+query.Encode(), "application/gzip", bytes.NewReader(buf[:n]))
+		if err != nil {
+			return err
+		}
+
+		var response struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    struct {
+				Received int64 `json:"received"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(resp, &response); err != nil {
+			return err
+		}
+
+		switch {
+		case response.Code == 20000:
+			if final {
+				logrus.Infof("Uploaded log for execution: %s", result.ExecutionID)
+				return nil
+			}
+			offset += int64(n)
+		case response.Code == 40024 && resyncs < 3:
+			resyncs++
+			offset = response.Data.Received
+		case response.Code >= 40004 && response.Code < 50000:
+			return &rejectedError{code: response.Code, message: response.Message}
+		default:
+			return fmt.Errorf("failed to upload log: %d %s", response.Code, response.Message)
+		}
+	}
+}
+
+func (a *Agent) SubmitResult(result *ExecutionResult, logPath string) {
+	a.spool.Submit(result, logPath)
+}
+
+func (a *Agent) ReportOutput(chunk *OutputChunk) error {
+	resp, err := a.apiCall("POST", "/agent/result/stream", chunk)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(resp, &response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if response.Code != 20000 {
+		return fmt.Errorf("failed to stream output: %d %s", response.Code, response.Message)
+	}
+	return nil
+}
+
 func (a *Agent) apiCall(method, path string, body interface{}) ([]byte, error) {
-	url := a.config.ServerURL + path
+	return a.apiCallWithClient(context.Background(), a.client, method, path, body)
+}
 
+func (a *Agent) apiCallWithClient(ctx context.Context, client *http.Client, method, path string, body interface{}) ([]byte, error) {
 	var reqBody io.Reader
+	contentType := ""
 	if body != nil {
 		data, err := json.Marshal(body)
 		if err != nil {
 			return nil, err
 		}
 		reqBody = bytes.NewBuffer(data)
+		contentType = "application/json"
 	}
 
-	req, err := http.NewRequest(method, url, reqBody)
+	return a.apiRequest(ctx, client, method, path, contentType, reqBody)
+}
+
+func (a *Agent) apiRequest(ctx context.Context, client *http.Client, method, path, contentType string, body io.Reader) ([]byte, error) {
+	url := a.config.ServerURL + path
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("X-API-Key", a.config.APIKey)
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
 	}
 
-	resp, err := a.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var envelope struct {
+			Code int `json:"code"`
+		}
+		if json.Unmarshal(data, &envelope) != nil || envelope.Code == 0 {
+			return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, path)
+		}
+	}
+	return data, nil
 }
\ No newline at end of file
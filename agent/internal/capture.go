@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	outputPreviewSize = 4096
+	captureMaxLine    = 64 * 1024
+)
+
+type outputCapture struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	err    error
+
+	stdout *captureStream
+	stderr *captureStream
+}
+
+type captureStream struct {
+	capture *outputCapture
+	name    string
+	partial []byte
+	tail    []byte
+	dropped bool
+}
+
+func newOutputCapture() (*outputCapture, error) {
+	file, err := os.CreateTemp("", "cslite-output-*.log")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &outputCapture{
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}
+	c.stdout = &captureStream{capture: c, name: "stdout"}
+	c.stderr = &captureStream{capture: c, name: "stderr"}
+	return c, nil
+}
+
+func (c *outputCapture) Stdout() *captureStream {
+	return c.stdout
+}
+
+func (c *outputCapture) Stderr() *captureStream {
+	return c.stderr
+}
+
+func (s *captureStream) Write(p []byte) (int, error) {
+	s.capture.mu.Lock()
+	defer s.capture.mu.Unlock()
+
+	s.keepTail(p)
+
+	data := p
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			s.partial = append(s.partial, data...)
+			if len(s.partial) >= captureMaxLine {
+				s.writeLine(s.partial)
+				s.partial = s.partial[:0]
+			}
+			break
+		}
+
+		s.partial = append(s.partial, data[:i]...)
+		s.writeLine(s.partial)
+		s.partial = s.partial[:0]
+		data = data[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (s *captureStream) keepTail(p []byte) {
+	s.tail = append(s.tail, p...)
+	if len(s.tail) > 2*outputPreviewSize {
+		s.tail = append(s.tail[:0], s.tail[len(s.tail)-outputPreviewSize:]...)
+		s.dropped = true
+	}
+}
+
+func (s *captureStream) writeLine(line []byte) {
+	c := s.capture
+	if c.err != nil {
+		return
+	}
+
+	c.writer.WriteString(time.Now().UTC().Format("2006-01-02T15:04:05.000000Z"))
+	c.writer.WriteByte(' ')
+	c.writer.WriteString(s.name)
+	c.writer.WriteByte(' ')
+	c.writer.Write(line)
+	if err := c.writer.WriteByte('\n'); err != nil {
+		c.err = err
+	}
+}
+
+func (s *captureStream) preview() string {
+	tail := s.tail
+	dropped := s.dropped
+	if len(tail) > outputPreviewSize {
+		tail = tail[len(tail)-outputPreviewSize:]
+		dropped = true
+	}
+
+	text := strings.TrimSpace(string(tail))
+	if dropped {
+		for len(text) > 0 && !utf8.RuneStart(text[0]) {
+			text = text[1:]
+		}
+		text = "... (truncated)\n" + text
+	}
+	return text
+}
+
+func (c *outputCapture) Close() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, stream := range []*captureStream{c.stdout, c.stderr} {
+		if len(stream.partial) > 0 {
+			stream.writeLine(stream.partial)
+			stream.partial = nil
+		}
+	}
+
+	if err := c.writer.Flush(); err != nil && c.err == nil {
+		c.err = err
+	}
+	if err := c.file.Close(); err != nil && c.err == nil {
+		c.err = err
+	}
+	if c.err != nil {
+		os.Remove(c.file.Name())
+		return "", c.err
+	}
+	return c.file.Name(), nil
+}
+
+func (c *outputCapture) Preview() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	output := c.stdout.preview()
+	if stderr := c.stderr.preview(); stderr != "" {
+		if output != "" {
+			output += "\n"
+		}
+		output += "[stderr]\n" + stderr
+	}
+	return output
+}
+
+func (c *outputCapture) Discard() {
+	if path, err := c.Close(); err == nil {
+		os.Remove(path)
+	}
+}
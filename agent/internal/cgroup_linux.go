@@ -0,0 +1,201 @@
+//go:build linux
+
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	cgroupRoot   = "/sys/fs/cgroup"
+	cgroupParent = "/sys/fs/cgroup/cslite"
+)
+
+type cgroupScope struct {
+	path string
+	dir  *os.File
+}
+
+func limitResources(shellCmd *exec.Cmd, cmd *Command) (*cgroupScope, error) {
+	limits := cmd.ResourceLimits
+	if limits == nil {
+		return nil, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, errors.New("resource limits require cgroup v2, which is not available on this host")
+	}
+
+	var controllers []string
+	if limits.MemoryMaxMB > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if limits.CPUPercent > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if limits.PidsMax > 0 {
+		controllers = append(controllers, "pids")
+	}
+	if limits.IOWeight > 0 {
+		controllers = append(controllers, "io")
+	}
+
+	if err := os.MkdirAll(cgroupParent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	for _, controller := range controllers {
+		if err := enableController(cgroupRoot, controller); err != nil {
+			return nil, err
+		}
+		if err := enableController(cgroupParent, controller); err != nil {
+			return nil, err
+		}
+	}
+
+	path := filepath.Join(cgroupParent, fmt.Sprintf("exec_%s_%d", cmd.ExecutionID, cmd.Attempt))
+	if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	scope := &cgroupScope{path: path}
+
+	if err := scope.apply(limits); err != nil {
+		scope.close()
+		return nil, err
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		scope.close()
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+	scope.dir = dir
+
+	if shellCmd.SysProcAttr == nil {
+		shellCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	shellCmd.SysProcAttr.UseCgroupFD = true
+	shellCmd.SysProcAttr.CgroupFD = int(dir.Fd())
+
+	return scope, nil
+}
+
+func enableController(dir, controller string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err == nil {
+		for _, enabled := range strings.Fields(string(data)) {
+			if enabled == controller {
+				return nil
+			}
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+controller), 0644); err != nil {
+		return fmt.Errorf("failed to enable cgroup controller %s: %w", controller, err)
+	}
+	return nil
+}
+
+func (s *cgroupScope) apply(limits *ResourceLimits) error {
+	if limits.MemoryMaxMB > 0 {
+		if err := s.write("memory.max", strconv.FormatInt(limits.MemoryMaxMB*1024*1024, 10)); err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(s.path, "memory.swap.max")); err == nil {
+			if err := s.write("memory.swap.max", "0"); err != nil {
+				return err
+			}
+		}
+	}
+	if limits.CPUPercent > 0 {
+		if err := s.write("cpu.max", fmt.Sprintf("%d 100000", limits.CPUPercent*1000)); err != nil {
+			return err
+		}
+	}
+	if limits.PidsMax > 0 {
+		if err := s.write("pids.max", strconv.Itoa(limits.PidsMax)); err != nil {
+			return err
+		}
+	}
+	if limits.IOWeight > 0 {
+		if err := s.write("io.weight", fmt.Sprintf("default %d", limits.IOWeight)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *cgroupScope) write(name, value string) error {
+	if err := os.WriteFile(filepath.Join(s.path, name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *cgroupScope) usage() *ResourceUsage {
+	usage := &ResourceUsage{}
+
+	if value, err := s.readInt("memory.peak"); err == nil {
+		usage.MemoryPeakBytes = value
+	}
+	if value, err := s.readInt("pids.peak"); err == nil {
+		usage.PidsPeak = int(value)
+	}
+	if value, ok := s.readKey("cpu.stat", "usage_usec"); ok {
+		usage.CPUUsageUsec = value
+	}
+	if value, ok := s.readKey("memory.events", "oom_kill"); ok {
+		usage.OOMKills = int(value)
+	}
+
+	return usage
+}
+
+func (s *cgroupScope) readInt(name string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(s.path, name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func (s *cgroupScope) readKey(name, key string) (int64, bool) {
+	file, err := os.Open(filepath.Join(s.path, name))
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			value, err := strconv.ParseInt(fields[1], 10, 64)
+			return value, err == nil
+		}
+	}
+	return 0, false
+}
+
+func (s *cgroupScope) close() {
+	if s.dir != nil {
+		s.dir.Close()
+	}
+
+	os.WriteFile(filepath.Join(s.path, "cgroup.kill"), []byte("1"), 0644)
+
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(s.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
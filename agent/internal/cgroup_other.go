@@ -0,0 +1,24 @@
+//go:build !linux
+
+package internal
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+type cgroupScope struct{}
+
+func limitResources(shellCmd *exec.Cmd, cmd *Command) (*cgroupScope, error) {
+	if cmd.ResourceLimits == nil {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("resource limits are not supported on %s", runtime.GOOS)
+}
+
+func (s *cgroupScope) usage() *ResourceUsage {
+	return nil
+}
+
+func (s *cgroupScope) close() {}
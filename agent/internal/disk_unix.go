@@ -0,0 +1,20 @@
+//go:build !windows
+
+package internal
+
+import "syscall"
+
+func readRootDiskUsage() float64 {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs("/", &stat); err != nil {
+		return 0
+	}
+
+	blockSize := uint64(stat.Bsize)
+	used := (stat.Blocks - stat.Bfree) * blockSize
+	available := uint64(stat.Bavail) * blockSize
+	if used+available == 0 {
+		return 0
+	}
+	return round2(float64(used) / float64(used+available) * 100)
+}
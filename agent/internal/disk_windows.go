@@ -0,0 +1,7 @@
+//go:build windows
+
+package internal
+
+func readRootDiskUsage() float64 {
+	return 0
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var strippedEnvPrefixes = []string{"AGENT_", "CSLITE_"}
+
+func commandEnv(cmd *Command, deviceID string) []string {
+	var env []string
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if !strippedEnv(key) {
+			env = append(env, entry)
+		}
+	}
+
+	keys := make([]string, 0, len(cmd.EnvVars))
+	for key := range cmd.EnvVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+cmd.EnvVars[key])
+	}
+
+	return append(env,
+		"CSLITE_COMMAND_ID="+cmd.CommandID,
+		"CSLITE_EXECUTION_ID="+cmd.ExecutionID,
+		"CSLITE_ATTEMPT="+strconv.Itoa(cmd.Attempt),
+		"CSLITE_DEVICE_ID="+deviceID,
+	)
+}
+
+func strippedEnv(key string) bool {
+	key = strings.ToUpper(key)
+	for _, prefix := range strippedEnvPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
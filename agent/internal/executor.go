@@ -1,33 +1,62 @@
 package internal
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
+	"errors"
+	"io"
+	"os"
 	"os/exec"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	commandQueued  = "queued"
+	commandHeld    = "held"
+	commandBlocked = "blocked"
+	commandRunning = "running"
+	commandDropped = "cancelled"
+)
+
+type trackedCommand struct {
+	cmd       *Command
+	state     string
+	paused    bool
+	cancelled bool
+	cancel    context.CancelFunc
+}
+
 type CommandExecutor struct {
 	agent    *Agent
 	stopChan chan struct{}
 	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	tracked map[string]*trackedCommand
+	locks   map[string]string
+	blocked map[string][]*Command
+	freed   chan struct{}
 }
 
 func NewCommandExecutor(agent *Agent) *CommandExecutor {
 	return &CommandExecutor{
 		agent:    agent,
 		stopChan: make(chan struct{}),
+		tracked:  make(map[string]*trackedCommand),
+		locks:    make(map[string]string),
+		blocked:  make(map[string][]*Command),
+		freed:    make(chan struct{}, 1),
 	}
 }
 
 func (e *CommandExecutor) Start() {
-	e.wg.Add(1)
-	go e.processCommands()
+	workers := e.agent.config.MaxConcurrency
+	e.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go e.processCommands()
+	}
 }
 
 func (e *CommandExecutor) Stop() {
@@ -41,73 +70,318 @@ func (e *CommandExecutor) processCommands() {
 	for {
 		select {
 		case cmd := <-e.agent.commandQueue:
-			e.executeCommand(cmd)
+			for cmd != nil {
+				cmd = e.executeCommand(cmd)
+			}
 		case <-e.stopChan:
 			return
 		}
 	}
 }
 
-func (e *CommandExecutor) executeCommand(cmd *Command) {
-	logrus.Infof("Executing command: %s", cmd.CommandID)
+func (e *CommandExecutor) Enqueue(cmd *Command) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.tracked[cmd.ExecutionID]; ok {
+		return true
+	}
+
+	select {
+	case e.agent.commandQueue <- cmd:
+		e.tracked[cmd.ExecutionID] = &trackedCommand{cmd: cmd, state: commandQueued}
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *CommandExecutor) Capacity() int {
+	return cap(e.agent.commandQueue) - len(e.agent.commandQueue)
+}
+
+func (e *CommandExecutor) Freed() <-chan struct{} {
+	return e.freed
+}
+
+func (e *CommandExecutor) Tracking(executionID string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, ok := e.tracked[executionID]
+	return ok
+}
+
+func (e *CommandExecutor) ApplyControls(controls []Control) {
+	paused := make(map[string]bool)
+	var cancelled []*Command
+
+	e.mu.Lock()
+	for _, control := range controls {
+		tracked, ok := e.tracked[control.ExecutionID]
+		if !ok {
+			continue
+		}
+
+		switch control.Action {
+		case ControlCancel:
+			if tracked.cancelled {
+				continue
+			}
+			tracked.cancelled = true
+			switch tracked.state {
+			case commandRunning:
+				logrus.Infof("Cancelling running command: %s", tracked.cmd.CommandID)
+				tracked.cancel()
+			case commandHeld, commandBlocked:
+				delete(e.tracked, control.ExecutionID)
+				cancelled = append(cancelled, tracked.cmd)
+			}
+		case ControlPause:
+			paused[control.ExecutionID] = true
+			if !tracked.paused {
+				logrus.Infof("Pausing command: %s", tracked.cmd.CommandID)
+			}
+			tracked.paused = true
+		}
+	}
+
+	for executionID, tracked := range e.tracked {
+		if paused[executionID] || !tracked.paused {
+			continue
+		}
+		tracked.paused = false
+		if tracked.state != commandHeld {
+			continue
+		}
+
+		select {
+		case e.agent.commandQueue <- tracked.cmd:
+			tracked.state = commandQueued
+			logrus.Infof("Resumed command: %s", tracked.cmd.CommandID)
+		default:
+			tracked.paused = true
+		}
+	}
+	e.mu.Unlock()
+
+	for _, cmd := range cancelled {
+		e.reportCancelled(cmd)
+	}
+}
+
+func (e *CommandExecutor) begin(cmd *Command) (context.Context, context.CancelFunc, string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	tracked, ok := e.tracked[cmd.ExecutionID]
+	if !ok {
+		tracked = &trackedCommand{cmd: cmd}
+		e.tracked[cmd.ExecutionID] = tracked
+	}
+
+	if tracked.cancelled {
+		delete(e.tracked, cmd.ExecutionID)
+		return nil, nil, commandDropped
+	}
+	if tracked.paused {
+		tracked.state = commandHeld
+		logrus.Infof("Holding paused command: %s", cmd.CommandID)
+		return nil, nil, commandHeld
+	}
+	if key := cmd.LockKey; key != "" {
+		if holder, ok := e.locks[key]; ok && holder != cmd.ExecutionID {
+			tracked.state = commandBlocked
+			e.blocked[key] = append(e.blocked[key], cmd)
+			logrus.Infof("Command %s waiting for lock %s", cmd.CommandID, key)
+			return nil, nil, commandBlocked
+		}
+		e.locks[key] = cmd.ExecutionID
+	}
 
-	startTime := time.Now()
-	
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cmd.Timeout)*time.Second)
+	tracked.state = commandRunning
+	tracked.cancel = cancel
+	return ctx, cancel, commandRunning
+}
+
+func (e *CommandExecutor) finish(cmd *Command) (bool, *Command) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	tracked, ok := e.tracked[cmd.ExecutionID]
+	delete(e.tracked, cmd.ExecutionID)
+
+	select {
+	case e.freed <- struct{}{}:
+	default:
+	}
+
+	var next *Command
+	if key := cmd.LockKey; key != "" && e.locks[key] == cmd.ExecutionID {
+		delete(e.locks, key)
+		waiting := e.blocked[key]
+		for len(waiting) > 0 && next == nil {
+			if _, ok := e.tracked[waiting[0].ExecutionID]; ok {
+				next = waiting[0]
+			}
+			waiting = waiting[1:]
+		}
+		if len(waiting) > 0 {
+			e.blocked[key] = waiting
+		} else {
+			delete(e.blocked, key)
+		}
+	}
+
+	return ok && tracked.cancelled, next
+}
+
+func (e *CommandExecutor) executeCommand(cmd *Command) *Command {
+	ctx, cancel, state := e.begin(cmd)
+	switch state {
+	case commandHeld, commandBlocked:
+		return nil
+	case commandDropped:
+		e.reportCancelled(cmd)
+		return nil
+	}
 	defer cancel()
 
-	shellCmd := exec.CommandContext(ctx, "sh", "-c", cmd.Content)
-	
-	for key, value := range cmd.EnvVars {
-		shellCmd.Env = append(shellCmd.Env, key+"="+value)
+	logrus.Infof("Executing command: %s", cmd.CommandID)
+
+	startTime := time.Now()
+
+	shellCmd, scriptPath, err := buildCommand(ctx, cmd)
+	if scriptPath != "" {
+		defer os.Remove(scriptPath)
+	}
+	var capture *outputCapture
+	var scope *cgroupScope
+	if err == nil {
+		prepareProcess(shellCmd)
+		shellCmd.Env = commandEnv(cmd, e.agent.deviceID)
+		err = applyRunAs(shellCmd, cmd, scriptPath)
+	}
+	if err == nil {
+		capture, err = newOutputCapture()
+	}
+	if err == nil {
+		scope, err = limitResources(shellCmd, cmd)
+	}
+	if err != nil {
+		if capture != nil {
+			capture.Discard()
+		}
+		_, next := e.finish(cmd)
+		e.reportStartFailure(cmd, err)
+		return next
 	}
+	shellCmd.Dir = cmd.WorkingDir
+	shellCmd.WaitDelay = 5 * time.Second
 
-	var stdout, stderr bytes.Buffer
-	shellCmd.Stdout = &stdout
-	shellCmd.Stderr = &stderr
+	streamer := newOutputStreamer(e.agent, cmd)
+	shellCmd.Stdout = io.MultiWriter(capture.Stdout(), streamer)
+	shellCmd.Stderr = io.MultiWriter(capture.Stderr(), streamer)
+
+	err = runProcess(shellCmd, cmd.Umask)
+	var usage *ResourceUsage
+	if scope != nil {
+		usage = scope.usage()
+		scope.close()
+	}
+	streamSeq := streamer.Close()
+	cancelled, next := e.finish(cmd)
 
-	err := shellCmd.Run()
-	
 	exitCode := 0
 	status := "completed"
-	output := stdout.String()
-	
+
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
+		if cancelled {
+			status = "cancelled"
+			exitCode = -1
+		} else if ctx.Err() == context.DeadlineExceeded {
 			status = "timeout"
 			exitCode = -1
+		} else if usage != nil && usage.OOMKills > 0 {
+			status = "oom_killed"
+			exitCode = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			}
 		} else {
 			status = "failed"
 			if exitErr, ok := err.(*exec.ExitError); ok {
 				exitCode = exitErr.ExitCode()
 			} else {
 				exitCode = -1
+				capture.Stderr().Write([]byte(err.Error() + "\n"))
 			}
 		}
-		output += "\n" + stderr.String()
 	}
 
-	output = strings.TrimSpace(output)
-	if len(output) > 10000 {
-		output = output[:10000] + "\n... (truncated)"
+	logPath, captureErr := capture.Close()
+	if captureErr != nil {
+		logrus.Warnf("Failed to capture output of command %s: %v", cmd.CommandID, captureErr)
 	}
+	output := capture.Preview()
 
 	completedAt := time.Now()
-	
+
 	result := &ExecutionResult{
 		ExecutionID: cmd.ExecutionID,
 		DeviceID:    e.agent.deviceID,
+		Attempt:     cmd.Attempt,
 		Status:      status,
 		ExitCode:    exitCode,
 		Output:      output,
-		Log:         base64.StdEncoding.EncodeToString([]byte(output)),
 		CompletedAt: completedAt.Format(time.RFC3339),
-	}
+		StreamSeq:   streamSeq,
 
-	if err := e.agent.ReportResult(result); err != nil {
-		logrus.Error("Failed to report result:", err)
+		ResourceUsage: usage,
 	}
 
+	e.agent.SubmitResult(result, logPath)
+
 	duration := completedAt.Sub(startTime)
 	logrus.Infof("Command %s completed in %v with status: %s", cmd.CommandID, duration, status)
-}
\ No newline at end of file
+
+	return next
+}
+
+func (e *CommandExecutor) reportStartFailure(cmd *Command, err error) {
+	status := "failed"
+	var unavailable *interpreterUnavailableError
+	if errors.As(err, &unavailable) {
+		status = "interpreter_unavailable"
+	}
+
+	result := &ExecutionResult{
+		ExecutionID: cmd.ExecutionID,
+		DeviceID:    e.agent.deviceID,
+		Attempt:     cmd.Attempt,
+		Status:      status,
+		ExitCode:    -1,
+		Output:      err.Error(),
+		CompletedAt: time.Now().Format(time.RFC3339),
+	}
+
+	e.agent.SubmitResult(result, "")
+
+	logrus.Errorf("Command %s could not be started: %v", cmd.CommandID, err)
+}
+
+func (e *CommandExecutor) reportCancelled(cmd *Command) {
+	result := &ExecutionResult{
+		ExecutionID: cmd.ExecutionID,
+		DeviceID:    e.agent.deviceID,
+		Attempt:     cmd.Attempt,
+		Status:      "cancelled",
+		ExitCode:    -1,
+		CompletedAt: time.Now().Format(time.RFC3339),
+	}
+
+	e.agent.SubmitResult(result, "")
+
+	logrus.Infof("Command %s cancelled before execution", cmd.CommandID)
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+const (
+	InterpreterSh         = "sh"
+	InterpreterBash       = "bash"
+	InterpreterPython     = "python"
+	InterpreterPowerShell = "powershell"
+	InterpreterCmd        = "cmd"
+	InterpreterExec       = "exec"
+)
+
+type interpreterUnavailableError struct {
+	interpreter string
+	reason      string
+}
+
+func (e *interpreterUnavailableError) Error() string {
+	return fmt.Sprintf("interpreter %s not available on %s/%s: %s", e.interpreter, runtime.GOOS, runtime.GOARCH, e.reason)
+}
+
+type interpreterSpec struct {
+	candidates []string
+	inline     []string
+	script     []string
+	ext        string
+}
+
+var interpreters = map[string]interpreterSpec{
+	InterpreterSh:         {candidates: []string{"sh"}, inline: []string{"-c"}, ext: ".sh"},
+	InterpreterBash:       {candidates: []string{"bash"}, inline: []string{"-c"}, ext: ".sh"},
+	InterpreterPython:     {candidates: []string{"python3", "python"}, inline: []string{"-c"}, ext: ".py"},
+	InterpreterPowerShell: {candidates: []string{"pwsh", "powershell"}, inline: []string{"-NoProfile", "-NonInteractive", "-Command"}, script: []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File"}, ext: ".ps1"},
+	InterpreterCmd:        {candidates: []string{"cmd"}, inline: []string{"/C"}, script: []string{"/C"}, ext: ".cmd"},
+}
+
+func defaultInterpreter() string {
+	if runtime.GOOS == "windows" {
+		return InterpreterCmd
+	}
+	return InterpreterSh
+}
+
+func buildCommand(ctx context.Context, cmd *Command) (*exec.Cmd, string, error) {
+	interpreter := cmd.Interpreter
+	if interpreter == "" {
+		interpreter = defaultInterpreter()
+	}
+
+	if interpreter == InterpreterExec {
+		path, err := exec.LookPath(cmd.Content)
+		if err != nil {
+			return nil, "", &interpreterUnavailableError{interpreter: cmd.Content, reason: err.Error()}
+		}
+		return exec.CommandContext(ctx, path, cmd.Args...), "", nil
+	}
+
+	spec, ok := interpreters[interpreter]
+	if !ok {
+		return nil, "", &interpreterUnavailableError{interpreter: interpreter, reason: "unsupported interpreter"}
+	}
+
+	path, err := lookPathAny(spec.candidates)
+	if err != nil {
+		return nil, "", &interpreterUnavailableError{interpreter: interpreter, reason: err.Error()}
+	}
+
+	if cmd.Script == "" {
+		args := append(append([]string{}, spec.inline...), cmd.Content)
+		if len(cmd.Args) > 0 && (interpreter == InterpreterSh || interpreter == InterpreterBash) {
+			args = append(append(args, interpreter), cmd.Args...)
+		} else {
+			args = append(args, cmd.Args...)
+		}
+		return exec.CommandContext(ctx, path, args...), "", nil
+	}
+
+	scriptPath, err := writeScript(cmd.Script, spec.ext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	args := append(append(append([]string{}, spec.script...), scriptPath), cmd.Args...)
+	return exec.CommandContext(ctx, path, args...), scriptPath, nil
+}
+
+func lookPathAny(candidates []string) (string, error) {
+	var lastErr error
+	for _, name := range candidates {
+		path, err := exec.LookPath(name)
+		if err == nil {
+			return path, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+func writeScript(body, ext string) (string, error) {
+	file, err := os.CreateTemp("", "cslite-*"+ext)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := file.WriteString(body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	if err := os.Chmod(file.Name(), 0700); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -1,128 +1,107 @@
 package internal
 
 import (
-	"bufio"
-	"os"
 	"runtime"
-	"strconv"
-	"strings"
-	"syscall"
+	"sort"
+	"sync"
 	"time"
 )
 
-func collectMetrics() *SystemMetrics {
-	return &SystemMetrics{
-		CPUUsage:   getCPUUsage(),
-		MemoryUsed: getMemoryUsage(),
-		DiskUsage:  getDiskUsage(),
-	}
+type cpuTimes struct {
+	total uint64
+	idle  uint64
 }
 
-func getCPUUsage() float64 {
-	if runtime.GOOS == "linux" {
-		return getLinuxCPUUsage()
-	}
-	return 0.0
+type netCounters struct {
+	rxBytes uint64
+	txBytes uint64
 }
 
-func getLinuxCPUUsage() float64 {
-	file, err := os.Open("/proc/stat")
-	if err != nil {
-		return 0.0
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	if scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
-		if len(fields) < 5 || fields[0] != "cpu" {
-			return 0.0
-		}
-
-		user, _ := strconv.ParseFloat(fields[1], 64)
-		nice, _ := strconv.ParseFloat(fields[2], 64)
-		system, _ := strconv.ParseFloat(fields[3], 64)
-		idle, _ := strconv.ParseFloat(fields[4], 64)
+type metricsSampler struct {
+	mu      sync.Mutex
+	cpu     cpuTimes
+	cpuOK   bool
+	net     map[string]netCounters
+	sampled time.Time
+}
 
-		total := user + nice + system + idle
-		if total == 0 {
-			return 0.0
-		}
+func newMetricsSampler() *metricsSampler {
+	s := &metricsSampler{}
+	s.cpu, s.cpuOK = readCPUTimes()
+	s.net = readNetCounters()
+	s.sampled = time.Now()
+	return s
+}
 
-		usage := ((total - idle) / total) * 100
-		return usage
-	}
+func (s *metricsSampler) collect() *SystemMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return 0.0
-}
+	now := time.Now()
+	elapsed := now.Sub(s.sampled).Seconds()
 
-func getMemoryUsage() int {
-	if runtime.GOOS == "linux" {
-		return getLinuxMemoryUsage()
-	}
-	return 0
-}
+	metrics := &SystemMetrics{}
 
-func getLinuxMemoryUsage() int {
-	file, err := os.Open("/proc/meminfo")
-	if err != nil {
-		return 0
+	cpu, ok := readCPUTimes()
+	if ok && s.cpuOK && cpu.total > s.cpu.total {
+		total := cpu.total - s.cpu.total
+		idle := cpu.idle - s.cpu.idle
+		if idle > total {
+			idle = total
+		}
+		metrics.CPUUsage = round2(float64(total-idle) / float64(total) * 100)
 	}
-	defer file.Close()
-
-	var total, available int64
-	scanner := bufio.NewScanner(file)
-	
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
+	s.cpu, s.cpuOK = cpu, ok
+
+	net := readNetCounters()
+	for _, name := range sortedKeys(net) {
+		current := net[name]
+		iface := InterfaceMetrics{
+			Name:    name,
+			RxBytes: current.rxBytes,
+			TxBytes: current.txBytes,
 		}
-
-		switch fields[0] {
-		case "MemTotal:":
-			total, _ = strconv.ParseInt(fields[1], 10, 64)
-		case "MemAvailable:":
-			available, _ = strconv.ParseInt(fields[1], 10, 64)
+		if previous, ok := s.net[name]; ok && elapsed > 0 {
+			iface.RxRate = counterRate(previous.rxBytes, current.rxBytes, elapsed)
+			iface.TxRate = counterRate(previous.txBytes, current.txBytes, elapsed)
 		}
+		metrics.NetworkIn += iface.RxRate
+		metrics.NetworkOut += iface.TxRate
+		metrics.Interfaces = append(metrics.Interfaces, iface)
 	}
+	s.net = net
+	s.sampled = now
 
-	if total > 0 && available > 0 {
-		used := total - available
-		return int(used / 1024)
-	}
+	readMemory(metrics)
+	metrics.Load1, metrics.Load5, metrics.Load15 = readLoadAverage()
+	metrics.Uptime = readUptime()
+
+	metrics.Disks = readDisks()
+	metrics.DiskUsage = readRootDiskUsage()
 
-	return 0
+	return metrics
 }
 
-func getDiskUsage() float64 {
-	var stat syscall.Statfs_t
-	err := syscall.Statfs("/", &stat)
-	if err != nil {
-		return 0.0
+func counterRate(previous, current uint64, seconds float64) int {
+	if current < previous {
+		return 0
 	}
+	return int(float64(current-previous) / 1024 / seconds)
+}
 
-	total := stat.Blocks * uint64(stat.Bsize)
-	free := stat.Bfree * uint64(stat.Bsize)
-	used := total - free
+func round2(value float64) float64 {
+	return float64(int64(value*100+0.5)) / 100
+}
 
-	if total == 0 {
-		return 0.0
+func sortedKeys(m map[string]netCounters) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-
-	return float64(used) / float64(total) * 100
+	sort.Strings(keys)
+	return keys
 }
 
 func getPlatform() string {
 	return runtime.GOOS + "/" + runtime.GOARCH
 }
-
-var lastCPUStats struct {
-	user   float64
-	nice   float64
-	system float64
-	idle   float64
-	time   time.Time
-}
\ No newline at end of file
@@ -0,0 +1,203 @@
+//go:build linux
+
+package internal
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var pseudoFilesystems = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true,
+	"configfs": true, "debugfs": true, "devpts": true, "devtmpfs": true, "efivarfs": true,
+	"fusectl": true, "hugetlbfs": true, "mqueue": true, "nsfs": true, "overlay": true,
+	"proc": true, "pstore": true, "ramfs": true, "rpc_pipefs": true, "securityfs": true,
+	"selinuxfs": true, "squashfs": true, "sysfs": true, "tmpfs": true, "tracefs": true,
+}
+
+func readCPUTimes() (cpuTimes, bool) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return cpuTimes{}, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return cpuTimes{}, false
+	}
+
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}, false
+	}
+
+	var times cpuTimes
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		value, _ := strconv.ParseUint(field, 10, 64)
+		times.total += value
+		if i == 3 || i == 4 {
+			times.idle += value
+		}
+	}
+	return times, true
+}
+
+func readNetCounters() map[string]netCounters {
+	counters := make(map[string]netCounters)
+
+	file, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return counters
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, data, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(data)
+		if name == "lo" || len(fields) < 9 {
+			continue
+		}
+
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		counters[name] = netCounters{rxBytes: rx, txBytes: tx}
+	}
+	return counters
+}
+
+func readMemory(metrics *SystemMetrics) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, _ := strconv.ParseInt(fields[1], 10, 64)
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+
+	if total, available := values["MemTotal"], values["MemAvailable"]; total > 0 && available > 0 {
+		metrics.MemoryTotal = int(total / 1024)
+		metrics.MemoryUsed = int((total - available) / 1024)
+	}
+	if total := values["SwapTotal"]; total > 0 {
+		metrics.SwapTotal = int(total / 1024)
+		metrics.SwapUsed = int((total - values["SwapFree"]) / 1024)
+	}
+}
+
+func readLoadAverage() (float64, float64, float64) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, 0, 0
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return 0, 0, 0
+	}
+
+	load1, _ := strconv.ParseFloat(fields[0], 64)
+	load5, _ := strconv.ParseFloat(fields[1], 64)
+	load15, _ := strconv.ParseFloat(fields[2], 64)
+	return load1, load5, load15
+}
+
+func readUptime() int64 {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 1 {
+		return 0
+	}
+
+	uptime, _ := strconv.ParseFloat(fields[0], 64)
+	return int64(uptime)
+}
+
+func readDisks() []DiskMetrics {
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var disks []DiskMetrics
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		device, mountpoint, fstype := fields[0], unescapeMount(fields[1]), fields[2]
+		if (pseudoFilesystems[fstype] && mountpoint != "/") || seen[device] {
+			continue
+		}
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(mountpoint, &stat); err != nil || stat.Blocks == 0 {
+			continue
+		}
+		seen[device] = true
+
+		blockSize := uint64(stat.Bsize)
+		used := (stat.Blocks - stat.Bfree) * blockSize
+		available := stat.Bavail * blockSize
+
+		disk := DiskMetrics{
+			Mountpoint: mountpoint,
+			Fstype:     fstype,
+			TotalMB:    int64(stat.Blocks * blockSize / 1024 / 1024),
+			UsedMB:     int64(used / 1024 / 1024),
+		}
+		if used+available > 0 {
+			disk.Usage = round2(float64(used) / float64(used+available) * 100)
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+func unescapeMount(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
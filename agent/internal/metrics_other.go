@@ -0,0 +1,25 @@
+//go:build !linux
+
+package internal
+
+func readCPUTimes() (cpuTimes, bool) {
+	return cpuTimes{}, false
+}
+
+func readNetCounters() map[string]netCounters {
+	return map[string]netCounters{}
+}
+
+func readMemory(metrics *SystemMetrics) {}
+
+func readLoadAverage() (float64, float64, float64) {
+	return 0, 0, 0
+}
+
+func readUptime() int64 {
+	return 0
+}
+
+func readDisks() []DiskMetrics {
+	return nil
+}
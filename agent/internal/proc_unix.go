@@ -0,0 +1,133 @@
+//go:build !windows
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func prepareProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func applyRunAs(cmd *exec.Cmd, command *Command, scriptPath string) error {
+	if command.RunAs == "" && command.RunAsGroup == "" {
+		return nil
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+	var groups []uint32
+	var account *user.User
+
+	if command.RunAs != "" {
+		u, err := lookupUser(command.RunAs)
+		if err != nil {
+			return err
+		}
+		account = u
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+
+		ids, err := u.GroupIds()
+		if err == nil {
+			for _, id := range ids {
+				if n, err := strconv.Atoi(id); err == nil {
+					groups = append(groups, uint32(n))
+				}
+			}
+		}
+	}
+
+	if command.RunAsGroup != "" {
+		g, err := lookupGroup(command.RunAsGroup)
+		if err != nil {
+			return err
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	if os.Geteuid() != 0 && (uid != os.Geteuid() || gid != os.Getegid()) {
+		return fmt.Errorf("agent is not running as root, cannot switch to uid %d gid %d", uid, gid)
+	}
+
+	if scriptPath != "" {
+		if err := os.Chown(scriptPath, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	if account != nil {
+		for _, entry := range []string{"HOME=" + account.HomeDir, "USER=" + account.Username, "LOGNAME=" + account.Username} {
+			key, _, _ := strings.Cut(entry, "=")
+			if _, ok := command.EnvVars[key]; !ok {
+				cmd.Env = append(cmd.Env, entry)
+			}
+		}
+	}
+
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    uint32(uid),
+		Gid:    uint32(gid),
+		Groups: groups,
+	}
+	return nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		if u, err := user.LookupId(name); err == nil {
+			return u, nil
+		}
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("run_as user %s not found: %w", name, err)
+	}
+	return u, nil
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		if g, err := user.LookupGroupId(name); err == nil {
+			return g, nil
+		}
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return nil, fmt.Errorf("run_as_group %s not found: %w", name, err)
+	}
+	return g, nil
+}
+
+func runProcess(cmd *exec.Cmd, umask string) error {
+	if umask != "" {
+		value, err := strconv.ParseUint(umask, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid umask %s: %w", umask, err)
+		}
+		if cmd.Err != nil {
+			return cmd.Err
+		}
+		script := fmt.Sprintf(`umask %03o && exec "$0" "$@"`, value)
+		cmd.Args = append([]string{"/bin/sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+		cmd.Path = "/bin/sh"
+	}
+
+	return cmd.Run()
+}
@@ -0,0 +1,36 @@
+//go:build windows
+
+package internal
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+)
+
+func prepareProcess(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+func applyRunAs(cmd *exec.Cmd, command *Command, scriptPath string) error {
+	if command.RunAs != "" || command.RunAsGroup != "" {
+		return errors.New("run_as is not supported on windows")
+	}
+	return nil
+}
+
+func runProcess(cmd *exec.Cmd, umask string) error {
+	return cmd.Run()
+}
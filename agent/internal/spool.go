@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	spoolRetryMin = 5 * time.Second
+	spoolRetryMax = 5 * time.Minute
+)
+
+type resultSpool struct {
+	agent *Agent
+	dir   string
+	wake  chan struct{}
+}
+
+func newResultSpool(agent *Agent, dir string) *resultSpool {
+	return &resultSpool{
+		agent: agent,
+		dir:   dir,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+func (s *resultSpool) Submit(result *ExecutionResult, logPath string) {
+	if logPath != "" {
+		if err := s.writeLog(result, logPath); err != nil {
+			logrus.Errorf("Failed to spool log for execution %s: %v", result.ExecutionID, err)
+		}
+		os.Remove(logPath)
+	}
+
+	if err := s.write(result); err != nil {
+		logrus.Errorf("Failed to spool result for execution %s: %v", result.ExecutionID, err)
+		os.Remove(s.path(result, ".log.gz"))
+		if err := s.agent.ReportResult(result); err != nil {
+			logrus.Error("Failed to report result:", err)
+		}
+		return
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *resultSpool) loop(stopChan chan struct{}) {
+	backoff := spoolRetryMin
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-stopChan:
+			return
+		}
+
+		if s.flush() {
+			backoff = spoolRetryMin
+			timer.Reset(spoolRetryMax)
+			continue
+		}
+
+		logrus.Warnf("Server unreachable, retrying spooled results in %v", backoff)
+		timer.Reset(backoff)
+		backoff *= 2
+		if backoff > spoolRetryMax {
+			backoff = spoolRetryMax
+		}
+	}
+}
+
+func (s *resultSpool) flush() bool {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, filepath.Join(s.dir, entry.Name()))
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return modTime(files[i]).Before(modTime(files[j]))
+	})
+
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logrus.Errorf("Failed to read spooled result %s: %v", path, err)
+			continue
+		}
+
+		var result ExecutionResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			logrus.Errorf("Dropping corrupt spooled result %s: %v", path, err)
+			os.Remove(path)
+			continue
+		}
+
+		logPath := strings.TrimSuffix(path, ".json") + ".log.gz"
+		if _, err := os.Stat(logPath); err == nil && !result.LogUploaded {
+			err := s.agent.UploadLog(&result, logPath)
+			var rejected *rejectedError
+			if errors.As(err, &rejected) {
+				logrus.Warnf("Server rejected log for execution %s, dropping: %v", result.ExecutionID, err)
+			} else if err != nil {
+				logrus.Debugf("Failed to upload spooled log for execution %s: %v", result.ExecutionID, err)
+				return false
+			} else {
+				result.LogUploaded = true
+				if err := s.write(&result); err != nil {
+					logrus.Errorf("Failed to update spooled result %s: %v", path, err)
+				}
+			}
+		}
+		os.Remove(logPath)
+
+		err = s.agent.ReportResult(&result)
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			logrus.Warnf("Server rejected result for execution %s, dropping: %v", result.ExecutionID, err)
+		} else if err != nil {
+			logrus.Debugf("Failed to deliver spooled result for execution %s: %v", result.ExecutionID, err)
+			return false
+		}
+
+		os.Remove(path)
+	}
+
+	return true
+}
+
+func (s *resultSpool) write(result *ExecutionResult) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(result, ".json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *resultSpool) writeLog(result *ExecutionResult, logPath string) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	src, err := os.Open(logPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	path := s.path(result, ".log.gz")
+	tmpPath := path + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *resultSpool) path(result *ExecutionResult, ext string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s_%d%s", filepath.Base(result.ExecutionID), result.Attempt, ext))
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
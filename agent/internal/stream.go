@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	streamFlushInterval = 2 * time.Second
+	streamMaxChunkSize  = 32 * 1024
+	streamMaxBuffer     = 1024 * 1024
+)
+
+type outputStreamer struct {
+	agent       *Agent
+	executionID string
+	attempt     int
+
+	mu        sync.Mutex
+	buf       []byte
+	seq       int
+	dropped   bool
+	truncated int
+	pending   *OutputChunk
+
+	wake     chan struct{}
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+func newOutputStreamer(agent *Agent, cmd *Command) *outputStreamer {
+	s := &outputStreamer{
+		agent:       agent,
+		executionID: cmd.ExecutionID,
+		attempt:     cmd.Attempt,
+		wake:        make(chan struct{}, 1),
+		stopChan:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *outputStreamer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	s.buf = append(s.buf, p...)
+	if len(s.buf) > streamMaxBuffer {
+		cut := len(s.buf) - streamMaxBuffer/2
+		s.buf = append([]byte(nil), s.buf[cut:]...)
+		s.truncated += cut
+		s.dropped = true
+	}
+	full := len(s.buf) >= streamMaxChunkSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (s *outputStreamer) loop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.wake:
+			s.flush()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *outputStreamer) flush() {
+	if s.pending != nil {
+		if err := s.agent.ReportOutput(s.pending); err != nil {
+			logrus.Debugf("Failed to stream output chunk %d for execution %s: %v", s.pending.Seq, s.executionID, err)
+			return
+		}
+		s.pending = nil
+	}
+
+	s.mu.Lock()
+	if len(s.buf) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	data := s.buf
+	if s.truncated > 0 {
+		data = append([]byte(fmt.Sprintf("\n[... %d bytes truncated ...]\n", s.truncated)), data...)
+		s.truncated = 0
+	}
+	s.buf = nil
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+
+	chunk := &OutputChunk{
+		ExecutionID: s.executionID,
+		DeviceID:    s.agent.deviceID,
+		Attempt:     s.attempt,
+		Seq:         seq,
+		Data:        string(data),
+	}
+
+	if err := s.agent.ReportOutput(chunk); err != nil {
+		logrus.Debugf("Failed to stream output chunk %d for execution %s: %v", seq, s.executionID, err)
+		s.pending = chunk
+	}
+}
+
+func (s *outputStreamer) Close() int {
+	close(s.stopChan)
+	<-s.done
+	s.flush()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped || s.pending != nil || len(s.buf) > 0 {
+		return 0
+	}
+	return s.seq
+}
@@ -10,24 +10,83 @@ type HeartbeatRequest struct {
 	AgentID   string            `json:"agent_id"`
 	Metrics   *SystemMetrics    `json:"metrics"`
 	Timestamp string            `json:"timestamp"`
+	Interval  int               `json:"interval,omitempty"`
 }
 
 type Command struct {
 	CommandID   string            `json:"command_id"`
 	ExecutionID string            `json:"execution_id"`
+	Attempt     int               `json:"attempt"`
+	Interpreter string            `json:"interpreter,omitempty"`
 	Content     string            `json:"content"`
+	Script      string            `json:"script,omitempty"`
+	Args        []string          `json:"args,omitempty"`
+	RunAs       string            `json:"run_as,omitempty"`
+	RunAsGroup  string            `json:"run_as_group,omitempty"`
+	WorkingDir  string            `json:"working_dir,omitempty"`
+	Umask       string            `json:"umask,omitempty"`
 	Timeout     int               `json:"timeout"`
 	EnvVars     map[string]string `json:"env_vars"`
+	LockKey     string            `json:"lock_key,omitempty"`
+
+	ResourceLimits *ResourceLimits `json:"resource_limits,omitempty"`
+}
+
+type ResourceLimits struct {
+	MemoryMaxMB int64 `json:"memory_max_mb,omitempty"`
+	CPUPercent  int   `json:"cpu_percent,omitempty"`
+	PidsMax     int   `json:"pids_max,omitempty"`
+	IOWeight    int   `json:"io_weight,omitempty"`
+}
+
+type ResourceUsage struct {
+	MemoryPeakBytes int64 `json:"memory_peak_bytes"`
+	CPUUsageUsec    int64 `json:"cpu_usage_usec"`
+	PidsPeak        int   `json:"pids_peak"`
+	OOMKills        int   `json:"oom_kills"`
+}
+
+type AckRequest struct {
+	AgentID    string         `json:"agent_id"`
+	Executions []AckExecution `json:"executions"`
+}
+
+type AckExecution struct {
+	ExecutionID string `json:"execution_id"`
+	Attempt     int    `json:"attempt"`
+}
+
+const (
+	ControlCancel = "cancel"
+	ControlPause  = "pause"
+)
+
+type Control struct {
+	ExecutionID string `json:"execution_id"`
+	CommandID   string `json:"command_id"`
+	Action      string `json:"action"`
 }
 
 type ExecutionResult struct {
 	ExecutionID string `json:"execution_id"`
 	DeviceID    string `json:"device_id"`
+	Attempt     int    `json:"attempt,omitempty"`
 	Status      string `json:"status"`
 	ExitCode    int    `json:"exit_code"`
 	Output      string `json:"output"`
-	Log         string `json:"log"`
+	LogUploaded bool   `json:"log_uploaded,omitempty"`
 	CompletedAt string `json:"completed_at"`
+	StreamSeq   int    `json:"stream_seq,omitempty"`
+
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+}
+
+type OutputChunk struct {
+	ExecutionID string `json:"execution_id"`
+	DeviceID    string `json:"device_id"`
+	Attempt     int    `json:"attempt,omitempty"`
+	Seq         int    `json:"seq"`
+	Data        string `json:"data"`
 }
 
 type SystemMetrics struct {
@@ -36,4 +95,30 @@ type SystemMetrics struct {
 	DiskUsage   float64 `json:"disk_usage"`
 	NetworkIn   int     `json:"network_in,omitempty"`
 	NetworkOut  int     `json:"network_out,omitempty"`
+
+	MemoryTotal int                `json:"memory_total,omitempty"`
+	SwapUsed    int                `json:"swap_used"`
+	SwapTotal   int                `json:"swap_total"`
+	Load1       float64            `json:"load_1"`
+	Load5       float64            `json:"load_5"`
+	Load15      float64            `json:"load_15"`
+	Uptime      int64              `json:"uptime"`
+	Disks       []DiskMetrics      `json:"disks,omitempty"`
+	Interfaces  []InterfaceMetrics `json:"interfaces,omitempty"`
+}
+
+type DiskMetrics struct {
+	Mountpoint string  `json:"mountpoint"`
+	Fstype     string  `json:"fstype"`
+	TotalMB    int64   `json:"total_mb"`
+	UsedMB     int64   `json:"used_mb"`
+	Usage      float64 `json:"usage"`
+}
+
+type InterfaceMetrics struct {
+	Name    string `json:"name"`
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+	RxRate  int    `json:"rx_rate"`
+	TxRate  int    `json:"tx_rate"`
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 
 	"github.com/XRSec/Cslite/agent/internal"
@@ -33,6 +34,8 @@ func main() {
 		APIKey:              getEnvOrFlag("AGENT_KEY", *apiKey),
 		HeartbeatInterval:   *interval,
 		CommandPollInterval: 30,
+		LongPollWait:        getEnvAsInt("AGENT_LONG_POLL", 25),
+		MaxConcurrency:      getEnvAsInt("AGENT_MAX_CONCURRENCY", 4),
 		LogPath:             getEnvOrFlag("AGENT_LOG_PATH", "/var/log/cslite-agent.log"),
 	}
 
@@ -40,6 +43,10 @@ func main() {
 		log.Fatal("Server URL and API Key are required")
 	}
 
+	if config.MaxConcurrency < 1 {
+		config.MaxConcurrency = 1
+	}
+
 	agent, err := internal.NewAgent(config)
 	if err != nil {
 		log.Fatal("Failed to create agent:", err)
@@ -71,6 +78,13 @@ func setupLogger(level string) {
 	})
 }
 
+func getEnvAsInt(envKey string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(envKey)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
 func getEnvOrFlag(envKey, flagValue string) string {
 	if value := os.Getenv(envKey); value != "" {
 		return value
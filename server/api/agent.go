@@ -1,12 +1,15 @@
 package api
 
 import (
-	"encoding/base64"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/XRSec/Cslite/config"
 	"github.com/XRSec/Cslite/internal/agent"
+	"github.com/XRSec/Cslite/internal/log"
+	"github.com/XRSec/Cslite/models"
 	"github.com/gin-gonic/gin"
 )
 
@@ -30,16 +33,51 @@ type HeartbeatRequest struct {
 	AgentID   string                  `json:"agent_id" binding:"required"`
 	Metrics   *agent.HeartbeatMetrics `json:"metrics"`
 	Timestamp string                  `json:"timestamp"`
+	Interval  int                     `json:"interval" binding:"min=0"`
+}
+
+type AckRequest struct {
+	AgentID    string             `json:"agent_id" binding:"required"`
+	Executions []AckExecutionItem `json:"executions" binding:"required,min=1,dive"`
+}
+
+type AckExecutionItem struct {
+	ExecutionID string `json:"execution_id" binding:"required"`
+	Attempt     int    `json:"attempt" binding:"required,min=1"`
 }
 
 type ReportResultRequest struct {
 	ExecutionID string `json:"execution_id" binding:"required"`
 	DeviceID    string `json:"device_id" binding:"required"`
-	Status      string `json:"status" binding:"required,oneof=completed failed timeout cancelled"`
+	Attempt     int    `json:"attempt"`
+	Status      string `json:"status" binding:"required,oneof=completed failed timeout cancelled interpreter_unavailable oom_killed"`
 	ExitCode    int    `json:"exit_code"`
 	Output      string `json:"output"`
 	Log         string `json:"log"`
+	LogUploaded bool   `json:"log_uploaded"`
 	CompletedAt string `json:"completed_at"`
+	StreamSeq   int    `json:"stream_seq"`
+
+	ResourceUsage *models.ResourceUsage `json:"resource_usage"`
+}
+
+type UploadResultLogRequest struct {
+	ExecutionID string `form:"execution_id" binding:"required"`
+	DeviceID    string `form:"device_id" binding:"required"`
+	Attempt     int    `form:"attempt"`
+	Offset      int64  `form:"offset" binding:"min=0"`
+	Final       bool   `form:"final"`
+}
+
+// maxLogChunkSize 单个日志分片的最大字节数
+const maxLogChunkSize = 4 << 20
+
+type ReportResultStreamRequest struct {
+	ExecutionID string `json:"execution_id" binding:"required"`
+	DeviceID    string `json:"device_id" binding:"required"`
+	Attempt     int    `json:"attempt"`
+	Seq         int    `json:"seq" binding:"required,min=1"`
+	Data        string `json:"data"`
 }
 
 func (h *AgentHandler) Register(c *gin.Context) {
@@ -121,7 +159,7 @@ func (h *AgentHandler) Heartbeat(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.Heartbeat(req.AgentID, req.Metrics); err != nil {
+	if err := h.service.Heartbeat(req.AgentID, req.Metrics, c.ClientIP(), req.Interval); err != nil {
 		if err == agent.ErrAgentNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40010,
@@ -169,7 +207,22 @@ func (h *AgentHandler) PollCommands(c *gin.Context) {
 		return
 	}
 
-	commands, err := h.service.GetPendingCommands(agentID)
+	// wait>0 时以长轮询方式等待新任务，最长不超过服务端配置
+	wait, _ := strconv.Atoi(c.DefaultQuery("wait", "0"))
+	if wait > config.AppConfig.LongPollMax {
+		wait = config.AppConfig.LongPollMax
+	}
+	if wait < 0 {
+		wait = 0
+	}
+
+	// capacity 为Agent本地队列剩余容量，未提供时（旧版Agent）不限制
+	capacity, err := strconv.Atoi(c.DefaultQuery("capacity", "-1"))
+	if err != nil || capacity < 0 {
+		capacity = -1
+	}
+
+	commands, controls, err := h.service.WaitForCommands(c.Request.Context(), agentID, capacity, time.Duration(wait)*time.Second)
 	if err != nil {
 		if err == agent.ErrAgentNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -200,11 +253,13 @@ func (h *AgentHandler) PollCommands(c *gin.Context) {
 		"message": "获取成功",
 		"data": gin.H{
 			"commands": commands,
+			"controls": controls,
+			"wait":     wait,
 		},
 	})
 }
 
-func (h *AgentHandler) ReportResult(c *gin.Context) {
+func (h *AgentHandler) AckCommands(c *gin.Context) {
 	apiKey := c.GetHeader("X-API-Key")
 	if apiKey == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -215,7 +270,7 @@ func (h *AgentHandler) ReportResult(c *gin.Context) {
 		return
 	}
 
-	var req ReportResultRequest
+	var req AckRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    40004,
@@ -225,15 +280,63 @@ func (h *AgentHandler) ReportResult(c *gin.Context) {
 		return
 	}
 
-	var logContent string
-	if req.Log != "" {
-		decoded, err := base64.StdEncoding.DecodeString(req.Log)
-		if err == nil {
-			logContent = string(decoded)
+	acks := make([]agent.DeliveryAck, len(req.Executions))
+	for i, item := range req.Executions {
+		acks[i] = agent.DeliveryAck{
+			ExecutionID: item.ExecutionID,
+			Attempt:     item.Attempt,
 		}
 	}
 
-	if err := h.service.ReportResult(req.ExecutionID, req.DeviceID, req.Status, req.ExitCode, req.Output, logContent); err != nil {
+	acknowledged, err := h.service.Acknowledge(req.AgentID, acks)
+	if err != nil {
+		if err == agent.ErrAgentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    40010,
+				"message": "设备不存在",
+				"data":    nil,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "确认成功",
+		"data": gin.H{
+			"acknowledged": acknowledged,
+		},
+	})
+}
+
+func (h *AgentHandler) ReportResult(c *gin.Context) {
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    40003,
+			"message": "Missing API key",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req ReportResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := h.service.ReportResult(req.ExecutionID, req.DeviceID, req.Attempt, req.Status, req.ExitCode, req.Output, req.Log, req.LogUploaded, req.StreamSeq, req.ResourceUsage); err != nil {
 		if err == agent.ErrExecutionNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40020,
@@ -242,6 +345,22 @@ func (h *AgentHandler) ReportResult(c *gin.Context) {
 			})
 			return
 		}
+		if err == agent.ErrResultNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40023,
+				"message": "设备不是该命令的执行目标",
+				"data":    nil,
+			})
+			return
+		}
+		if err == log.ErrInvalidLogContent {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40004,
+				"message": "日志内容格式错误",
+				"data":    nil,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50001,
 			"message": "系统异常",
@@ -259,3 +378,144 @@ func (h *AgentHandler) ReportResult(c *gin.Context) {
 		},
 	})
 }
+
+func (h *AgentHandler) UploadResultLog(c *gin.Context) {
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    40003,
+			"message": "Missing API key",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req UploadResultLogRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxLogChunkSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "日志分片过大或读取失败",
+			"data":    nil,
+		})
+		return
+	}
+
+	received, err := h.service.UploadLog(req.ExecutionID, req.DeviceID, req.Attempt, req.Offset, data, req.Final)
+	if err != nil {
+		switch err {
+		case agent.ErrResultNotFound:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40023,
+				"message": "设备不是该命令的执行目标",
+				"data":    nil,
+			})
+		case agent.ErrResultClosed:
+			c.JSON(http.StatusConflict, gin.H{
+				"code":    40026,
+				"message": "执行结果已上报或已结束",
+				"data":    nil,
+			})
+		case log.ErrUploadOffset:
+			c.JSON(http.StatusConflict, gin.H{
+				"code":    40024,
+				"message": "日志分片偏移与已接收大小不一致",
+				"data": gin.H{
+					"received": received,
+				},
+			})
+		case log.ErrInvalidLogContent:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40004,
+				"message": "日志内容无法解压",
+				"data":    nil,
+			})
+		case log.ErrLogTooLarge:
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"code":    40004,
+				"message": "日志超过大小上限",
+				"data":    nil,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    50001,
+				"message": "系统异常",
+				"data":    nil,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "日志上传成功",
+		"data": gin.H{
+			"received": received,
+			"final":    req.Final,
+		},
+	})
+}
+
+func (h *AgentHandler) ReportResultStream(c *gin.Context) {
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    40003,
+			"message": "Missing API key",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req ReportResultStreamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := h.service.AppendOutput(req.ExecutionID, req.DeviceID, req.Attempt, req.Seq, req.Data); err != nil {
+		if err == agent.ErrExecutionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    40020,
+				"message": "命令不存在",
+				"data":    nil,
+			})
+			return
+		}
+		if err == agent.ErrResultNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40023,
+				"message": "设备不是该命令的执行目标",
+				"data":    nil,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "输出上报成功",
+		"data": gin.H{
+			"seq": req.Seq,
+		},
+	})
+}
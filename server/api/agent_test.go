@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHeartbeatClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		proxies string
+		want    string
+	}{
+		{"no trusted proxies", "", "192.0.2.1"},
+		{"untrusted proxy", "10.0.0.0/8", "192.0.2.1"},
+		{"trusted proxy", "10.0.0.0/8, 192.0.2.1", "203.0.113.24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig = &config.Config{FileDir: t.TempDir()}
+			db := testutil.OpenDB(t)
+			db.Create(&models.Device{ID: "dev_1", Name: "web-01", Platform: "linux", OwnerID: 1, Status: models.StatusOnline})
+			db.Create(&models.Agent{ID: "agt_1", DeviceID: "dev_1"})
+
+			router := gin.New()
+			if err := SetupTrustedProxies(router, tt.proxies); err != nil {
+				t.Fatalf("SetupTrustedProxies error: %v", err)
+			}
+			router.POST("/agent/heartbeat", NewAgentHandler().Heartbeat)
+
+			// httptest请求的来源地址为192.0.2.1
+			req := httptest.NewRequest(http.MethodPost, "/agent/heartbeat", strings.NewReader(`{"agent_id":"agt_1"}`))
+			req.Header.Set("X-API-Key", "ak_test")
+			req.Header.Set("X-Forwarded-For", "203.0.113.24")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("heartbeat status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			var device models.Device
+			db.First(&device, "id = ?", "dev_1")
+			if device.IPAddress != tt.want {
+				t.Errorf("ip address = %q, want %q", device.IPAddress, tt.want)
+			}
+		})
+	}
+
+	if err := SetupTrustedProxies(gin.New(), "not-an-ip"); err == nil {
+		t.Error("SetupTrustedProxies accepted an invalid proxy")
+	}
+}
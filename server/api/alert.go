@@ -0,0 +1,345 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/XRSec/Cslite/internal/alert"
+	"github.com/XRSec/Cslite/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+type AlertHandler struct {
+	service *alert.Service
+}
+
+func NewAlertHandler() *AlertHandler {
+	return &AlertHandler{
+		service: alert.NewService(),
+	}
+}
+
+type AlertRuleRequest struct {
+	Name       *string  `json:"name"`
+	Metric     *string  `json:"metric"`
+	Operator   *string  `json:"operator"`
+	Threshold  *float64 `json:"threshold"`
+	Duration   *int     `json:"duration"`
+	Severity   *string  `json:"severity"`
+	TargetType *string  `json:"target_type"`
+	TargetID   *string  `json:"target_id"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+func (r *AlertRuleRequest) input() alert.RuleInput {
+	return alert.RuleInput{
+		Name:       r.Name,
+		Metric:     r.Metric,
+		Operator:   r.Operator,
+		Threshold:  r.Threshold,
+		Duration:   r.Duration,
+		Severity:   r.Severity,
+		TargetType: r.TargetType,
+		TargetID:   r.TargetID,
+		Enabled:    r.Enabled,
+	}
+}
+
+type CreateSilenceRequest struct {
+	RuleID   *uint      `json:"rule_id"`
+	DeviceID string     `json:"device_id" binding:"max=50"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   time.Time  `json:"ends_at" binding:"required"`
+	Comment  string     `json:"comment"`
+}
+
+func (h *AlertHandler) ListRules(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+
+	rules, err := h.service.ListRules(user.ID, user.IsAdmin())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data": gin.H{
+			"rules": rules,
+		},
+	})
+}
+
+func (h *AlertHandler) CreateRule(c *gin.Context) {
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	rule, err := h.service.CreateRule(user.ID, user.IsAdmin(), req.input())
+	if err != nil {
+		respondAlertError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    20000,
+		"message": "告警规则创建成功",
+		"data":    rule,
+	})
+}
+
+func (h *AlertHandler) UpdateRule(c *gin.Context) {
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	rule, err := h.service.UpdateRule(uint(ruleID), user.ID, user.IsAdmin(), req.input())
+	if err != nil {
+		respondAlertError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "告警规则更新成功",
+		"data":    rule,
+	})
+}
+
+func (h *AlertHandler) DeleteRule(c *gin.Context) {
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	if err := h.service.DeleteRule(uint(ruleID), user.ID, user.IsAdmin()); err != nil {
+		respondAlertError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "告警规则删除成功",
+		"data": gin.H{
+			"deleted_at": time.Now().Format(time.RFC3339),
+		},
+	})
+}
+
+func (h *AlertHandler) ListAlerts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	filters := make(map[string]interface{})
+	if status := c.Query("status"); status != "" {
+		filters["status"] = status
+	}
+	if ruleStr := c.Query("rule_id"); ruleStr != "" {
+		if ruleID, err := strconv.ParseUint(ruleStr, 10, 32); err == nil {
+			filters["rule_id"] = uint(ruleID)
+		}
+	}
+	if deviceID := c.Query("device_id"); deviceID != "" {
+		filters["device_id"] = deviceID
+	}
+	if severity := c.Query("severity"); severity != "" {
+		filters["severity"] = severity
+	}
+
+	alerts, total, err := h.service.ListAlerts(user.ID, user.IsAdmin(), page, limit, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data": gin.H{
+			"total":    total,
+			"page":     page,
+			"per_page": limit,
+			"alerts":   alerts,
+		},
+	})
+}
+
+func (h *AlertHandler) ListSilences(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+
+	silences, err := h.service.ListSilences(user.ID, user.IsAdmin())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data": gin.H{
+			"silences": silences,
+		},
+	})
+}
+
+func (h *AlertHandler) CreateSilence(c *gin.Context) {
+	var req CreateSilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	silence, err := h.service.CreateSilence(user.ID, user.IsAdmin(), alert.SilenceInput{
+		RuleID:   req.RuleID,
+		DeviceID: req.DeviceID,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		Comment:  req.Comment,
+	})
+	if err != nil {
+		respondAlertError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    20000,
+		"message": "静默创建成功",
+		"data":    silence,
+	})
+}
+
+func (h *AlertHandler) DeleteSilence(c *gin.Context) {
+	silenceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	if err := h.service.DeleteSilence(uint(silenceID), user.ID, user.IsAdmin()); err != nil {
+		respondAlertError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "静默删除成功",
+		"data": gin.H{
+			"deleted_at": time.Now().Format(time.RFC3339),
+		},
+	})
+}
+
+func respondAlertError(c *gin.Context, err error) {
+	switch err {
+	case alert.ErrInvalidRule:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "告警规则不合法",
+			"data":    nil,
+		})
+	case alert.ErrInvalidSilence:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "静默参数不合法",
+			"data":    nil,
+		})
+	case alert.ErrGroupNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40030,
+			"message": "群组不存在",
+			"data":    nil,
+		})
+	case alert.ErrDeviceNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40010,
+			"message": "设备不存在",
+			"data":    nil,
+		})
+	case alert.ErrRuleNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40040,
+			"message": "告警规则不存在",
+			"data":    nil,
+		})
+	case alert.ErrSilenceNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40041,
+			"message": "静默不存在",
+			"data":    nil,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+	}
+}
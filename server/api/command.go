@@ -2,10 +2,14 @@ package api
 
 import (
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/XRSec/Cslite/internal/command"
+	"github.com/XRSec/Cslite/internal/notification"
+	"github.com/XRSec/Cslite/internal/scheduler"
 	"github.com/XRSec/Cslite/middleware"
 	"github.com/XRSec/Cslite/models"
 	"github.com/gin-gonic/gin"
@@ -22,15 +26,49 @@ func NewCommandHandler() *CommandHandler {
 }
 
 type CreateCommandRequest struct {
-	Name        string              `json:"name" binding:"required,min=1,max=100"`
-	Type        string              `json:"type" binding:"required,oneof=once cron immediate"`
-	Schedule    string              `json:"schedule"`
-	Content     string              `json:"content" binding:"required"`
-	TargetType  string              `json:"target_type" binding:"required,oneof=devices groups"`
-	TargetIDs   []string            `json:"target_ids" binding:"required,min=1"`
-	Timeout     int                 `json:"timeout" binding:"min=1,max=86400"`
-	RetryPolicy *models.RetryPolicy `json:"retry_policy"`
-	EnvVars     map[string]string   `json:"env_vars"`
+	Name           string                 `json:"name" binding:"required,min=1,max=100"`
+	Type           string                 `json:"type" binding:"required,oneof=once cron immediate"`
+	Schedule       string                 `json:"schedule"`
+	Interpreter    string                 `json:"interpreter" binding:"omitempty,oneof=sh bash python powershell cmd exec"`
+	Content        string                 `json:"content"`
+	Script         string                 `json:"script"`
+	Args           []string               `json:"args"`
+	RunAs          string                 `json:"run_as" binding:"max=64"`
+	RunAsGroup     string                 `json:"run_as_group" binding:"max=64"`
+	WorkingDir     string                 `json:"working_dir" binding:"max=255"`
+	Umask          string                 `json:"umask"`
+	TargetType     string                 `json:"target_type" binding:"required,oneof=devices groups"`
+	TargetIDs      []string               `json:"target_ids" binding:"required,min=1"`
+	Timeout        int                    `json:"timeout" binding:"min=1,max=86400"`
+	RetryPolicy    *models.RetryPolicy    `json:"retry_policy"`
+	EnvVars        map[string]string      `json:"env_vars"`
+	Concurrency    int                    `json:"concurrency" binding:"min=0"`
+	LockKey        string                 `json:"lock_key" binding:"max=100"`
+	ResourceLimits *models.ResourceLimits `json:"resource_limits"`
+	NotifyOn       string                 `json:"notify_on" binding:"omitempty,oneof=failure success always"`
+	NotifyChannels []uint                 `json:"notify_channels" binding:"max=10"`
+}
+
+var (
+	accountPattern      = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.-]*\$?|[0-9]+)$`)
+	absolutePathPattern = regexp.MustCompile(`^(/|[A-Za-z]:[\\/])`)
+	umaskPattern        = regexp.MustCompile(`^0?[0-7]{3}$`)
+	envNamePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// validAccount 校验执行用户或用户组，为空表示不切换
+func validAccount(name string) bool {
+	return name == "" || accountPattern.MatchString(name)
+}
+
+// validEnvVars 校验环境变量名，CSLITE_前缀保留给Agent注入的执行信息
+func validEnvVars(envVars map[string]string) bool {
+	for name := range envVars {
+		if !envNamePattern.MatchString(name) || strings.HasPrefix(strings.ToUpper(name), "CSLITE_") {
+			return false
+		}
+	}
+	return true
 }
 
 type UpdateCommandStatusRequest struct {
@@ -48,8 +86,8 @@ func (h *CommandHandler) CreateCommand(c *gin.Context) {
 		return
 	}
 
-	// 验证cron类型必须有schedule
-	if req.Type == models.CommandTypeCron && req.Schedule == "" {
+	// 验证cron类型必须有合法的schedule，once类型的schedule须为RFC3339时间
+	if (req.Type == models.CommandTypeCron && req.Schedule == "") || scheduler.ValidateSchedule(req.Type, req.Schedule) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    60002,
 			"message": "cron 表达式非法或不合理",
@@ -58,18 +96,94 @@ func (h *CommandHandler) CreateCommand(c *gin.Context) {
 		return
 	}
 
+	// 验证命令内容：exec解释器必须指定可执行文件且不能带脚本，其余解释器需提供命令或脚本
+	if (req.Interpreter == models.InterpreterExec && (req.Content == "" || req.Script != "")) ||
+		(req.Content == "" && req.Script == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "命令内容缺失或与解释器不匹配",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 验证执行身份与环境：用户/组为名称或数字ID，工作目录为绝对路径，umask为三位八进制
+	if !validAccount(req.RunAs) || !validAccount(req.RunAsGroup) ||
+		(req.WorkingDir != "" && !absolutePathPattern.MatchString(req.WorkingDir)) ||
+		(req.Umask != "" && !umaskPattern.MatchString(req.Umask)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "执行用户、工作目录或 umask 不合法",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 验证环境变量名
+	if !validEnvVars(req.EnvVars) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "环境变量名不合法",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 验证资源限制：各项不能为负，IO权重不超过10000
+	if req.ResourceLimits != nil && !req.ResourceLimits.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "资源限制不合法",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 验证重试策略：最多执行10次，退避参数不能为负
+	if p := req.RetryPolicy; p != nil && p.Enabled &&
+		(p.MaxAttempts < 1 || p.MaxAttempts > 10 || p.BackoffSeconds < 0 || p.BackoffMultiplier < 0 || p.MaxBackoffSeconds < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40008,
+			"message": "重试策略不合法",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 指定通知渠道时须同时指定通知时机
+	if len(req.NotifyChannels) > 0 && req.NotifyOn == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "指定通知渠道时需设置 notify_on",
+			"data":    nil,
+		})
+		return
+	}
+
 	user := middleware.GetCurrentUser(c)
 
 	input := &command.CreateCommandInput{
-		Name:        req.Name,
-		Type:        req.Type,
-		Schedule:    req.Schedule,
-		Content:     req.Content,
-		TargetType:  req.TargetType,
-		TargetIDs:   req.TargetIDs,
-		Timeout:     req.Timeout,
-		RetryPolicy: req.RetryPolicy,
-		EnvVars:     req.EnvVars,
+		Name:           req.Name,
+		Type:           req.Type,
+		Schedule:       req.Schedule,
+		Interpreter:    req.Interpreter,
+		Content:        req.Content,
+		Script:         req.Script,
+		Args:           req.Args,
+		RunAs:          req.RunAs,
+		RunAsGroup:     req.RunAsGroup,
+		WorkingDir:     req.WorkingDir,
+		Umask:          req.Umask,
+		TargetType:     req.TargetType,
+		TargetIDs:      req.TargetIDs,
+		Timeout:        req.Timeout,
+		RetryPolicy:    req.RetryPolicy,
+		EnvVars:        req.EnvVars,
+		Concurrency:    req.Concurrency,
+		LockKey:        req.LockKey,
+		ResourceLimits: req.ResourceLimits,
+		NotifyOn:       req.NotifyOn,
+		NotifyChannels: req.NotifyChannels,
 	}
 
 	if input.Timeout == 0 {
@@ -78,6 +192,30 @@ func (h *CommandHandler) CreateCommand(c *gin.Context) {
 
 	cmd, err := h.service.CreateCommand(user.ID, input)
 	if err != nil {
+		if err == command.ErrInvalidCronExpression {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    60002,
+				"message": "cron 表达式非法或不合理",
+				"data":    nil,
+			})
+			return
+		}
+		if err == command.ErrNoTargets {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    60009,
+				"message": "没有可执行的目标设备",
+				"data":    nil,
+			})
+			return
+		}
+		if err == notification.ErrChannelNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    40043,
+				"message": "通知渠道不存在",
+				"data":    nil,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50001,
 			"message": "系统异常",
@@ -91,10 +229,10 @@ func (h *CommandHandler) CreateCommand(c *gin.Context) {
 		"created_at": cmd.CreatedAt.Format(time.RFC3339),
 	}
 
-	// 如果是cron类型，返回下次执行时间（供客户端参考）
-	// if cmd.NextRun != nil {
-	// 	response["next_run"] = cmd.NextRun.Format(time.RFC3339)
-	// }
+	// 定时命令返回下次执行时间
+	if cmd.NextRun != nil {
+		response["next_run"] = cmd.NextRun.Format(time.RFC3339)
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"code":    20000,
@@ -151,10 +289,10 @@ func (h *CommandHandler) ListCommands(c *gin.Context) {
 			"status":     cmd.Status,
 			"created_at": cmd.CreatedAt.Format(time.RFC3339),
 		}
-		// 如果是cron类型，返回下次执行时间（供客户端参考）
-		// if cmd.NextRun != nil {
-		// 	item["next_run"] = cmd.NextRun.Format(time.RFC3339)
-		// }
+		// 定时命令返回下次执行时间
+		if cmd.NextRun != nil {
+			item["next_run"] = cmd.NextRun.Format(time.RFC3339)
+		}
 		commandList[i] = item
 	}
 
@@ -209,10 +347,14 @@ func (h *CommandHandler) GetCommand(c *gin.Context) {
 		"execution_history": executionHistory,
 	}
 
-	// 如果是cron类型，返回下次执行时间（供客户端参考）
-	// if cmd.NextRun != nil {
-	// 	response["next_run"] = cmd.NextRun.Format(time.RFC3339)
-	// }
+	if cmd.LastRun != nil {
+		response["last_run"] = cmd.LastRun.Format(time.RFC3339)
+	}
+
+	// 定时命令返回下次执行时间
+	if cmd.NextRun != nil {
+		response["next_run"] = cmd.NextRun.Format(time.RFC3339)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    20000,
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/middleware"
+	"github.com/XRSec/Cslite/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newCommandRouter 创建只挂载创建命令接口的路由，以管理员身份访问，预置在线设备dev_1
+func newCommandRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{FileDir: t.TempDir()}
+	db := testutil.OpenDB(t)
+
+	admin := &models.User{ID: 1, Username: "admin", Password: "x", Role: models.RoleAdmin}
+	db.Create(admin)
+	db.Create(&models.Device{ID: "dev_1", Name: "web-01", Platform: "linux", OwnerID: 1, Status: models.StatusOnline})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(middleware.UserCtxKey, admin) })
+	router.POST("/commands", NewCommandHandler().CreateCommand)
+	return router, db
+}
+
+// postCommand 在基础请求上覆盖fields后创建命令，返回HTTP状态码、业务码与命令ID
+func postCommand(t *testing.T, router *gin.Engine, fields map[string]interface{}) (int, int, string) {
+	t.Helper()
+	body := map[string]interface{}{
+		"name":        "uptime",
+		"type":        models.CommandTypeImmediate,
+		"content":     "uptime",
+		"target_type": models.TargetTypeDevices,
+		"target_ids":  []string{"dev_1"},
+		"timeout":     60,
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(body, key)
+			continue
+		}
+		body[key] = value
+	}
+	data, _ := json.Marshal(body)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/commands", bytes.NewReader(data)))
+
+	var resp struct {
+		Code int `json:"code"`
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp.Code, resp.Data.ID
+}
+
+type commandCase struct {
+	name   string
+	fields map[string]interface{}
+	status int
+	code   int
+}
+
+func runCommandCases(t *testing.T, router *gin.Engine, cases []commandCase) {
+	t.Helper()
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code, _ := postCommand(t, router, tt.fields)
+			if status != tt.status || code != tt.code {
+				t.Errorf("status = %d, code = %d, want %d, %d", status, code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestCreateCommandInterpreter(t *testing.T) {
+	router, db := newCommandRouter(t)
+
+	runCommandCases(t, router, []commandCase{
+		{"default shell", nil, http.StatusCreated, 20000},
+		{"python script", map[string]interface{}{"interpreter": "python", "content": nil, "script": "print(1)\nprint(2)\n"}, http.StatusCreated, 20000},
+		{"unknown interpreter", map[string]interface{}{"interpreter": "perl"}, http.StatusBadRequest, 40004},
+		{"no content or script", map[string]interface{}{"content": nil}, http.StatusBadRequest, 40004},
+		{"exec without path", map[string]interface{}{"interpreter": "exec", "content": nil, "script": "echo 1"}, http.StatusBadRequest, 40004},
+		{"exec with script", map[string]interface{}{"interpreter": "exec", "content": "/usr/bin/env", "script": "echo 1"}, http.StatusBadRequest, 40004},
+	})
+
+	// 参数列表原样保存
+	status, _, id := postCommand(t, router, map[string]interface{}{"interpreter": "exec", "content": "/usr/bin/printf", "args": []string{"%s\n", "a b"}})
+	if status != http.StatusCreated {
+		t.Fatalf("create exec command status = %d", status)
+	}
+	var command models.Command
+	db.First(&command, "id = ?", id)
+	var args []string
+	json.Unmarshal(command.Args, &args)
+	if command.Interpreter != models.InterpreterExec || len(args) != 2 || args[1] != "a b" {
+		t.Errorf("interpreter = %s, args = %q", command.Interpreter, args)
+	}
+}
+
+func TestCreateCommandRunAs(t *testing.T) {
+	router, _ := newCommandRouter(t)
+
+	runCommandCases(t, router, []commandCase{
+		{"user and group", map[string]interface{}{"run_as": "deploy", "run_as_group": "www-data"}, http.StatusCreated, 20000},
+		{"numeric ids", map[string]interface{}{"run_as": "1001", "run_as_group": "1001"}, http.StatusCreated, 20000},
+		{"windows path", map[string]interface{}{"working_dir": `C:\srv\app`}, http.StatusCreated, 20000},
+		{"umask", map[string]interface{}{"working_dir": "/srv/app", "umask": "0027"}, http.StatusCreated, 20000},
+		{"invalid user", map[string]interface{}{"run_as": "root; id"}, http.StatusBadRequest, 40004},
+		{"invalid group", map[string]interface{}{"run_as_group": "-g"}, http.StatusBadRequest, 40004},
+		{"relative working dir", map[string]interface{}{"working_dir": "srv/app"}, http.StatusBadRequest, 40004},
+		{"non octal umask", map[string]interface{}{"umask": "089"}, http.StatusBadRequest, 40004},
+		{"long umask", map[string]interface{}{"umask": "00022"}, http.StatusBadRequest, 40004},
+	})
+}
+
+func TestCreateCommandResourceLimits(t *testing.T) {
+	router, db := newCommandRouter(t)
+
+	runCommandCases(t, router, []commandCase{
+		{"negative memory", map[string]interface{}{"resource_limits": map[string]int{"memory_max_mb": -1}}, http.StatusBadRequest, 40004},
+		{"io weight too large", map[string]interface{}{"resource_limits": map[string]int{"io_weight": 10001}}, http.StatusBadRequest, 40004},
+	})
+
+	// 全部为0时视为不限制，不保存
+	_, _, id := postCommand(t, router, map[string]interface{}{"resource_limits": map[string]int{"memory_max_mb": 0}})
+	var command models.Command
+	db.First(&command, "id = ?", id)
+	if command.ResourceLimits != nil {
+		t.Errorf("zero limits saved as %s", command.ResourceLimits)
+	}
+
+	_, _, id = postCommand(t, router, map[string]interface{}{"resource_limits": map[string]int{"memory_max_mb": 512, "cpu_percent": 150, "pids_max": 64}})
+	var limited models.Command
+	db.First(&limited, "id = ?", id)
+	var limits models.ResourceLimits
+	json.Unmarshal(limited.ResourceLimits, &limits)
+	if limits.MemoryMaxMB != 512 || limits.CPUPercent != 150 || limits.PidsMax != 64 {
+		t.Errorf("limits = %+v", limits)
+	}
+}
+
+func TestCreateCommandEnvVars(t *testing.T) {
+	router, _ := newCommandRouter(t)
+
+	runCommandCases(t, router, []commandCase{
+		{"valid names", map[string]interface{}{"env_vars": map[string]string{"DEBIAN_FRONTEND": "noninteractive", "_x1": ""}}, http.StatusCreated, 20000},
+		{"leading digit", map[string]interface{}{"env_vars": map[string]string{"1PATH": "x"}}, http.StatusBadRequest, 40004},
+		{"invalid character", map[string]interface{}{"env_vars": map[string]string{"A=B": "x"}}, http.StatusBadRequest, 40004},
+		{"reserved prefix", map[string]interface{}{"env_vars": map[string]string{"cslite_command_id": "x"}}, http.StatusBadRequest, 40004},
+	})
+}
@@ -1,22 +1,26 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/XRSec/Cslite/internal/device"
+	"github.com/XRSec/Cslite/internal/metrics"
 	"github.com/XRSec/Cslite/middleware"
 	"github.com/gin-gonic/gin"
 )
 
 type DeviceHandler struct {
 	service *device.Service
+	metrics *metrics.Service
 }
 
 func NewDeviceHandler() *DeviceHandler {
 	return &DeviceHandler{
 		service: device.NewService(),
+		metrics: metrics.NewService(),
 	}
 }
 
@@ -25,6 +29,13 @@ type CreateDeviceRequest struct {
 	Platform string `json:"platform" binding:"required"`
 }
 
+type UpdateDeviceRequest struct {
+	Name           *string `json:"name" binding:"omitempty,min=1,max=100"`
+	MaxConcurrency *int    `json:"max_concurrency" binding:"omitempty,min=0,max=64"`
+
+	EnvVars map[string]string `json:"env_vars"`
+}
+
 type DeleteDevicesRequest struct {
 	IDs []string `json:"ids" binding:"required,min=1"`
 }
@@ -102,14 +113,15 @@ func (h *DeviceHandler) ListDevices(c *gin.Context) {
 	deviceList := make([]gin.H, len(devices))
 	for i, device := range devices {
 		deviceList[i] = gin.H{
-			"id":         device.ID,
-			"name":       device.Name,
-			"platform":   device.Platform,
-			"status":     device.Status,
-			"owner_id":   device.OwnerID,
-			"group_id":   device.GroupID,
-			"last_seen":  device.LastSeen.Format(time.RFC3339),
-			"ip_address": device.IPAddress,
+			"id":              device.ID,
+			"name":            device.Name,
+			"platform":        device.Platform,
+			"status":          device.Status,
+			"owner_id":        device.OwnerID,
+			"group_id":        device.GroupID,
+			"last_seen":       device.LastSeen.Format(time.RFC3339),
+			"ip_address":      device.IPAddress,
+			"max_concurrency": device.MaxConcurrency,
 		}
 	}
 
@@ -139,25 +151,81 @@ func (h *DeviceHandler) GetDevice(c *gin.Context) {
 		return
 	}
 
-	metrics := gin.H{
-		"cpu_usage":   15.3,
-		"memory_used": 2048,
-		"disk_usage":  45.2,
+	metrics, err := h.service.GetDeviceMetrics(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    20000,
 		"message": "获取成功",
 		"data": gin.H{
-			"id":         device.ID,
-			"name":       device.Name,
-			"platform":   device.Platform,
-			"status":     device.Status,
-			"metrics":    metrics,
-			"owner_id":   device.OwnerID,
-			"group_id":   device.GroupID,
-			"created_at": device.CreatedAt.Format(time.RFC3339),
-			"last_seen":  device.LastSeen.Format(time.RFC3339),
+			"id":                 device.ID,
+			"name":               device.Name,
+			"platform":           device.Platform,
+			"status":             device.Status,
+			"metrics":            metrics.Values,
+			"metrics_updated_at": metrics.UpdatedAt,
+			"metrics_stale":      metrics.Stale,
+			"ip_address":         device.IPAddress,
+			"owner_id":           device.OwnerID,
+			"group_id":           device.GroupID,
+			"created_at":         device.CreatedAt.Format(time.RFC3339),
+			"last_seen":          device.LastSeen.Format(time.RFC3339),
+			"max_concurrency":    device.MaxConcurrency,
+			"env_vars":           device.EnvVars,
+		},
+	})
+}
+
+func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var req UpdateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	if !validEnvVars(req.EnvVars) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "环境变量名不合法",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	device, err := h.service.UpdateDevice(deviceID, user.ID, user.IsAdmin(), req.Name, req.MaxConcurrency, req.EnvVars)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40005,
+			"message": "设备不存在",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "更新成功",
+		"data": gin.H{
+			"id":              device.ID,
+			"name":            device.Name,
+			"max_concurrency": device.MaxConcurrency,
+			"env_vars":        device.EnvVars,
+			"updated_at":      device.UpdatedAt.Format(time.RFC3339),
 		},
 	})
 }
@@ -221,3 +289,74 @@ func (h *DeviceHandler) GetDeviceStatus(c *gin.Context) {
 		"data":    status,
 	})
 }
+
+// GetDeviceMetrics 查询设备指标历史，from/to支持RFC3339或Unix秒，默认最近1小时；step支持时长（如5m）或秒数
+func (h *DeviceHandler) GetDeviceMetrics(c *gin.Context) {
+	deviceID := c.Param("id")
+	user := middleware.GetCurrentUser(c)
+
+	if _, err := h.service.GetDevice(deviceID, user.ID, user.IsAdmin()); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40005,
+			"message": "设备不存在",
+			"data":    nil,
+		})
+		return
+	}
+
+	to, toErr := parseMetricsTime(c.Query("to"), time.Now())
+	from, fromErr := parseMetricsTime(c.Query("from"), to.Add(-time.Hour))
+	step, stepErr := parseMetricsStep(c.Query("step"))
+	if toErr != nil || fromErr != nil || stepErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	series, err := h.metrics.Query(deviceID, from, to, step)
+	if err != nil {
+		if errors.Is(err, metrics.ErrInvalidRange) || errors.Is(err, metrics.ErrInvalidStep) || errors.Is(err, metrics.ErrTooManyPoints) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40004,
+				"message": "时间范围或步长不合法",
+				"data":    nil,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data":    series,
+	})
+}
+
+func parseMetricsTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseMetricsStep(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
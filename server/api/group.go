@@ -24,6 +24,12 @@ type CreateGroupRequest struct {
 	Description string `json:"description" binding:"max=500"`
 }
 
+type UpdateGroupRequest struct {
+	Name        *string           `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string           `json:"description" binding:"omitempty,max=500"`
+	EnvVars     map[string]string `json:"env_vars"`
+}
+
 type AddDevicesRequest struct {
 	DeviceIDs []string `json:"device_ids" binding:"required,min=1"`
 }
@@ -81,6 +87,7 @@ func (h *GroupHandler) ListGroups(c *gin.Context) {
 			"name":         group.Name,
 			"description":  group.Description,
 			"device_count": len(group.Devices),
+			"env_vars":     group.EnvVars,
 			"created_at":   group.CreatedAt.Format(time.RFC3339),
 		}
 	}
@@ -92,6 +99,53 @@ func (h *GroupHandler) ListGroups(c *gin.Context) {
 	})
 }
 
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	groupID := c.Param("id")
+
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	if !validEnvVars(req.EnvVars) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "环境变量名不合法",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	group, err := h.service.UpdateGroup(groupID, user.ID, user.IsAdmin(), req.Name, req.Description, req.EnvVars)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40005,
+			"message": "群组不存在",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "更新成功",
+		"data": gin.H{
+			"id":          group.ID,
+			"name":        group.Name,
+			"description": group.Description,
+			"env_vars":    group.EnvVars,
+			"updated_at":  group.UpdatedAt.Format(time.RFC3339),
+		},
+	})
+}
+
 func (h *GroupHandler) AddDevicesToGroup(c *gin.Context) {
 	groupID := c.Param("id")
 
@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/XRSec/Cslite/internal/log"
 	"github.com/XRSec/Cslite/middleware"
@@ -85,10 +86,36 @@ func (h *LogHandler) GetDeviceLogs(c *gin.Context) {
 		limit = 20
 	}
 
-	logType := c.Query("type")
+	from, fromErr := parseMetricsTime(c.Query("from"), time.Time{})
+	to, toErr := parseMetricsTime(c.Query("to"), time.Time{})
+	if fromErr != nil || toErr != nil || (!from.IsZero() && !to.IsZero() && from.After(to)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "时间范围不合法",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
 
-	logs, total, err := h.service.GetDeviceLogs(deviceID, logType, page, limit)
+	filter := log.DeviceLogFilter{
+		DeviceID: deviceID,
+		Type:     c.Query("type"),
+		From:     from,
+		To:       to,
+	}
+
+	logs, total, err := h.service.GetDeviceLogs(user.ID, user.IsAdmin(), filter, page, limit)
 	if err != nil {
+		if err == log.ErrDeviceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    40010,
+				"message": "设备不存在",
+				"data":    nil,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50001,
 			"message": "系统异常",
@@ -101,8 +128,10 @@ func (h *LogHandler) GetDeviceLogs(c *gin.Context) {
 		"code":    20000,
 		"message": "获取成功",
 		"data": gin.H{
-			"total": total,
-			"logs":  logs,
+			"total":    total,
+			"page":     page,
+			"per_page": limit,
+			"logs":     logs,
 		},
 	})
 }
@@ -161,9 +190,9 @@ func (h *LogHandler) DownloadLog(c *gin.Context) {
 		return
 	}
 
-	file, err := h.service.DownloadLog(logID)
+	file, err := h.service.DownloadLog(logID, user.ID, user.IsAdmin())
 	if err != nil {
-		if err == log.ErrLogNotFound {
+		if err == log.ErrLogNotFound || err == log.ErrInvalidLogID {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40005,
 				"message": "日志不存在或权限不足",
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/XRSec/Cslite/internal/notification"
+	"github.com/XRSec/Cslite/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationHandler struct {
+	service *notification.Service
+}
+
+func NewNotificationHandler() *NotificationHandler {
+	return &NotificationHandler{
+		service: notification.NewService(),
+	}
+}
+
+type NotificationChannelRequest struct {
+	Name     *string `json:"name"`
+	Type     *string `json:"type"`
+	Target   *string `json:"target"`
+	Secret   *string `json:"secret"`
+	Template *string `json:"template"`
+	Enabled  *bool   `json:"enabled"`
+}
+
+func (r *NotificationChannelRequest) input() notification.ChannelInput {
+	return notification.ChannelInput{
+		Name:     r.Name,
+		Type:     r.Type,
+		Target:   r.Target,
+		Secret:   r.Secret,
+		Template: r.Template,
+		Enabled:  r.Enabled,
+	}
+}
+
+func (h *NotificationHandler) ListChannels(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+
+	channels, err := h.service.ListChannels(user.ID, user.IsAdmin())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data": gin.H{
+			"channels": channels,
+		},
+	})
+}
+
+func (h *NotificationHandler) CreateChannel(c *gin.Context) {
+	var req NotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	channel, err := h.service.CreateChannel(user.ID, req.input())
+	if err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    20000,
+		"message": "通知渠道创建成功",
+		"data":    channel,
+	})
+}
+
+func (h *NotificationHandler) UpdateChannel(c *gin.Context) {
+	channelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req NotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	channel, err := h.service.UpdateChannel(uint(channelID), user.ID, user.IsAdmin(), req.input())
+	if err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "通知渠道更新成功",
+		"data":    channel,
+	})
+}
+
+func (h *NotificationHandler) DeleteChannel(c *gin.Context) {
+	channelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	if err := h.service.DeleteChannel(uint(channelID), user.ID, user.IsAdmin()); err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "通知渠道删除成功",
+		"data": gin.H{
+			"deleted_at": time.Now().Format(time.RFC3339),
+		},
+	})
+}
+
+func (h *NotificationHandler) TestChannel(c *gin.Context) {
+	channelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	if err := h.service.Test(uint(channelID), user.ID, user.IsAdmin()); err != nil {
+		switch err {
+		case notification.ErrChannelNotFound:
+			respondNotificationError(c, err)
+		case notification.ErrSMTPNotConfigured, notification.ErrNoRecipients:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40004,
+				"message": "未配置SMTP服务器或收件人",
+				"data":    nil,
+			})
+		default:
+			c.JSON(http.StatusBadGateway, gin.H{
+				"code":    50002,
+				"message": "通知发送失败",
+				"data": gin.H{
+					"error": err.Error(),
+				},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "测试通知已发送",
+		"data": gin.H{
+			"sent_at": time.Now().Format(time.RFC3339),
+		},
+	})
+}
+
+func respondNotificationError(c *gin.Context, err error) {
+	switch err {
+	case notification.ErrInvalidChannel:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "通知渠道参数不合法",
+			"data":    nil,
+		})
+	case notification.ErrChannelNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40043,
+			"message": "通知渠道不存在",
+			"data":    nil,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/XRSec/Cslite/internal/retention"
+	"github.com/XRSec/Cslite/middleware"
+	"github.com/XRSec/Cslite/models"
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionHandler struct {
+	service *retention.Service
+}
+
+func NewRetentionHandler() *RetentionHandler {
+	return &RetentionHandler{
+		service: retention.NewService(),
+	}
+}
+
+type RetentionRuleRequest struct {
+	GroupID        string `json:"group_id"`
+	MaxAgeDays     *int   `json:"max_age_days" binding:"omitempty,min=0"`
+	MaxTotalSizeMB *int64 `json:"max_total_size_mb" binding:"omitempty,min=0"`
+	KeepLast       *int   `json:"keep_last" binding:"omitempty,min=0"`
+	Enabled        *bool  `json:"enabled"`
+}
+
+func (r *RetentionRuleRequest) input() retention.RuleInput {
+	return retention.RuleInput{
+		MaxAgeDays:     r.MaxAgeDays,
+		MaxTotalSizeMB: r.MaxTotalSizeMB,
+		KeepLast:       r.KeepLast,
+		Enabled:        r.Enabled,
+	}
+}
+
+func (h *RetentionHandler) ListRules(c *gin.Context) {
+	rules, err := h.service.ListRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	ruleList := make([]gin.H, len(rules))
+	for i, rule := range rules {
+		ruleList[i] = retentionRuleResponse(rule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data": gin.H{
+			"default": h.service.GlobalPolicy(),
+			"rules":   ruleList,
+		},
+	})
+}
+
+func (h *RetentionHandler) CreateRule(c *gin.Context) {
+	var req RetentionRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.GroupID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	rule, err := h.service.CreateRule(user.ID, req.GroupID, req.input())
+	if err != nil {
+		switch err {
+		case retention.ErrInvalidRule:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40004,
+				"message": "参数缺失或格式错误",
+				"data":    nil,
+			})
+		case retention.ErrGroupNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    40030,
+				"message": "群组不存在",
+				"data":    nil,
+			})
+		case retention.ErrRuleExists:
+			c.JSON(http.StatusConflict, gin.H{
+				"code":    40009,
+				"message": "该群组已存在保留规则",
+				"data":    nil,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    50001,
+				"message": "系统异常",
+				"data":    nil,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    20000,
+		"message": "保留规则创建成功",
+		"data":    retentionRuleResponse(rule),
+	})
+}
+
+func (h *RetentionHandler) UpdateRule(c *gin.Context) {
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req RetentionRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	rule, err := h.service.UpdateRule(uint(ruleID), req.input())
+	if err != nil {
+		switch err {
+		case retention.ErrInvalidRule:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40004,
+				"message": "参数缺失或格式错误",
+				"data":    nil,
+			})
+		case retention.ErrRuleNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    40005,
+				"message": "保留规则不存在",
+				"data":    nil,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    50001,
+				"message": "系统异常",
+				"data":    nil,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "保留规则更新成功",
+		"data":    retentionRuleResponse(rule),
+	})
+}
+
+func (h *RetentionHandler) DeleteRule(c *gin.Context) {
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := h.service.DeleteRule(uint(ruleID)); err != nil {
+		if err == retention.ErrRuleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    40005,
+				"message": "保留规则不存在",
+				"data":    nil,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "保留规则删除成功",
+		"data": gin.H{
+			"deleted_at": time.Now().Format(time.RFC3339),
+		},
+	})
+}
+
+// GetReport 试运行保留策略，返回将被清理的执行结果与日志
+func (h *RetentionHandler) GetReport(c *gin.Context) {
+	report, err := h.service.Plan()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data":    report,
+	})
+}
+
+func retentionRuleResponse(rule *models.RetentionRule) gin.H {
+	return gin.H{
+		"id":                rule.ID,
+		"group_id":          rule.GroupID,
+		"max_age_days":      rule.MaxAgeDays,
+		"max_total_size_mb": rule.MaxTotalSizeMB,
+		"keep_last":         rule.KeepLast,
+		"enabled":           rule.Enabled,
+		"created_at":        rule.CreatedAt.Format(time.RFC3339),
+		"updated_at":        rule.UpdatedAt.Format(time.RFC3339),
+	}
+}
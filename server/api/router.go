@@ -9,6 +9,17 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// SetupTrustedProxies 设置信任的反向代理（逗号分隔的地址或网段），只有来自这些地址的请求才从X-Forwarded-For读取客户端IP
+func SetupTrustedProxies(router *gin.Engine, proxies string) error {
+	var trusted []string
+	for _, proxy := range strings.Split(proxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trusted = append(trusted, proxy)
+		}
+	}
+	return router.SetTrustedProxies(trusted)
+}
+
 // SetupRoutes 设置所有API路由
 func SetupRoutes(router *gin.Engine) {
 	// 健康检查端点
@@ -82,11 +93,13 @@ func SetupRoutes(router *gin.Engine) {
 	devicesGroup := api.Group("/devices")
 	devicesGroup.Use(middleware.AuthRequired()) // 需要认证
 	{
-		devicesGroup.POST("", deviceHandler.CreateDevice)          // 创建设备
-		devicesGroup.GET("", deviceHandler.ListDevices)            // 列出设备
-		devicesGroup.GET("/:id", deviceHandler.GetDevice)          // 获取设备详情
-		devicesGroup.DELETE("", deviceHandler.DeleteDevices)       // 删除设备
-		devicesGroup.GET("/status", deviceHandler.GetDeviceStatus) // 获取设备状态
+		devicesGroup.POST("", deviceHandler.CreateDevice)                // 创建设备
+		devicesGroup.GET("", deviceHandler.ListDevices)                  // 列出设备
+		devicesGroup.GET("/:id", deviceHandler.GetDevice)                // 获取设备详情
+		devicesGroup.PUT("/:id", deviceHandler.UpdateDevice)             // 更新设备设置
+		devicesGroup.GET("/:id/metrics", deviceHandler.GetDeviceMetrics) // 查询设备指标历史
+		devicesGroup.DELETE("", deviceHandler.DeleteDevices)             // 删除设备
+		devicesGroup.GET("/status", deviceHandler.GetDeviceStatus)       // 获取设备状态
 	}
 
 	// 分组管理路由
@@ -97,6 +110,7 @@ func SetupRoutes(router *gin.Engine) {
 	{
 		groupsGroup.POST("", groupHandler.CreateGroup)                  // 创建分组
 		groupsGroup.GET("", groupHandler.ListGroups)                    // 列出分组
+		groupsGroup.PUT("/:id", groupHandler.UpdateGroup)               // 更新分组
 		groupsGroup.PUT("/:id/devices", groupHandler.AddDevicesToGroup) // 添加设备到分组
 		groupsGroup.DELETE("/:id", groupHandler.DeleteGroup)            // 删除分组
 	}
@@ -119,10 +133,13 @@ func SetupRoutes(router *gin.Engine) {
 
 	agentGroup := api.Group("/agent")
 	{
-		agentGroup.POST("/register", agentHandler.Register)    // 代理注册
-		agentGroup.POST("/heartbeat", agentHandler.Heartbeat)  // 代理心跳
-		agentGroup.GET("/commands", agentHandler.PollCommands) // 代理轮询命令
-		agentGroup.POST("/result", agentHandler.ReportResult)  // 代理报告结果
+		agentGroup.POST("/register", agentHandler.Register)                // 代理注册
+		agentGroup.POST("/heartbeat", agentHandler.Heartbeat)              // 代理心跳
+		agentGroup.GET("/commands", agentHandler.PollCommands)             // 代理轮询命令
+		agentGroup.POST("/ack", agentHandler.AckCommands)                  // 代理确认收到命令
+		agentGroup.POST("/result", agentHandler.ReportResult)              // 代理报告结果
+		agentGroup.POST("/result/stream", agentHandler.ReportResultStream) // 代理上报增量输出
+		agentGroup.POST("/result/log", agentHandler.UploadResultLog)       // 代理分片上传完整日志
 	}
 
 	// 日志管理路由
@@ -136,4 +153,60 @@ func SetupRoutes(router *gin.Engine) {
 		logsGroup.GET("/user", middleware.AdminRequired(), logHandler.GetUserLogs) // 获取用户日志（管理员）
 		logsGroup.GET("/download/:log_id", logHandler.DownloadLog)                 // 下载日志文件
 	}
+
+	// 日志保留策略路由（管理员）
+	retentionHandler := NewRetentionHandler()
+
+	retentionGroup := api.Group("/retention")
+	retentionGroup.Use(middleware.AdminRequired()) // 需要管理员权限
+	{
+		retentionGroup.GET("/rules", retentionHandler.ListRules)         // 列出保留规则
+		retentionGroup.POST("/rules", retentionHandler.CreateRule)       // 创建分组保留规则
+		retentionGroup.PUT("/rules/:id", retentionHandler.UpdateRule)    // 更新保留规则
+		retentionGroup.DELETE("/rules/:id", retentionHandler.DeleteRule) // 删除保留规则
+		retentionGroup.GET("/report", retentionHandler.GetReport)        // 试运行清理报告
+	}
+
+	// 告警路由
+	alertHandler := NewAlertHandler()
+
+	alertsGroup := api.Group("/alerts")
+	alertsGroup.Use(middleware.AuthRequired()) // 需要认证
+	{
+		alertsGroup.GET("", alertHandler.ListAlerts)                    // 列出告警
+		alertsGroup.GET("/rules", alertHandler.ListRules)               // 列出告警规则
+		alertsGroup.POST("/rules", alertHandler.CreateRule)             // 创建告警规则
+		alertsGroup.PUT("/rules/:id", alertHandler.UpdateRule)          // 更新告警规则
+		alertsGroup.DELETE("/rules/:id", alertHandler.DeleteRule)       // 删除告警规则
+		alertsGroup.GET("/silences", alertHandler.ListSilences)         // 列出静默
+		alertsGroup.POST("/silences", alertHandler.CreateSilence)       // 创建静默
+		alertsGroup.DELETE("/silences/:id", alertHandler.DeleteSilence) // 删除静默
+	}
+
+	// Webhook路由
+	webhookHandler := NewWebhookHandler()
+
+	webhooksGroup := api.Group("/webhooks")
+	webhooksGroup.Use(middleware.AuthRequired()) // 需要认证
+	{
+		webhooksGroup.GET("", webhookHandler.ListWebhooks)                  // 列出Webhook
+		webhooksGroup.POST("", webhookHandler.CreateWebhook)                // 创建Webhook
+		webhooksGroup.PUT("/:id", webhookHandler.UpdateWebhook)             // 更新Webhook
+		webhooksGroup.DELETE("/:id", webhookHandler.DeleteWebhook)          // 删除Webhook
+		webhooksGroup.POST("/:id/test", webhookHandler.TestWebhook)         // 发送测试推送
+		webhooksGroup.GET("/:id/deliveries", webhookHandler.ListDeliveries) // 列出推送记录
+	}
+
+	// 通知渠道路由
+	notificationHandler := NewNotificationHandler()
+
+	notificationsGroup := api.Group("/notifications")
+	notificationsGroup.Use(middleware.AuthRequired()) // 需要认证
+	{
+		notificationsGroup.GET("/channels", notificationHandler.ListChannels)          // 列出通知渠道
+		notificationsGroup.POST("/channels", notificationHandler.CreateChannel)        // 创建通知渠道
+		notificationsGroup.PUT("/channels/:id", notificationHandler.UpdateChannel)     // 更新通知渠道
+		notificationsGroup.DELETE("/channels/:id", notificationHandler.DeleteChannel)  // 删除通知渠道
+		notificationsGroup.POST("/channels/:id/test", notificationHandler.TestChannel) // 发送测试通知
+	}
 }
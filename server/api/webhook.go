@@ -0,0 +1,255 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/XRSec/Cslite/internal/webhook"
+	"github.com/XRSec/Cslite/middleware"
+	"github.com/XRSec/Cslite/models"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	service *webhook.Service
+}
+
+func NewWebhookHandler() *WebhookHandler {
+	return &WebhookHandler{
+		service: webhook.NewService(),
+	}
+}
+
+type WebhookRequest struct {
+	Name    *string  `json:"name"`
+	URL     *string  `json:"url"`
+	Secret  *string  `json:"secret"`
+	Events  []string `json:"events"`
+	GroupID *string  `json:"group_id"`
+	Enabled *bool    `json:"enabled"`
+}
+
+func (r *WebhookRequest) input() webhook.Input {
+	return webhook.Input{
+		Name:    r.Name,
+		URL:     r.URL,
+		Secret:  r.Secret,
+		Events:  r.Events,
+		GroupID: r.GroupID,
+		Enabled: r.Enabled,
+	}
+}
+
+// webhookWithSecret 创建Webhook时返回签名密钥，之后不再返回
+type webhookWithSecret struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+
+	webhooks, err := h.service.ListWebhooks(user.ID, user.IsAdmin())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data": gin.H{
+			"webhooks": webhooks,
+		},
+	})
+}
+
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	hook, err := h.service.CreateWebhook(user.ID, user.IsAdmin(), req.input())
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    20000,
+		"message": "Webhook创建成功",
+		"data":    webhookWithSecret{Webhook: hook, Secret: hook.Secret},
+	})
+}
+
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数缺失或格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	hook, err := h.service.UpdateWebhook(uint(webhookID), user.ID, user.IsAdmin(), req.input())
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "Webhook更新成功",
+		"data":    hook,
+	})
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	if err := h.service.DeleteWebhook(uint(webhookID), user.ID, user.IsAdmin()); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "Webhook删除成功",
+		"data": gin.H{
+			"deleted_at": time.Now().Format(time.RFC3339),
+		},
+	})
+}
+
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	delivery, err := h.service.Test(uint(webhookID), user.ID, user.IsAdmin())
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "测试推送已发送",
+		"data":    delivery,
+	})
+}
+
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "参数格式错误",
+			"data":    nil,
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	user := middleware.GetCurrentUser(c)
+
+	deliveries, total, err := h.service.ListDeliveries(uint(webhookID), user.ID, user.IsAdmin(), c.Query("status"), page, limit)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "获取成功",
+		"data": gin.H{
+			"total":      total,
+			"page":       page,
+			"per_page":   limit,
+			"deliveries": deliveries,
+		},
+	})
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	switch err {
+	case webhook.ErrInvalidWebhook:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40004,
+			"message": "Webhook参数不合法",
+			"data":    nil,
+		})
+	case webhook.ErrGroupNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40030,
+			"message": "群组不存在",
+			"data":    nil,
+		})
+	case webhook.ErrWebhookNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    40042,
+			"message": "Webhook不存在",
+			"data":    nil,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50001,
+			"message": "系统异常",
+			"data":    nil,
+		})
+	}
+}
@@ -18,10 +18,53 @@ type Config struct {
 	SecretKey           string // 应用密钥
 	JWTSecret           string // JWT签名密钥
 	APIRateLimit        int    // API速率限制
+	TrustedProxies      string // 信任的反向代理地址或网段（逗号分隔），为空时不采信X-Forwarded-For
 	AllowRegister       bool   // 是否允许用户注册
 	FileDir             string // 文件存储目录
+	LogStorage          string // 执行日志存储后端（local/s3）
+	LogMaxSizeMB        int64  // 单个执行日志的大小上限（MB，上传的压缩日志按解压后大小计算）
+	S3Endpoint          string // S3兼容存储服务地址
+	S3Region            string // S3区域
+	S3Bucket            string // S3存储桶
+	S3Prefix            string // S3对象键前缀
+	S3AccessKey         string // S3访问密钥ID
+	S3SecretKey         string // S3访问密钥
+	S3PathStyle         bool   // 是否使用路径风格访问S3（MinIO需开启）
 	HeartbeatInterval   int    // 心跳间隔（秒）
 	CommandPollInterval int    // 命令轮询间隔（秒）
+	LongPollMax         int    // 长轮询最长等待时间（秒，0表示关闭长轮询）
+	DeliveryLease       int    // 任务下发租约（秒），到期未确认则重新下发
+	CronEnabled         bool   // 是否启用服务端定时调度
+	SchedulerInterval   int    // 调度器扫描间隔（秒）
+	RetentionEnabled    bool   // 是否启用日志保留清理
+	RetentionInterval   int    // 日志清理间隔（秒）
+	RetentionMaxAgeDays int    // 执行记录默认最长保留天数（0表示不限制）
+	RetentionMaxSizeMB  int64  // 日志默认总大小上限（MB，0表示不限制）
+	RetentionKeepLast   int    // 每个命令默认保留最近N次执行（0表示不限制）
+	MetricsEnabled      bool   // 是否记录设备指标历史
+	MetricsInterval     int    // 指标汇总与清理间隔（秒）
+	MetricsRawHours     int    // 原始指标保留小时数
+	Metrics5mDays       int    // 5分钟汇总指标保留天数
+	Metrics1hDays       int    // 1小时汇总指标保留天数
+	DeviceSweepInterval int    // 设备在线状态巡检间隔（秒）
+	DeviceStaleAfter    int    // 连续错过多少个心跳周期后标记为失联
+	DeviceOfflineAfter  int    // 连续错过多少个心跳周期后标记为离线
+	LostResultGrace     int    // 设备离线后等待多久将执行中的结果标记为丢失（秒）
+	DeviceEventDays     int    // 设备事件保留天数（0表示不限制）
+	AlertsEnabled       bool   // 是否启用告警规则评估
+	AlertInterval       int    // 告警规则评估间隔（秒）
+	WebhookInterval     int    // Webhook推送扫描间隔（秒）
+	WebhookMaxAttempts  int    // Webhook推送最多尝试次数
+	WebhookTimeout      int    // Webhook推送请求超时（秒）
+	WebhookLogDays      int    // Webhook推送记录保留天数（0表示不限制）
+	AllowPrivateTargets bool   // 是否允许Webhook与群聊通知推送到回环、内网、链路本地地址
+	SMTPHost            string // SMTP服务器地址（为空时不发送邮件通知）
+	SMTPPort            int    // SMTP服务器端口
+	SMTPUsername        string // SMTP认证用户名（为空时不认证）
+	SMTPPassword        string // SMTP认证密码
+	SMTPFrom            string // 邮件发件人地址
+	SMTPTLS             bool   // 是否使用隐式TLS连接（如465端口），否则在服务器支持时使用STARTTLS
+	NotifyTimeout       int    // 发送通知的超时时间（秒）
 }
 
 // AppConfig 是全局配置实例
@@ -43,13 +86,57 @@ func LoadConfig() error {
 		SecretKey: getEnv("CSLITE_SECRET_KEY", ""),
 		JWTSecret: getEnv("CSLITE_JWT_SECRET", ""),
 		FileDir:   getEnv("CSLITE_FILE_DIR", "/var/cslite/files"),
+
+		LogStorage:  getEnv("CSLITE_LOG_STORAGE", "local"),
+		S3Endpoint:  getEnv("CSLITE_S3_ENDPOINT", ""),
+		S3Region:    getEnv("CSLITE_S3_REGION", "us-east-1"),
+		S3Bucket:    getEnv("CSLITE_S3_BUCKET", ""),
+		S3Prefix:    getEnv("CSLITE_S3_PREFIX", "logs/"),
+		S3AccessKey: getEnv("CSLITE_S3_ACCESS_KEY", ""),
+		S3SecretKey: getEnv("CSLITE_S3_SECRET_KEY", ""),
 	}
 
 	// 设置整数类型的配置项
 	AppConfig.APIRateLimit = getEnvAsInt("CSLITE_API_RATE_LIMIT", 60)
 	AppConfig.AllowRegister = getEnvAsBool("CSLITE_ALLOW_REGISTER", true)
+	AppConfig.TrustedProxies = getEnv("CSLITE_TRUSTED_PROXIES", "")
 	AppConfig.HeartbeatInterval = getEnvAsInt("AGENT_HEARTBEAT_INTERVAL", 60)
 	AppConfig.CommandPollInterval = getEnvAsInt("AGENT_COMMAND_POLL_INTERVAL", 30)
+	AppConfig.LongPollMax = getEnvAsInt("CSLITE_LONG_POLL_MAX", 60)
+	AppConfig.DeliveryLease = getEnvAsInt("CSLITE_DELIVERY_LEASE", 60)
+	AppConfig.S3PathStyle = getEnvAsBool("CSLITE_S3_PATH_STYLE", true)
+	AppConfig.LogMaxSizeMB = int64(getEnvAsInt("CSLITE_LOG_MAX_SIZE_MB", 256))
+	AppConfig.CronEnabled = getEnvAsBool("CSLITE_CRON_ENABLED", true)
+	AppConfig.SchedulerInterval = getEnvAsInt("CSLITE_SCHEDULER_INTERVAL", 10)
+	AppConfig.RetentionEnabled = getEnvAsBool("CSLITE_RETENTION_ENABLED", false)
+	AppConfig.RetentionInterval = getEnvAsInt("CSLITE_RETENTION_INTERVAL", 3600)
+	AppConfig.RetentionMaxAgeDays = getEnvAsInt("CSLITE_RETENTION_MAX_AGE_DAYS", 0)
+	AppConfig.RetentionMaxSizeMB = int64(getEnvAsInt("CSLITE_RETENTION_MAX_SIZE_MB", 0))
+	AppConfig.RetentionKeepLast = getEnvAsInt("CSLITE_RETENTION_KEEP_LAST", 0)
+	AppConfig.MetricsEnabled = getEnvAsBool("CSLITE_METRICS_ENABLED", true)
+	AppConfig.MetricsInterval = getEnvAsInt("CSLITE_METRICS_INTERVAL", 300)
+	AppConfig.MetricsRawHours = getEnvAsInt("CSLITE_METRICS_RAW_HOURS", 48)
+	AppConfig.Metrics5mDays = getEnvAsInt("CSLITE_METRICS_5M_DAYS", 14)
+	AppConfig.Metrics1hDays = getEnvAsInt("CSLITE_METRICS_1H_DAYS", 180)
+	AppConfig.DeviceSweepInterval = getEnvAsInt("CSLITE_DEVICE_SWEEP_INTERVAL", 30)
+	AppConfig.DeviceStaleAfter = getEnvAsInt("CSLITE_DEVICE_STALE_AFTER", 3)
+	AppConfig.DeviceOfflineAfter = getEnvAsInt("CSLITE_DEVICE_OFFLINE_AFTER", 5)
+	AppConfig.LostResultGrace = getEnvAsInt("CSLITE_LOST_RESULT_GRACE", 600)
+	AppConfig.DeviceEventDays = getEnvAsInt("CSLITE_DEVICE_EVENT_DAYS", 90)
+	AppConfig.AlertsEnabled = getEnvAsBool("CSLITE_ALERTS_ENABLED", true)
+	AppConfig.AlertInterval = getEnvAsInt("CSLITE_ALERT_INTERVAL", 30)
+	AppConfig.WebhookInterval = getEnvAsInt("CSLITE_WEBHOOK_INTERVAL", 5)
+	AppConfig.WebhookMaxAttempts = getEnvAsInt("CSLITE_WEBHOOK_MAX_ATTEMPTS", 6)
+	AppConfig.WebhookTimeout = getEnvAsInt("CSLITE_WEBHOOK_TIMEOUT", 10)
+	AppConfig.WebhookLogDays = getEnvAsInt("CSLITE_WEBHOOK_LOG_DAYS", 7)
+	AppConfig.AllowPrivateTargets = getEnvAsBool("CSLITE_ALLOW_PRIVATE_TARGETS", false)
+	AppConfig.SMTPHost = getEnv("CSLITE_SMTP_HOST", "")
+	AppConfig.SMTPPort = getEnvAsInt("CSLITE_SMTP_PORT", 587)
+	AppConfig.SMTPUsername = getEnv("CSLITE_SMTP_USERNAME", "")
+	AppConfig.SMTPPassword = getEnv("CSLITE_SMTP_PASSWORD", "")
+	AppConfig.SMTPFrom = getEnv("CSLITE_SMTP_FROM", "")
+	AppConfig.SMTPTLS = getEnvAsBool("CSLITE_SMTP_TLS", false)
+	AppConfig.NotifyTimeout = getEnvAsInt("CSLITE_NOTIFY_TIMEOUT", 10)
 
 	// 验证必需的配置项
 	if AppConfig.DBDsn == "" {
@@ -62,6 +149,17 @@ func LoadConfig() error {
 		return ErrMissingJWTSecret
 	}
 
+	// 验证日志存储配置
+	switch AppConfig.LogStorage {
+	case "local":
+	case "s3":
+		if AppConfig.S3Endpoint == "" || AppConfig.S3Bucket == "" {
+			return ErrMissingS3Config
+		}
+	default:
+		return ErrInvalidLogStorage
+	}
+
 	return nil
 }
 
@@ -67,17 +67,30 @@ func InitDatabase() error {
 func autoMigrate() error {
 	logrus.Info("Running database migrations...")
 
-	// 自动创建或更新所有模型对应的数据库表
-	return DB.AutoMigrate(
-		&models.User{},            // 用户表
-		&models.Session{},         // 会话表
-		&models.APIKey{},          // API密钥表
-		&models.Device{},          // 设备表
-		&models.Agent{},           // 代理表
-		&models.Group{},           // 分组表
-		&models.Command{},         // 命令表
-		&models.Execution{},       // 执行记录表
-		&models.ExecutionResult{}, // 执行结果表
+	return Migrate(DB)
+}
+
+// Migrate 自动创建或更新所有模型对应的数据库表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.User{},                // 用户表
+		&models.Session{},             // 会话表
+		&models.APIKey{},              // API密钥表
+		&models.Device{},              // 设备表
+		&models.Agent{},               // 代理表
+		&models.Group{},               // 分组表
+		&models.Command{},             // 命令表
+		&models.Execution{},           // 执行记录表
+		&models.ExecutionResult{},     // 执行结果表
+		&models.RetentionRule{},       // 日志保留规则表
+		&models.MetricSample{},        // 设备指标历史表
+		&models.DeviceEvent{},         // 设备事件表
+		&models.AlertRule{},           // 告警规则表
+		&models.Alert{},               // 告警表
+		&models.AlertSilence{},        // 告警静默表
+		&models.Webhook{},             // Webhook表
+		&models.WebhookDelivery{},     // Webhook推送记录表
+		&models.NotificationChannel{}, // 通知渠道表
 	)
 }
 
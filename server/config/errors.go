@@ -5,7 +5,9 @@ import "errors"
 
 // 配置相关的错误定义
 var (
-	ErrMissingDBDsn     = errors.New("missing database DSN") // 缺少数据库连接字符串
-	ErrMissingSecretKey = errors.New("missing secret key")   // 缺少应用密钥
-	ErrMissingJWTSecret = errors.New("missing JWT secret")   // 缺少JWT签名密钥
+	ErrMissingDBDsn      = errors.New("missing database DSN")                      // 缺少数据库连接字符串
+	ErrMissingSecretKey  = errors.New("missing secret key")                        // 缺少应用密钥
+	ErrMissingJWTSecret  = errors.New("missing JWT secret")                        // 缺少JWT签名密钥
+	ErrInvalidLogStorage = errors.New("invalid log storage, expected local or s3") // 日志存储后端无效
+	ErrMissingS3Config   = errors.New("missing S3 endpoint or bucket")             // 缺少S3存储配置
 )
@@ -8,4 +8,6 @@ var (
 	ErrAgentNotFound        = errors.New("agent not found")
 	ErrDeviceOffline        = errors.New("device is offline")
 	ErrExecutionNotFound    = errors.New("execution not found")
+	ErrResultNotFound       = errors.New("device is not a target of this execution")
+	ErrResultClosed         = errors.New("result has already been reported or closed")
 )
\ No newline at end of file
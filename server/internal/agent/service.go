@@ -1,31 +1,98 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/event"
+	"github.com/XRSec/Cslite/internal/execution"
+	"github.com/XRSec/Cslite/internal/log"
+	"github.com/XRSec/Cslite/internal/metrics"
+	"github.com/XRSec/Cslite/internal/notify"
+	"github.com/XRSec/Cslite/internal/webhook"
 	"github.com/XRSec/Cslite/models"
 	"github.com/XRSec/Cslite/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Service struct {
-	db *gorm.DB
+	db         *gorm.DB
+	executions *execution.Service
+	logs       *log.Service
+	metrics    *metrics.Service
+	events     *event.Service
+	webhooks   *webhook.Service
+	notifier   *notify.Hub
 }
 
 func NewService() *Service {
 	return &Service{
-		db: config.DB,
+		db:         config.DB,
+		executions: execution.NewService(),
+		logs:       log.NewService(),
+		metrics:    metrics.NewService(),
+		events:     event.NewService(),
+		webhooks:   webhook.NewService(),
+		notifier:   notify.Default,
 	}
 }
 
+// HeartbeatMetrics Agent心跳上报的系统指标，CPU为两次心跳之间的平均使用率，网络为期间的平均速率（KB/s）
 type HeartbeatMetrics struct {
 	CPUUsage   float64 `json:"cpu_usage"`
 	MemoryUsed int     `json:"memory_used"`
 	DiskUsage  float64 `json:"disk_usage"`
 	NetworkIn  int     `json:"network_in"`
 	NetworkOut int     `json:"network_out"`
+
+	MemoryTotal int                `json:"memory_total"` // 内存总量（MB）
+	SwapUsed    int                `json:"swap_used"`    // swap使用量（MB）
+	SwapTotal   int                `json:"swap_total"`   // swap总量（MB）
+	Load1       float64            `json:"load_1"`       // 1分钟平均负载
+	Load5       float64            `json:"load_5"`       // 5分钟平均负载
+	Load15      float64            `json:"load_15"`      // 15分钟平均负载
+	Uptime      int64              `json:"uptime"`       // 开机时长（秒）
+	Disks       []DiskMetrics      `json:"disks,omitempty"`
+	Interfaces  []InterfaceMetrics `json:"interfaces,omitempty"`
+}
+
+// sample 转换为指标历史的原始样本
+func (m *HeartbeatMetrics) sample() *models.MetricSample {
+	return &models.MetricSample{
+		CPUUsage:    m.CPUUsage,
+		MemoryUsed:  m.MemoryUsed,
+		MemoryTotal: m.MemoryTotal,
+		SwapUsed:    m.SwapUsed,
+		DiskUsage:   m.DiskUsage,
+		NetworkIn:   m.NetworkIn,
+		NetworkOut:  m.NetworkOut,
+		Load1:       m.Load1,
+	}
+}
+
+// DiskMetrics 单个挂载点的磁盘用量
+type DiskMetrics struct {
+	Mountpoint string  `json:"mountpoint"`
+	Fstype     string  `json:"fstype"`
+	TotalMB    int64   `json:"total_mb"`
+	UsedMB     int64   `json:"used_mb"`
+	Usage      float64 `json:"usage"`
+}
+
+// InterfaceMetrics 单个网卡的累计流量（字节）与平均速率（KB/s）
+type InterfaceMetrics struct {
+	Name    string `json:"name"`
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+	RxRate  int    `json:"rx_rate"`
+	TxRate  int    `json:"tx_rate"`
 }
 
 func (s *Service) RegisterAgent(apiKey, name, platform, version string) (*models.Agent, *models.Device, error) {
@@ -66,162 +133,662 @@ func (s *Service) RegisterAgent(apiKey, name, platform, version string) (*models
 		return nil, nil, err
 	}
 
+	s.events.Registered(device, "agent")
+	s.webhooks.AgentRegistered(agent, device)
 	return agent, device, nil
 }
 
-func (s *Service) Heartbeat(agentID string, metrics *HeartbeatMetrics) error {
+// Heartbeat 记录Agent心跳与上报的指标，clientIP为心跳请求的来源地址，interval为Agent实际使用的心跳间隔（秒，旧版Agent为0）
+func (s *Service) Heartbeat(agentID string, metrics *HeartbeatMetrics, clientIP string, interval int) error {
 	var agent models.Agent
 	if err := s.db.Where("id = ?", agentID).First(&agent).Error; err != nil {
 		return ErrAgentNotFound
 	}
 
+	now := time.Now()
 	metricsJSON, _ := json.Marshal(metrics)
 
+	// 距上次心跳超过两个心跳周期（至少错过一次心跳）时记录中断，周期取服务端配置与Agent上报间隔中较大的一个
+	period := time.Duration(config.AppConfig.HeartbeatInterval) * time.Second
+	if reported := time.Duration(interval) * time.Second; reported > period {
+		period = reported
+	}
+	if period > 0 && now.Sub(agent.LastHeartbeat) > 2*period {
+		s.events.HeartbeatGap(agent.DeviceID, agent.LastHeartbeat, now, period)
+	}
+
 	if err := s.db.Model(&agent).Updates(map[string]interface{}{
-		"last_heartbeat":    time.Now(),
+		"last_heartbeat":    now,
 		"heartbeat_metrics": string(metricsJSON),
 	}).Error; err != nil {
 		return err
 	}
 
-	if err := s.db.Model(&models.Device{}).Where("id = ?", agent.DeviceID).Updates(map[string]interface{}{
-		"status":    models.StatusOnline,
-		"last_seen": time.Now(),
-	}).Error; err != nil {
+	// 指标历史写入失败不影响心跳
+	if metrics != nil && config.AppConfig.MetricsEnabled {
+		if err := s.metrics.Record(agent.DeviceID, now, metrics.sample()); err != nil {
+			logrus.Errorf("Failed to record metrics for device %s: %v", agent.DeviceID, err)
+		}
+	}
+
+	var device models.Device
+	if err := s.db.Select("id", "status").First(&device, "id = ?", agent.DeviceID).Error; err != nil {
 		return err
 	}
 
+	deviceUpdates := map[string]interface{}{
+		"last_seen": now,
+	}
+	if clientIP != "" {
+		deviceUpdates["ip_address"] = clientIP
+	}
+	if interval > 0 {
+		deviceUpdates["heartbeat_interval"] = interval
+	}
+
+	if err := s.db.Model(&models.Device{}).Where("id = ?", agent.DeviceID).Updates(deviceUpdates).Error; err != nil {
+		return err
+	}
+
+	// 失联或离线的设备恢复心跳后重新上线，在线与忙碌状态保持不变
+	if device.Status != models.StatusOnline && device.Status != models.StatusBusy {
+		result := s.db.Model(&models.Device{}).
+			Where("id = ? AND status = ?", device.ID, device.Status).
+			Update("status", models.StatusOnline)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			s.events.StatusChanged(device.ID, device.Status, models.StatusOnline, "heartbeat")
+			s.webhooks.DeviceStatusChanged(device.ID, device.Status, models.StatusOnline)
+		}
+	}
+
 	return nil
 }
 
-func (s *Service) GetPendingCommands(agentID string) ([]*CommandTask, error) {
+// GetPendingCommands 领取设备待执行的任务，capacity为Agent本地队列剩余容量，小于0表示不限制（旧版Agent）
+func (s *Service) GetPendingCommands(agentID string, capacity int) ([]*CommandTask, []*ControlMessage, error) {
 	var agent models.Agent
 	if err := s.db.Where("id = ?", agentID).First(&agent).Error; err != nil {
-		return nil, ErrAgentNotFound
+		return nil, nil, ErrAgentNotFound
 	}
 
 	var device models.Device
 	if err := s.db.First(&device, "id = ?", agent.DeviceID).Error; err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if device.Status == models.StatusOffline {
-		return nil, ErrDeviceOffline
+		return nil, nil, ErrDeviceOffline
 	}
 
-	var commands []models.Command
-	query := s.db.Where("status IN ?", []string{models.CommandStatusPending, models.CommandStatusRunning})
+	controls, err := s.getControls(device.ID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	query = query.Where("(target_type = 'devices' AND JSON_CONTAINS(target_ids, ?)) OR (target_type = 'groups' AND JSON_CONTAINS(target_ids, ?))",
-		`"`+device.ID+`"`, `"`+device.GroupID+`"`)
+	// 本次最多下发的任务数取Agent剩余容量与设备并发上限剩余名额中较小的一个
+	limit := capacity
+	active, lockKeys, err := s.activeDeliveries(device.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if device.MaxConcurrency > 0 {
+		remaining := device.MaxConcurrency - active
+		if remaining < 0 {
+			remaining = 0
+		}
+		if limit < 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+	if limit == 0 {
+		return nil, controls, nil
+	}
 
-	if err := query.Find(&commands).Error; err != nil {
-		return nil, err
+	// 只下发尚未下发、或已下发但租约到期仍未确认的结果
+	now := time.Now()
+	var results []models.ExecutionResult
+	if err := s.db.Preload("Execution.Command").
+		Where("device_id = ? AND status = ?", device.ID, models.ResultStatusPending).
+		Where("not_before IS NULL OR not_before <= ?", now).
+		Where("delivery_state = ? OR (delivery_state = ? AND lease_until < ?)",
+			models.DeliveryStateQueued, models.DeliveryStateDelivered, now).
+		Order("created_at").
+		Find(&results).Error; err != nil {
+		return nil, nil, err
 	}
 
+	defaultEnv := s.defaultEnvVars(&device)
+
 	var tasks []*CommandTask
-	for _, cmd := range commands {
-		var execution models.Execution
-		if err := s.db.Where("command_id = ? AND status = ?", cmd.ID, models.ExecutionStatusPending).First(&execution).Error; err != nil {
-			execution = models.Execution{
-				ID:        utils.GenerateExecutionID(),
-				CommandID: cmd.ID,
-				Status:    models.ExecutionStatusPending,
-				StartedAt: time.Now(),
-			}
-			s.db.Create(&execution)
+	for _, result := range results {
+		if limit > 0 && len(tasks) >= limit {
+			break
+		}
+
+		cmd := result.Execution.Command
+		if cmd.Status == models.CommandStatusPaused || cmd.Status == models.CommandStatusCancelled {
+			continue
+		}
+		// 同一设备上持有相同锁键的任务未结束前不下发
+		if cmd.LockKey != "" && lockKeys[cmd.LockKey] {
+			continue
+		}
+
+		claimed, err := s.claimDelivery(&result, cmd.Concurrency, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !claimed {
+			continue
+		}
+		if result.DeliveryState == models.DeliveryStateDelivered {
+			logrus.Warnf("Execution %s on device %s was not acknowledged, delivering again", result.ExecutionID, device.ID)
+		}
+		s.events.CommandDispatched(device.ID, &cmd, &result, result.DeliveryCount+1)
+		if cmd.LockKey != "" {
+			lockKeys[cmd.LockKey] = true
 		}
 
 		task := &CommandTask{
 			CommandID:   cmd.ID,
-			ExecutionID: execution.ID,
+			ExecutionID: result.ExecutionID,
+			Attempt:     result.Attempt,
+			Interpreter: cmd.Interpreter,
 			Content:     cmd.Content,
+			Script:      cmd.Script,
+			RunAs:       cmd.RunAs,
+			RunAsGroup:  cmd.RunAsGroup,
+			WorkingDir:  cmd.WorkingDir,
+			Umask:       cmd.Umask,
 			Timeout:     cmd.Timeout,
 			EnvVars:     make(map[string]string),
+			LockKey:     cmd.LockKey,
 		}
 
+		// 分组与设备的默认环境变量先合并，命令自身的同名变量优先
+		var commandEnv map[string]string
 		if cmd.EnvVars != nil {
-			json.Unmarshal(cmd.EnvVars, &task.EnvVars)
+			json.Unmarshal(cmd.EnvVars, &commandEnv)
+		}
+		for key, value := range defaultEnv {
+			task.EnvVars[key] = value
+		}
+		for key, value := range commandEnv {
+			task.EnvVars[key] = value
+		}
+		if cmd.Args != nil {
+			json.Unmarshal(cmd.Args, &task.Args)
+		}
+		if cmd.ResourceLimits != nil {
+			var limits models.ResourceLimits
+			if json.Unmarshal(cmd.ResourceLimits, &limits) == nil && !limits.IsZero() {
+				task.ResourceLimits = &limits
+			}
 		}
 
 		tasks = append(tasks, task)
+	}
+
+	if len(tasks) > 0 {
+		s.db.Model(&models.Device{}).Where("id = ? AND status = ?", device.ID, models.StatusOnline).Update("status", models.StatusBusy)
+	}
+
+	return tasks, controls, nil
+}
+
+// defaultEnvVars 合并设备所属分组与设备自身的默认环境变量，设备上的同名变量优先
+func (s *Service) defaultEnvVars(device *models.Device) map[string]string {
+	var groupEnv, deviceEnv map[string]string
+
+	if device.GroupID != "" {
+		var group models.Group
+		if err := s.db.Select("env_vars").First(&group, "id = ?", device.GroupID).Error; err == nil && group.EnvVars != nil {
+			json.Unmarshal(group.EnvVars, &groupEnv)
+		}
+	}
+	if device.EnvVars != nil {
+		json.Unmarshal(device.EnvVars, &deviceEnv)
+	}
+
+	envVars := make(map[string]string, len(groupEnv)+len(deviceEnv))
+	for key, value := range groupEnv {
+		envVars[key] = value
+	}
+	for key, value := range deviceEnv {
+		envVars[key] = value
+	}
+	return envVars
+}
+
+// activeDeliveries 统计设备上已下发且未结束的任务数，以及这些任务持有的锁键
+func (s *Service) activeDeliveries(deviceID string) (int, map[string]bool, error) {
+	var rows []struct {
+		LockKey string
+	}
+
+	if err := s.db.Table("execution_results").
+		Select("commands.lock_key").
+		Joins("JOIN executions ON executions.id = execution_results.execution_id").
+		Joins("JOIN commands ON commands.id = executions.command_id").
+		Where("execution_results.device_id = ?", deviceID).
+		Where("execution_results.status IN ? AND execution_results.delivery_state IN ?", activeResultStatuses, activeDeliveryStates).
+		Scan(&rows).Error; err != nil {
+		return 0, nil, err
+	}
+
+	lockKeys := make(map[string]bool)
+	for _, row := range rows {
+		if row.LockKey != "" {
+			lockKeys[row.LockKey] = true
+		}
+	}
 
-		s.db.Model(&device).Update("status", models.StatusBusy)
+	return len(rows), lockKeys, nil
+}
+
+// claimDelivery 将结果标记为已下发并设置租约，以下发状态为条件更新，并发拉取时只有一次生效
+// 命令限制了并发设备数时锁定执行记录，确保同一执行中已下发未结束的设备数不超过上限
+func (s *Service) claimDelivery(result *models.ExecutionResult, concurrency int, now time.Time) (bool, error) {
+	if concurrency <= 0 {
+		return s.markDelivered(s.db, result, now)
+	}
+
+	claimed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var execution models.Execution
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&execution, "id = ?", result.ExecutionID).Error; err != nil {
+			return err
+		}
+
+		var active int64
+		if err := tx.Model(&models.ExecutionResult{}).
+			Where("execution_id = ? AND id <> ?", result.ExecutionID, result.ID).
+			Where("status IN ? AND delivery_state IN ?", activeResultStatuses, activeDeliveryStates).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active >= int64(concurrency) {
+			return nil
+		}
+
+		var err error
+		claimed, err = s.markDelivered(tx, result, now)
+		return err
+	})
+
+	return claimed, err
+}
+
+// markDelivered 以下发状态和租约为条件将结果标记为已下发
+func (s *Service) markDelivered(tx *gorm.DB, result *models.ExecutionResult, now time.Time) (bool, error) {
+	leaseUntil := now.Add(time.Duration(config.AppConfig.DeliveryLease) * time.Second)
+	update := tx.Model(&models.ExecutionResult{}).
+		Where("id = ? AND status = ? AND delivery_state = ?", result.ID, models.ResultStatusPending, result.DeliveryState).
+		Where("lease_until IS NULL OR lease_until < ?", now).
+		Updates(map[string]interface{}{
+			"delivery_state": models.DeliveryStateDelivered,
+			"delivery_count": gorm.Expr("delivery_count + 1"),
+			"delivered_at":   &now,
+			"lease_until":    &leaseUntil,
+			"started_at":     now,
+		})
+	if update.Error != nil {
+		return false, update.Error
+	}
+	return update.RowsAffected > 0, nil
+}
+
+// Acknowledge 确认Agent已收到下发的任务，确认后不再重新下发
+func (s *Service) Acknowledge(agentID string, acks []DeliveryAck) (int, error) {
+	var agent models.Agent
+	if err := s.db.Where("id = ?", agentID).First(&agent).Error; err != nil {
+		return 0, ErrAgentNotFound
+	}
+
+	now := time.Now()
+	acknowledged := 0
+	for _, ack := range acks {
+		update := s.db.Model(&models.ExecutionResult{}).
+			Where("execution_id = ? AND device_id = ? AND attempt = ? AND delivery_state = ?",
+				ack.ExecutionID, agent.DeviceID, ack.Attempt, models.DeliveryStateDelivered).
+			Updates(map[string]interface{}{
+				"delivery_state": models.DeliveryStateAcknowledged,
+				"acked_at":       &now,
+			})
+		if update.Error != nil {
+			return acknowledged, update.Error
+		}
+		acknowledged += int(update.RowsAffected)
 	}
 
-	return tasks, nil
+	return acknowledged, nil
 }
 
-func (s *Service) ReportResult(executionID, deviceID, status string, exitCode int, output, logContent string) error {
+// WaitForCommands 长轮询拉取任务：没有任务或控制指令时最多等待wait时长，期间有新下发会被立即唤醒
+func (s *Service) WaitForCommands(ctx context.Context, agentID string, capacity int, wait time.Duration) ([]*CommandTask, []*ControlMessage, error) {
+	var agent models.Agent
+	if err := s.db.Where("id = ?", agentID).First(&agent).Error; err != nil {
+		return nil, nil, ErrAgentNotFound
+	}
+
+	// 先订阅再查询，避免查询与等待之间的下发被错过
+	wake, cancel := s.notifier.Subscribe(agent.DeviceID)
+	defer cancel()
+
+	// 控制指令会在命令恢复或结束前持续返回，只有新任务才立即返回，避免Agent空转
+	tasks, controls, err := s.GetPendingCommands(agentID, capacity)
+	if err != nil || len(tasks) > 0 || wait <= 0 {
+		return tasks, controls, err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-wake:
+		return s.GetPendingCommands(agentID, capacity)
+	case <-timer.C:
+		return tasks, controls, nil
+	case <-ctx.Done():
+		return tasks, controls, nil
+	}
+}
+
+// getControls 返回设备上已下发但命令已被暂停或取消的执行对应的控制指令
+// Agent忽略未知执行的指令，因此最近已取消的结果也会继续下发，覆盖Agent已取走但尚未上报输出的任务
+func (s *Service) getControls(deviceID string) ([]*ControlMessage, error) {
+	var rows []struct {
+		ExecutionID   string
+		CommandID     string
+		ResultStatus  string
+		CommandStatus string
+	}
+
+	if err := s.db.Table("execution_results").
+		Select("execution_results.execution_id, executions.command_id, "+
+			"execution_results.status AS result_status, commands.status AS command_status").
+		Joins("JOIN executions ON executions.id = execution_results.execution_id").
+		Joins("JOIN commands ON commands.id = executions.command_id").
+		Where("execution_results.device_id = ?", deviceID).
+		Where("(execution_results.status IN ? AND commands.status IN ?) OR "+
+			"(execution_results.status = ? AND execution_results.completed_at >= ?)",
+			[]string{models.ResultStatusPending, models.ResultStatusRunning},
+			[]string{models.CommandStatusPaused, models.CommandStatusCancelled},
+			models.ResultStatusCancelled, time.Now().Add(-controlRetention)).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	controls := make([]*ControlMessage, 0, len(rows))
+	for _, row := range rows {
+		action := ControlActionCancel
+		if row.ResultStatus != models.ResultStatusCancelled && row.CommandStatus == models.CommandStatusPaused {
+			action = ControlActionPause
+		}
+
+		controls = append(controls, &ControlMessage{
+			ExecutionID: row.ExecutionID,
+			CommandID:   row.CommandID,
+			Action:      action,
+		})
+	}
+
+	return controls, nil
+}
+
+// AppendOutput 按序号追加Agent流式上报的输出分片，结果首次收到分片时执行进入running状态
+func (s *Service) AppendOutput(executionID, deviceID string, attempt, seq int, data string) error {
 	var execution models.Execution
 	if err := s.db.Where("id = ?", executionID).First(&execution).Error; err != nil {
 		return ErrExecutionNotFound
 	}
 
-	var logPath string
-	if logContent != "" {
-		logPath = s.saveLogFile(executionID, deviceID, logContent)
+	result, err := s.findResult(executionID, deviceID, attempt)
+	if err != nil {
+		return err
 	}
 
-	result := &models.ExecutionResult{
-		ID:          utils.GenerateExecutionID(),
-		ExecutionID: executionID,
-		DeviceID:    deviceID,
-		Status:      status,
-		ExitCode:    exitCode,
-		Output:      output,
-		LogPath:     logPath,
-		StartedAt:   execution.StartedAt,
-		CompletedAt: func() *time.Time { t := time.Now(); return &t }(),
-	}
+	logID := log.LogID(executionID, deviceID, result.Attempt)
+	started := false
 
-	if err := s.db.Create(result).Error; err != nil {
+	// 分片必须按序号连续追加，重复或乱序到达的分片直接忽略
+	// 锁定结果记录后先追加日志再推进序号，追加失败时序号不变，Agent按原序号重试即可补齐
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var locked models.ExecutionResult
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, "id = ?", result.ID).Error; err != nil {
+			return err
+		}
+		if locked.Status != models.ResultStatusPending && locked.Status != models.ResultStatusRunning {
+			return nil
+		}
+		if locked.OutputSeq != seq-1 {
+			return nil
+		}
+
+		if err := s.logs.AppendLog(logID, []byte(data)); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"status":         models.ResultStatusRunning,
+			"delivery_state": models.DeliveryStateRunning,
+			"output_seq":     seq,
+		}
+		if len(locked.Output) < outputPreviewLimit {
+			updates["output"] = previewOutput(locked.Output + data)
+		}
+		if locked.LogPath == "" {
+			updates["log_path"] = logID
+		}
+		if err := tx.Model(&models.ExecutionResult{}).Where("id = ?", locked.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		started = locked.Status == models.ResultStatusPending
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
-	s.db.Model(&models.Device{}).Where("id = ?", deviceID).Update("status", models.StatusOnline)
+	if started && execution.Status == models.ExecutionStatusPending {
+		return s.db.Model(&models.Execution{}).
+			Where("id = ? AND status = ?", executionID, models.ExecutionStatusPending).
+			Update("status", models.ExecutionStatusRunning).Error
+	}
 
-	var allResults []models.ExecutionResult
-	s.db.Where("execution_id = ?", executionID).Find(&allResults)
+	return nil
+}
 
-	allCompleted := true
-	hasFailure := false
-	for _, r := range allResults {
-		if r.Status == models.ResultStatusPending {
-			allCompleted = false
-			break
+// UploadLog 接收Agent分片上传的gzip压缩完整日志，返回已接收的字节数；final为true时解压写入日志存储
+func (s *Service) UploadLog(executionID, deviceID string, attempt int, offset int64, data []byte, final bool) (int64, error) {
+	result, err := s.findResult(executionID, deviceID, attempt)
+	if err != nil {
+		return 0, err
+	}
+
+	logID := log.LogID(executionID, deviceID, result.Attempt)
+	// 结果已上报或已被服务端关闭后不再接收日志，丢弃未完成的暂存分片，避免覆盖已保存的日志
+	if result.ReportedAt != nil || (result.Status != models.ResultStatusPending && result.Status != models.ResultStatusRunning) {
+		s.logs.DiscardUpload(logID)
+		return 0, ErrResultClosed
+	}
+
+	received, err := s.logs.AppendUpload(logID, offset, data)
+	if err != nil {
+		return received, err
+	}
+
+	if final {
+		if err := s.logs.CompleteUpload(logID); err != nil {
+			return received, err
 		}
-		if r.Status == models.ResultStatusFailed || r.Status == models.ResultStatusTimeout {
-			hasFailure = true
+	}
+
+	return received, nil
+}
+
+// ReportResult 保存Agent上报的最终结果，logUploaded表示完整日志已通过UploadLog上传
+func (s *Service) ReportResult(executionID, deviceID string, attempt int, status string, exitCode int, output, logContent string, logUploaded bool, streamSeq int, usage *models.ResourceUsage) error {
+	var execution models.Execution
+	if err := s.db.Where("id = ?", executionID).First(&execution).Error; err != nil {
+		return ErrExecutionNotFound
+	}
+
+	result, err := s.findResult(executionID, deviceID, attempt)
+	if err != nil {
+		return err
+	}
+
+	// 重复上报（Agent重放缓存的结果）直接视为成功，不再覆盖已保存的结果
+	if result.ReportedAt != nil {
+		return nil
+	}
+	// 服务端已判定超时、丢失或已取消的结果不再被迟到的上报覆盖，只记录设备事件
+	if result.Status != models.ResultStatusPending && result.Status != models.ResultStatusRunning {
+		s.events.CommandResult(result, status, exitCode, "late")
+		return nil
+	}
+
+	completedAt := time.Now()
+	updates := map[string]interface{}{
+		"status":         status,
+		"delivery_state": models.DeliveryStateDone,
+		"exit_code":      exitCode,
+		"completed_at":   &completedAt,
+		"reported_at":    &completedAt,
+	}
+
+	if usage != nil {
+		usageJSON, _ := json.Marshal(usage)
+		updates["resource_usage"] = datatypes.JSON(usageJSON)
+	}
+
+	// 上报了完整日志时覆盖流式追加的日志文件
+	if logUploaded {
+		updates["log_path"] = log.LogID(executionID, deviceID, result.Attempt)
+	} else if logContent != "" {
+		logID := log.LogID(executionID, deviceID, result.Attempt)
+		if err := s.logs.WriteEncodedLog(logID, logContent); err != nil {
+			return err
 		}
+		updates["log_path"] = logID
+	}
+	// 上传了完整日志的Agent上报的是输出预览，直接保存；旧版Agent的流式分片完整到达时保留已追加的输出
+	if logUploaded || streamSeq == 0 || result.OutputSeq != streamSeq {
+		updates["output"] = previewOutput(output)
+	}
+
+	// 以reported_at和状态为条件更新，并发重放或服务端同时关闭结果时只有一次生效
+	update := s.db.Model(&models.ExecutionResult{}).
+		Where("id = ? AND reported_at IS NULL AND status IN ?", result.ID,
+			[]string{models.ResultStatusPending, models.ResultStatusRunning}).
+		Updates(updates)
+	if update.Error != nil {
+		return update.Error
+	}
+	if update.RowsAffected == 0 {
+		return nil
 	}
 
-	if allCompleted {
-		executionStatus := models.ExecutionStatusCompleted
-		if hasFailure {
-			executionStatus = models.ExecutionStatusFailed
+	// 没有上报完整日志时，以流式追加的日志作为最终日志
+	if !logUploaded && logContent == "" && result.OutputSeq > 0 {
+		logID := log.LogID(executionID, deviceID, result.Attempt)
+		if err := s.logs.CommitLog(logID); err != nil {
+			logrus.Errorf("Failed to commit log %s: %v", logID, err)
 		}
+	}
 
-		completedAt := time.Now()
-		s.db.Model(&execution).Updates(map[string]interface{}{
-			"status":       executionStatus,
-			"completed_at": &completedAt,
-		})
+	s.events.CommandResult(result, status, exitCode, "agent")
+	s.db.Model(&models.Device{}).Where("id = ? AND status = ?", deviceID, models.StatusBusy).Update("status", models.StatusOnline)
 
-		s.db.Model(&models.Command{}).Where("id = ?", execution.CommandID).Update("status", executionStatus)
+	if err := s.executions.Finalize(executionID); err != nil {
+		return err
+	}
+
+	// 释放了设备并发名额、锁键或命令并发名额，唤醒可能在等待的设备
+	s.notifier.Notify(deviceID)
+	if err := s.executions.NotifyQueued(executionID); err != nil {
+		logrus.Errorf("Failed to notify queued devices of execution %s: %v", executionID, err)
 	}
 
 	return nil
 }
 
-func (s *Service) saveLogFile(executionID, deviceID, content string) string {
-	return "/var/cslite/files/logs/" + executionID + "_" + deviceID + ".log"
+// previewOutput 截断输出，只保留不超过outputPreviewLimit字节的预览
+func previewOutput(output string) string {
+	if len(output) <= outputPreviewLimit {
+		return output
+	}
+	return strings.ToValidUTF8(output[:outputPreviewLimit], "") + "\n... (truncated)"
+}
+
+// findResult 查找设备在执行中的结果，attempt为0时（旧版Agent）取最后一次执行
+func (s *Service) findResult(executionID, deviceID string, attempt int) (*models.ExecutionResult, error) {
+	query := s.db.Where("execution_id = ? AND device_id = ?", executionID, deviceID)
+	if attempt > 0 {
+		query = query.Where("attempt = ?", attempt)
+	} else {
+		query = query.Order("attempt DESC")
+	}
+
+	var result models.ExecutionResult
+	if err := query.First(&result).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrResultNotFound
+		}
+		return nil, err
+	}
+	return &result, nil
+}
+
+// 控制指令动作
+const (
+	ControlActionCancel = "cancel" // 终止正在执行的进程或丢弃排队中的任务，并上报cancelled
+	ControlActionPause  = "pause"  // 暂缓执行排队中的任务，指令消失后恢复
+)
+
+// 已下发且未结束的结果状态，计入设备与命令的并发数
+var (
+	activeResultStatuses = []string{models.ResultStatusPending, models.ResultStatusRunning}
+	activeDeliveryStates = []string{models.DeliveryStateDelivered, models.DeliveryStateAcknowledged, models.DeliveryStateRunning}
+)
+
+// controlRetention 已取消的结果继续下发取消指令的时长
+const controlRetention = 10 * time.Minute
+
+// outputPreviewLimit 执行结果中保存的输出预览上限（字节），完整输出保存在日志中
+const outputPreviewLimit = 10000
+
+type ControlMessage struct {
+	ExecutionID string `json:"execution_id"`
+	CommandID   string `json:"command_id"`
+	Action      string `json:"action"`
+}
+
+type DeliveryAck struct {
+	ExecutionID string `json:"execution_id"`
+	Attempt     int    `json:"attempt"`
 }
 
 type CommandTask struct {
 	CommandID   string            `json:"command_id"`
 	ExecutionID string            `json:"execution_id"`
+	Attempt     int               `json:"attempt"`
+	Interpreter string            `json:"interpreter,omitempty"`
 	Content     string            `json:"content"`
+	Script      string            `json:"script,omitempty"`
+	Args        []string          `json:"args,omitempty"`
+	RunAs       string            `json:"run_as,omitempty"`
+	RunAsGroup  string            `json:"run_as_group,omitempty"`
+	WorkingDir  string            `json:"working_dir,omitempty"`
+	Umask       string            `json:"umask,omitempty"`
 	Timeout     int               `json:"timeout"`
 	EnvVars     map[string]string `json:"env_vars"`
+	LockKey     string            `json:"lock_key,omitempty"`
+
+	ResourceLimits *models.ResourceLimits `json:"resource_limits,omitempty"`
 }
@@ -0,0 +1,659 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/log"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// newTestService 创建测试服务，预置管理员、在线设备dev_1/dev_2及其Agent agt_1/agt_2，以及执行中的命令cmd_1
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	config.AppConfig = &config.Config{FileDir: t.TempDir(), DeliveryLease: 60}
+	db := testutil.OpenDB(t)
+
+	db.Create(&models.User{ID: 1, Username: "admin", Password: "x", Role: models.RoleAdmin})
+	for _, id := range []string{"1", "2"} {
+		db.Create(&models.Device{ID: "dev_" + id, Name: "web-0" + id, Platform: "linux", OwnerID: 1, Status: models.StatusOnline})
+		db.Create(&models.Agent{ID: "agt_" + id, DeviceID: "dev_" + id})
+	}
+	createCommand(t, db, &models.Command{ID: "cmd_1"})
+	return NewService(), db
+}
+
+// createCommand 创建立即执行的命令，未设置的字段使用默认值
+func createCommand(t *testing.T, db *gorm.DB, command *models.Command) {
+	t.Helper()
+	if command.Name == "" {
+		command.Name = command.ID
+	}
+	if command.Type == "" {
+		command.Type = models.CommandTypeImmediate
+	}
+	if command.Content == "" {
+		command.Content = "uptime"
+	}
+	if command.Status == "" {
+		command.Status = models.CommandStatusRunning
+	}
+	command.TargetType = models.TargetTypeDevices
+	command.CreatedBy = 1
+	if err := db.Create(command).Error; err != nil {
+		t.Fatalf("create command: %v", err)
+	}
+}
+
+// createExecution 创建命令的一次执行，每台设备一条已下发的结果
+func createExecution(t *testing.T, db *gorm.DB, commandID, executionID string, deviceIDs ...string) {
+	t.Helper()
+	if err := db.Create(&models.Execution{ID: executionID, CommandID: commandID, Status: models.ExecutionStatusPending}).Error; err != nil {
+		t.Fatalf("create execution: %v", err)
+	}
+	for _, deviceID := range deviceIDs {
+		result := &models.ExecutionResult{
+			ID:            "res_" + executionID + "_" + deviceID,
+			ExecutionID:   executionID,
+			DeviceID:      deviceID,
+			Attempt:       1,
+			Status:        models.ResultStatusPending,
+			DeliveryState: models.DeliveryStateDelivered,
+		}
+		if err := db.Create(result).Error; err != nil {
+			t.Fatalf("create result: %v", err)
+		}
+	}
+}
+
+func TestAppendOutput(t *testing.T) {
+	s, db := newTestService(t)
+	createExecution(t, db, "cmd_1", "exec_1", "dev_1", "dev_2")
+
+	chunks := []struct {
+		seq  int
+		data string
+	}{
+		{1, "line 1\n"},
+		{1, "line 1\n"}, // 重复的分片
+		{3, "line 3\n"}, // 跳号的分片
+		{2, "line 2\n"},
+		{3, "line 3\n"},
+	}
+	for _, c := range chunks {
+		if err := s.AppendOutput("exec_1", "dev_1", 1, c.seq, c.data); err != nil {
+			t.Fatalf("AppendOutput seq %d error: %v", c.seq, err)
+		}
+	}
+
+	var result models.ExecutionResult
+	db.First(&result, "id = ?", "res_exec_1_dev_1")
+	want := "line 1\nline 2\nline 3\n"
+	if result.Status != models.ResultStatusRunning || result.OutputSeq != 3 || result.Output != want {
+		t.Errorf("result status = %s, seq = %d, output = %q", result.Status, result.OutputSeq, result.Output)
+	}
+	if result.LogPath != "exec_1_dev_1.log" {
+		t.Errorf("log path = %q", result.LogPath)
+	}
+	data, _ := os.ReadFile(filepath.Join(config.AppConfig.FileDir, "logs", result.LogPath))
+	if string(data) != want {
+		t.Errorf("log = %q, want %q", data, want)
+	}
+
+	var execution models.Execution
+	db.First(&execution, "id = ?", "exec_1")
+	if execution.Status != models.ExecutionStatusRunning {
+		t.Errorf("execution status = %s, want running", execution.Status)
+	}
+
+	if err := s.AppendOutput("exec_1", "dev_9", 1, 1, "x"); err != ErrResultNotFound {
+		t.Errorf("AppendOutput unknown device error = %v, want ErrResultNotFound", err)
+	}
+	if err := s.AppendOutput("exec_9", "dev_1", 1, 1, "x"); err != ErrExecutionNotFound {
+		t.Errorf("AppendOutput unknown execution error = %v, want ErrExecutionNotFound", err)
+	}
+}
+
+func TestAppendOutputLogFailure(t *testing.T) {
+	s, db := newTestService(t)
+	createExecution(t, db, "cmd_1", "exec_1", "dev_1")
+
+	// 日志路径被目录占用时追加失败，序号保持不变
+	blocked := filepath.Join(config.AppConfig.FileDir, "logs", "exec_1_dev_1.log")
+	if err := os.MkdirAll(blocked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendOutput("exec_1", "dev_1", 1, 1, "line 1\n"); err == nil {
+		t.Fatal("AppendOutput succeeded with unwritable log")
+	}
+
+	var result models.ExecutionResult
+	db.First(&result, "id = ?", "res_exec_1_dev_1")
+	if result.OutputSeq != 0 || result.Status != models.ResultStatusPending {
+		t.Errorf("after failed append seq = %d, status = %s", result.OutputSeq, result.Status)
+	}
+
+	// 重试原序号的分片不会留下缺口
+	os.Remove(blocked)
+	if err := s.AppendOutput("exec_1", "dev_1", 1, 1, "line 1\n"); err != nil {
+		t.Fatalf("retry error: %v", err)
+	}
+	if err := s.AppendOutput("exec_1", "dev_1", 1, 2, "line 2\n"); err != nil {
+		t.Fatalf("AppendOutput error: %v", err)
+	}
+	data, _ := os.ReadFile(blocked)
+	if string(data) != "line 1\nline 2\n" {
+		t.Errorf("log = %q", data)
+	}
+}
+
+func TestAppendOutputPreviewLimit(t *testing.T) {
+	s, db := newTestService(t)
+	createExecution(t, db, "cmd_1", "exec_1", "dev_1")
+
+	chunk := strings.Repeat("x", outputPreviewLimit/2+1)
+	for seq := 1; seq <= 3; seq++ {
+		if err := s.AppendOutput("exec_1", "dev_1", 1, seq, chunk); err != nil {
+			t.Fatalf("AppendOutput error: %v", err)
+		}
+	}
+
+	var result models.ExecutionResult
+	db.First(&result, "id = ?", "res_exec_1_dev_1")
+	if result.OutputSeq != 3 || result.Output != previewOutput(chunk+chunk) {
+		t.Errorf("seq = %d, output length = %d", result.OutputSeq, len(result.Output))
+	}
+}
+
+func TestReportResultLog(t *testing.T) {
+	s, db := newTestService(t)
+	createExecution(t, db, "cmd_1", "exec_1", "dev_1", "dev_2")
+	logDir := filepath.Join(config.AppConfig.FileDir, "logs")
+
+	// 上报的完整日志覆盖流式追加的内容
+	s.AppendOutput("exec_1", "dev_1", 1, 1, "partial\n")
+	full := base64.StdEncoding.EncodeToString([]byte("line 1\nline 2\n"))
+	if err := s.ReportResult("exec_1", "dev_1", 1, models.ResultStatusCompleted, 0, "line 1\nline 2\n", full, false, 1, nil); err != nil {
+		t.Fatalf("ReportResult error: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(logDir, "exec_1_dev_1.log"))
+	if string(data) != "line 1\nline 2\n" {
+		t.Errorf("log = %q", data)
+	}
+
+	// 重放的上报不再覆盖已保存的结果
+	if err := s.ReportResult("exec_1", "dev_1", 1, models.ResultStatusFailed, 1, "", "", false, 0, nil); err != nil {
+		t.Fatalf("replayed ReportResult error: %v", err)
+	}
+	var result models.ExecutionResult
+	db.First(&result, "id = ?", "res_exec_1_dev_1")
+	if result.Status != models.ResultStatusCompleted || result.LogPath != "exec_1_dev_1.log" || result.ReportedAt == nil {
+		t.Errorf("result status = %s, log path = %q, reported_at = %v", result.Status, result.LogPath, result.ReportedAt)
+	}
+
+	// 无法解码的日志返回错误，结果保持未上报
+	if err := s.ReportResult("exec_1", "dev_2", 1, models.ResultStatusCompleted, 0, "", "not base64!", false, 0, nil); err != log.ErrInvalidLogContent {
+		t.Errorf("ReportResult invalid log error = %v, want ErrInvalidLogContent", err)
+	}
+	var rejected models.ExecutionResult
+	db.First(&rejected, "id = ?", "res_exec_1_dev_2")
+	if rejected.ReportedAt != nil || rejected.LogPath != "" {
+		t.Errorf("result reported with invalid log, status = %s, log path = %q", rejected.Status, rejected.LogPath)
+	}
+}
+
+func TestGetControls(t *testing.T) {
+	s, db := newTestService(t)
+	createCommand(t, db, &models.Command{ID: "cmd_paused", Status: models.CommandStatusPaused})
+	createCommand(t, db, &models.Command{ID: "cmd_cancelled", Status: models.CommandStatusCancelled})
+
+	createExecution(t, db, "cmd_1", "exec_running", "dev_1")
+	createExecution(t, db, "cmd_paused", "exec_paused", "dev_1", "dev_2")
+	createExecution(t, db, "cmd_paused", "exec_paused_done", "dev_1")
+	createExecution(t, db, "cmd_cancelled", "exec_cancelled", "dev_1")
+	createExecution(t, db, "cmd_cancelled", "exec_cancelled_old", "dev_1")
+
+	// 已结束的结果不再下发暂停指令；刚取消的结果继续下发取消指令，较早取消的不再下发
+	now := time.Now()
+	old := now.Add(-controlRetention - time.Minute)
+	db.Model(&models.ExecutionResult{}).Where("execution_id = ?", "exec_paused_done").Update("status", models.ResultStatusCompleted)
+	db.Model(&models.ExecutionResult{}).Where("execution_id = ?", "exec_cancelled").
+		Updates(map[string]interface{}{"status": models.ResultStatusCancelled, "completed_at": now})
+	db.Model(&models.ExecutionResult{}).Where("execution_id = ?", "exec_cancelled_old").
+		Updates(map[string]interface{}{"status": models.ResultStatusCancelled, "completed_at": old})
+
+	tasks, controls, err := s.GetPendingCommands("agt_1", -1)
+	if err != nil {
+		t.Fatalf("GetPendingCommands error: %v", err)
+	}
+	if len(tasks) != 0 {
+		t.Errorf("got %d tasks for delivered results", len(tasks))
+	}
+
+	got := make(map[string]string)
+	for _, control := range controls {
+		got[control.ExecutionID] = control.Action
+	}
+	want := map[string]string{"exec_paused": ControlActionPause, "exec_cancelled": ControlActionCancel}
+	if len(got) != len(want) || got["exec_paused"] != want["exec_paused"] || got["exec_cancelled"] != want["exec_cancelled"] {
+		t.Errorf("controls = %v, want %v", got, want)
+	}
+}
+
+func TestGetPendingCommandsWaitsForRetryBackoff(t *testing.T) {
+	s, db := newTestService(t)
+	db.Create(&models.Execution{ID: "exec_1", CommandID: "cmd_1", Status: models.ExecutionStatusPending})
+
+	later := time.Now().Add(time.Minute)
+	db.Create(&models.ExecutionResult{ID: "res_1", ExecutionID: "exec_1", DeviceID: "dev_1", Attempt: 1,
+		Status: models.ResultStatusFailed, DeliveryState: models.DeliveryStateDone})
+	db.Create(&models.ExecutionResult{ID: "res_2", ExecutionID: "exec_1", DeviceID: "dev_1", Attempt: 2,
+		Status: models.ResultStatusPending, NotBefore: &later})
+
+	tasks, _, err := s.GetPendingCommands("agt_1", -1)
+	if err != nil || len(tasks) != 0 {
+		t.Fatalf("GetPendingCommands before backoff = %d tasks, %v", len(tasks), err)
+	}
+
+	db.Model(&models.ExecutionResult{}).Where("id = ?", "res_2").Update("not_before", time.Now().Add(-time.Second))
+	tasks, _, err = s.GetPendingCommands("agt_1", -1)
+	if err != nil || len(tasks) != 1 || tasks[0].Attempt != 2 {
+		t.Fatalf("GetPendingCommands after backoff = %+v, %v", tasks, err)
+	}
+}
+
+func TestReportResultReplay(t *testing.T) {
+	s, db := newTestService(t)
+	createExecution(t, db, "cmd_1", "exec_1", "dev_1", "dev_2")
+
+	// Agent重放缓存的结果时保留首次上报
+	if err := s.ReportResult("exec_1", "dev_1", 1, models.ResultStatusCompleted, 0, "ok\n", "", false, 0, nil); err != nil {
+		t.Fatalf("ReportResult error: %v", err)
+	}
+	if err := s.ReportResult("exec_1", "dev_1", 1, models.ResultStatusCompleted, 0, "replayed\n", "", false, 0, nil); err != nil {
+		t.Fatalf("replayed ReportResult error: %v", err)
+	}
+	var result models.ExecutionResult
+	db.First(&result, "id = ?", "res_exec_1_dev_1")
+	if result.Output != "ok\n" || result.DeliveryState != models.DeliveryStateDone {
+		t.Errorf("result output = %q, delivery state = %s", result.Output, result.DeliveryState)
+	}
+
+	// 服务端已判定超时的结果不被迟到的上报覆盖，只记录设备事件
+	db.Model(&models.ExecutionResult{}).Where("id = ?", "res_exec_1_dev_2").
+		Updates(map[string]interface{}{"status": models.ResultStatusTimeout, "delivery_state": models.DeliveryStateDone})
+	if err := s.ReportResult("exec_1", "dev_2", 1, models.ResultStatusCompleted, 0, "late\n", "", false, 0, nil); err != nil {
+		t.Fatalf("late ReportResult error: %v", err)
+	}
+	var late models.ExecutionResult
+	db.First(&late, "id = ?", "res_exec_1_dev_2")
+	if late.Status != models.ResultStatusTimeout || late.ReportedAt != nil || late.Output != "" {
+		t.Errorf("late report overwrote result: status = %s, output = %q", late.Status, late.Output)
+	}
+
+	var events []models.DeviceEvent
+	db.Where("device_id = ? AND type = ?", "dev_2", models.DeviceEventCommandResult).Find(&events)
+	if len(events) != 1 || !strings.Contains(string(events[0].Details), `"source":"late"`) {
+		t.Errorf("late report events = %+v", events)
+	}
+}
+
+func TestWaitForCommands(t *testing.T) {
+	s, db := newTestService(t)
+
+	// 没有任务时等待到超时
+	start := time.Now()
+	tasks, _, err := s.WaitForCommands(context.Background(), "agt_1", -1, 50*time.Millisecond)
+	if err != nil || len(tasks) != 0 || time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("WaitForCommands = %d tasks, %v after %v", len(tasks), err, time.Since(start))
+	}
+
+	// 下发新任务后立即返回
+	done := make(chan []*CommandTask)
+	go func() {
+		tasks, _, _ := s.WaitForCommands(context.Background(), "agt_1", -1, 10*time.Second)
+		done <- tasks
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	db.Create(&models.Execution{ID: "exec_1", CommandID: "cmd_1", Status: models.ExecutionStatusPending})
+	db.Create(&models.ExecutionResult{ID: "res_1", ExecutionID: "exec_1", DeviceID: "dev_1", Attempt: 1, Status: models.ResultStatusPending})
+	s.notifier.Notify("dev_1")
+
+	select {
+	case tasks := <-done:
+		if len(tasks) != 1 || tasks[0].ExecutionID != "exec_1" {
+			t.Errorf("woken with tasks %+v", tasks)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForCommands was not woken by notification")
+	}
+
+	if _, _, err := s.WaitForCommands(context.Background(), "agt_9", -1, time.Second); err != ErrAgentNotFound {
+		t.Errorf("unknown agent error = %v, want ErrAgentNotFound", err)
+	}
+}
+
+func TestGetPendingCommandsLease(t *testing.T) {
+	s, db := newTestService(t)
+	db.Create(&models.Execution{ID: "exec_1", CommandID: "cmd_1", Status: models.ExecutionStatusPending})
+	db.Create(&models.Execution{ID: "exec_2", CommandID: "cmd_1", Status: models.ExecutionStatusPending})
+	db.Create(&models.ExecutionResult{ID: "res_1", ExecutionID: "exec_1", DeviceID: "dev_1", Attempt: 1, Status: models.ResultStatusPending})
+	db.Create(&models.ExecutionResult{ID: "res_2", ExecutionID: "exec_2", DeviceID: "dev_1", Attempt: 1, Status: models.ResultStatusPending})
+
+	tasks, _, err := s.GetPendingCommands("agt_1", -1)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("first poll = %d tasks, %v", len(tasks), err)
+	}
+	var device models.Device
+	db.First(&device, "id = ?", "dev_1")
+	if device.Status != models.StatusBusy {
+		t.Errorf("device status = %s, want busy", device.Status)
+	}
+
+	// 租约有效期内不重复下发
+	if tasks, _, _ := s.GetPendingCommands("agt_1", -1); len(tasks) != 0 {
+		t.Fatalf("second poll redelivered %d tasks", len(tasks))
+	}
+
+	// 确认收到的任务不再下发，租约到期仍未确认的重新下发
+	acked, err := s.Acknowledge("agt_1", []DeliveryAck{{ExecutionID: "exec_1", Attempt: 1}, {ExecutionID: "exec_9", Attempt: 1}})
+	if err != nil || acked != 1 {
+		t.Fatalf("Acknowledge = %d, %v", acked, err)
+	}
+	db.Model(&models.ExecutionResult{}).Where("device_id = ?", "dev_1").Update("lease_until", time.Now().Add(-time.Second))
+
+	tasks, _, err = s.GetPendingCommands("agt_1", -1)
+	if err != nil || len(tasks) != 1 || tasks[0].ExecutionID != "exec_2" {
+		t.Fatalf("poll after lease expiry = %+v, %v", tasks, err)
+	}
+
+	var results []models.ExecutionResult
+	db.Order("id").Find(&results)
+	if results[0].DeliveryState != models.DeliveryStateAcknowledged || results[0].AckedAt == nil || results[0].DeliveryCount != 1 {
+		t.Errorf("acknowledged result = %s, count %d", results[0].DeliveryState, results[0].DeliveryCount)
+	}
+	if results[1].DeliveryState != models.DeliveryStateDelivered || results[1].DeliveryCount != 2 {
+		t.Errorf("redelivered result = %s, count %d", results[1].DeliveryState, results[1].DeliveryCount)
+	}
+}
+
+func TestGetPendingCommandsCapacity(t *testing.T) {
+	s, db := newTestService(t)
+	for _, id := range []string{"1", "2", "3"} {
+		db.Create(&models.Execution{ID: "exec_" + id, CommandID: "cmd_1", Status: models.ExecutionStatusPending})
+		db.Create(&models.ExecutionResult{ID: "res_" + id, ExecutionID: "exec_" + id, DeviceID: "dev_1", Attempt: 1, Status: models.ResultStatusPending})
+	}
+
+	// 本地队列已满时只返回控制指令
+	if tasks, _, err := s.GetPendingCommands("agt_1", 0); err != nil || len(tasks) != 0 {
+		t.Fatalf("poll with no capacity = %d tasks, %v", len(tasks), err)
+	}
+	if tasks, _, _ := s.GetPendingCommands("agt_1", 2); len(tasks) != 2 {
+		t.Fatalf("poll with capacity 2 = %d tasks", len(tasks))
+	}
+
+	// 离线设备不下发任务
+	db.Model(&models.Device{}).Where("id = ?", "dev_1").Update("status", models.StatusOffline)
+	if _, _, err := s.GetPendingCommands("agt_1", -1); err != ErrDeviceOffline {
+		t.Errorf("offline poll error = %v, want ErrDeviceOffline", err)
+	}
+}
+
+// queueResult 为设备创建一条等待下发的结果
+func queueResult(t *testing.T, db *gorm.DB, commandID, executionID, deviceID string) {
+	t.Helper()
+	db.FirstOrCreate(&models.Execution{}, models.Execution{ID: executionID, CommandID: commandID, Status: models.ExecutionStatusPending})
+	result := &models.ExecutionResult{
+		ID:            "res_" + executionID + "_" + deviceID,
+		ExecutionID:   executionID,
+		DeviceID:      deviceID,
+		Attempt:       1,
+		Status:        models.ResultStatusPending,
+		DeliveryState: models.DeliveryStateQueued,
+	}
+	if err := db.Create(result).Error; err != nil {
+		t.Fatalf("create result: %v", err)
+	}
+}
+
+func finishResult(db *gorm.DB, executionID, deviceID string) {
+	db.Model(&models.ExecutionResult{}).Where("execution_id = ? AND device_id = ?", executionID, deviceID).
+		Update("status", models.ResultStatusCompleted)
+}
+
+func taskIDs(tasks []*CommandTask) []string {
+	var ids []string
+	for _, task := range tasks {
+		ids = append(ids, task.ExecutionID)
+	}
+	return ids
+}
+
+func TestGetPendingCommandsLockKey(t *testing.T) {
+	s, db := newTestService(t)
+	createCommand(t, db, &models.Command{ID: "cmd_apt1", LockKey: "apt"})
+	createCommand(t, db, &models.Command{ID: "cmd_apt2", LockKey: "apt"})
+	queueResult(t, db, "cmd_apt1", "exec_apt1", "dev_1")
+	queueResult(t, db, "cmd_apt2", "exec_apt2", "dev_1")
+	queueResult(t, db, "cmd_1", "exec_1", "dev_1")
+	queueResult(t, db, "cmd_apt2", "exec_apt2", "dev_2")
+
+	// 同一次拉取中锁键相同的任务只下发一个，不同设备之间互不影响
+	tasks, _, err := s.GetPendingCommands("agt_1", -1)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("first poll = %v, %v, want 2 tasks", taskIDs(tasks), err)
+	}
+	var locked string
+	for _, task := range tasks {
+		if task.LockKey == "apt" {
+			locked = task.ExecutionID
+		}
+	}
+	if locked == "" {
+		t.Fatalf("first poll = %v, want one apt task", taskIDs(tasks))
+	}
+	if tasks, _, _ := s.GetPendingCommands("agt_2", -1); len(tasks) != 1 {
+		t.Errorf("dev_2 poll = %v, want exec_apt2", taskIDs(tasks))
+	}
+
+	// 持有锁键的任务结束前不下发另一个
+	if tasks, _, _ := s.GetPendingCommands("agt_1", -1); len(tasks) != 0 {
+		t.Fatalf("poll while locked = %v, want none", taskIDs(tasks))
+	}
+	finishResult(db, locked, "dev_1")
+	tasks, _, _ = s.GetPendingCommands("agt_1", -1)
+	if len(tasks) != 1 || tasks[0].LockKey != "apt" || tasks[0].ExecutionID == locked {
+		t.Errorf("poll after unlock = %v, want the other apt task", taskIDs(tasks))
+	}
+}
+
+func TestGetPendingCommandsConcurrency(t *testing.T) {
+	s, db := newTestService(t)
+	createCommand(t, db, &models.Command{ID: "cmd_batch", Concurrency: 1})
+	queueResult(t, db, "cmd_batch", "exec_batch", "dev_1")
+	queueResult(t, db, "cmd_batch", "exec_batch", "dev_2")
+
+	// 命令限制同时执行的设备数为1，dev_1结束后才下发给dev_2
+	if tasks, _, err := s.GetPendingCommands("agt_1", -1); err != nil || len(tasks) != 1 {
+		t.Fatalf("dev_1 poll = %v, %v, want 1 task", taskIDs(tasks), err)
+	}
+	if tasks, _, _ := s.GetPendingCommands("agt_2", -1); len(tasks) != 0 {
+		t.Fatalf("dev_2 poll = %v, want none", taskIDs(tasks))
+	}
+	finishResult(db, "exec_batch", "dev_1")
+	if tasks, _, _ := s.GetPendingCommands("agt_2", -1); len(tasks) != 1 {
+		t.Errorf("dev_2 poll after dev_1 finished = %v, want 1 task", taskIDs(tasks))
+	}
+}
+
+func TestGetPendingCommandsMaxConcurrency(t *testing.T) {
+	s, db := newTestService(t)
+	db.Model(&models.Device{}).Where("id = ?", "dev_1").Update("max_concurrency", 2)
+	for _, id := range []string{"exec_1", "exec_2", "exec_3"} {
+		queueResult(t, db, "cmd_1", id, "dev_1")
+	}
+
+	// 设备并发上限与Agent剩余容量取较小值
+	if tasks, _, _ := s.GetPendingCommands("agt_1", 1); len(tasks) != 1 {
+		t.Fatalf("poll with capacity 1 = %v, want 1 task", taskIDs(tasks))
+	}
+	tasks, _, _ := s.GetPendingCommands("agt_1", -1)
+	if len(tasks) != 1 {
+		t.Fatalf("poll with one slot left = %v, want 1 task", taskIDs(tasks))
+	}
+	if tasks, _, _ := s.GetPendingCommands("agt_1", -1); len(tasks) != 0 {
+		t.Fatalf("poll at max concurrency = %v, want none", taskIDs(tasks))
+	}
+	finishResult(db, tasks[0].ExecutionID, "dev_1")
+	if tasks, _, _ := s.GetPendingCommands("agt_1", -1); len(tasks) != 1 {
+		t.Errorf("poll after one finished = %v, want 1 task", taskIDs(tasks))
+	}
+}
+
+func TestGetPendingCommandsEnvVars(t *testing.T) {
+	s, db := newTestService(t)
+	db.Create(&models.Group{ID: "grp_web", Name: "web", CreatedBy: 1, EnvVars: datatypes.JSON(`{"REGION":"cn","TIER":"web","LEVEL":"group"}`)})
+	db.Model(&models.Device{}).Where("id = ?", "dev_1").
+		Updates(map[string]interface{}{"group_id": "grp_web", "env_vars": datatypes.JSON(`{"LEVEL":"device","HOST":"web-01"}`)})
+	createCommand(t, db, &models.Command{ID: "cmd_env", EnvVars: datatypes.JSON(`{"TIER":"command"}`)})
+	queueResult(t, db, "cmd_env", "exec_env", "dev_1")
+
+	// 分组、设备、命令依次覆盖同名变量
+	tasks, _, err := s.GetPendingCommands("agt_1", -1)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("poll = %v, %v", taskIDs(tasks), err)
+	}
+	want := map[string]string{"REGION": "cn", "TIER": "command", "LEVEL": "device", "HOST": "web-01"}
+	if got := tasks[0].EnvVars; len(got) != len(want) {
+		t.Errorf("env vars = %v, want %v", got, want)
+	} else {
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("env %s = %q, want %q", key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestUploadLogClosedResult(t *testing.T) {
+	s, db := newTestService(t)
+	createExecution(t, db, "cmd_1", "exec_1", "dev_1", "dev_2")
+	logDir := filepath.Join(config.AppConfig.FileDir, "logs")
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte("full log\n"))
+	writer.Close()
+	data := buf.Bytes()
+
+	// 上传完成并上报后，重放的上传不再覆盖日志
+	if _, err := s.UploadLog("exec_1", "dev_1", 1, 0, data, true); err != nil {
+		t.Fatalf("UploadLog error: %v", err)
+	}
+	if err := s.ReportResult("exec_1", "dev_1", 1, models.ResultStatusCompleted, 0, "full log\n", "", true, 0, nil); err != nil {
+		t.Fatalf("ReportResult error: %v", err)
+	}
+	var replay bytes.Buffer
+	writer = gzip.NewWriter(&replay)
+	writer.Write([]byte("replayed\n"))
+	writer.Close()
+	if _, err := s.UploadLog("exec_1", "dev_1", 1, 0, replay.Bytes(), true); err != ErrResultClosed {
+		t.Errorf("UploadLog after report error = %v, want ErrResultClosed", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(logDir, "exec_1_dev_1.log")); string(got) != "full log\n" {
+		t.Errorf("log = %q", got)
+	}
+
+	// 上传过程中结果被判定超时，丢弃已接收的分片
+	if _, err := s.UploadLog("exec_1", "dev_2", 1, 0, data[:4], false); err != nil {
+		t.Fatalf("UploadLog first part error: %v", err)
+	}
+	db.Model(&models.ExecutionResult{}).Where("id = ?", "res_exec_1_dev_2").Update("status", models.ResultStatusTimeout)
+	if _, err := s.UploadLog("exec_1", "dev_2", 1, 4, data[4:], true); err != ErrResultClosed {
+		t.Errorf("UploadLog after timeout error = %v, want ErrResultClosed", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.AppConfig.FileDir, "uploads", "exec_1_dev_2.log.gz.part")); !os.IsNotExist(err) {
+		t.Errorf("part file not removed: %v", err)
+	}
+}
+
+func TestHeartbeatMetrics(t *testing.T) {
+	s, db := newTestService(t)
+	config.AppConfig.MetricsEnabled = true
+
+	metrics := &HeartbeatMetrics{
+		CPUUsage:    37.5,
+		MemoryUsed:  1024,
+		MemoryTotal: 4096,
+		SwapUsed:    16,
+		NetworkIn:   120,
+		NetworkOut:  30,
+		Load1:       0.75,
+		Uptime:      3600,
+		Disks:       []DiskMetrics{{Mountpoint: "/", Fstype: "ext4", TotalMB: 20480, UsedMB: 10240, Usage: 50}},
+		Interfaces:  []InterfaceMetrics{{Name: "eth0", RxBytes: 1 << 20, TxBytes: 1 << 10, RxRate: 120, TxRate: 30}},
+	}
+	if err := s.Heartbeat("agt_1", metrics, "10.0.0.5", 0); err != nil {
+		t.Fatalf("Heartbeat error: %v", err)
+	}
+
+	// 最新指标完整保存在Agent上，指标历史只保留汇总字段
+	var agent models.Agent
+	db.First(&agent, "id = ?", "agt_1")
+	var latest HeartbeatMetrics
+	json.Unmarshal([]byte(agent.HeartbeatMetrics), &latest)
+	if latest.Uptime != 3600 || len(latest.Disks) != 1 || latest.Disks[0].Mountpoint != "/" || len(latest.Interfaces) != 1 || latest.Interfaces[0].RxRate != 120 {
+		t.Errorf("latest metrics = %+v", latest)
+	}
+
+	var samples []models.MetricSample
+	db.Where("device_id = ?", "dev_1").Find(&samples)
+	if len(samples) != 1 || samples[0].CPUUsage != 37.5 || samples[0].MemoryTotal != 4096 || samples[0].NetworkIn != 120 || samples[0].Load1 != 0.75 {
+		t.Errorf("samples = %+v", samples)
+	}
+
+	var device models.Device
+	db.First(&device, "id = ?", "dev_1")
+	if device.IPAddress != "10.0.0.5" {
+		t.Errorf("ip address = %q", device.IPAddress)
+	}
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	s, db := newTestService(t)
+	config.AppConfig.HeartbeatInterval = 60
+
+	// Agent上报的间隔较长时，按上报间隔判断是否错过心跳
+	db.Model(&models.Agent{}).Where("id = ?", "agt_1").Update("last_heartbeat", time.Now().Add(-3*time.Minute))
+	if err := s.Heartbeat("agt_1", nil, "", 120); err != nil {
+		t.Fatalf("Heartbeat error: %v", err)
+	}
+	db.Model(&models.Agent{}).Where("id = ?", "agt_1").Update("last_heartbeat", time.Now().Add(-5*time.Minute))
+	s.Heartbeat("agt_1", nil, "", 120)
+
+	var gaps int64
+	db.Model(&models.DeviceEvent{}).Where("device_id = ? AND type = ?", "dev_1", models.DeviceEventHeartbeatGap).Count(&gaps)
+	if gaps != 1 {
+		t.Errorf("heartbeat gap events = %d, want 1", gaps)
+	}
+
+	// 旧版Agent不上报间隔时保留已记录的值
+	s.Heartbeat("agt_1", nil, "", 0)
+	var device models.Device
+	db.First(&device, "id = ?", "dev_1")
+	if device.HeartbeatInterval != 120 {
+		t.Errorf("heartbeat interval = %d, want 120", device.HeartbeatInterval)
+	}
+}
@@ -0,0 +1,14 @@
+// alert 包提供了告警规则管理、告警评估与静默服务
+package alert
+
+import "errors"
+
+// 告警相关的错误定义
+var (
+	ErrRuleNotFound    = errors.New("alert rule not found")    // 告警规则不存在
+	ErrInvalidRule     = errors.New("invalid alert rule")      // 告警规则参数无效
+	ErrGroupNotFound   = errors.New("group not found")         // 目标分组不存在
+	ErrDeviceNotFound  = errors.New("device not found")        // 目标设备不存在
+	ErrSilenceNotFound = errors.New("alert silence not found") // 静默不存在
+	ErrInvalidSilence  = errors.New("invalid alert silence")   // 静默参数无效
+)
@@ -0,0 +1,316 @@
+package alert
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/XRSec/Cslite/internal/device"
+	"github.com/XRSec/Cslite/models"
+	"github.com/sirupsen/logrus"
+)
+
+// heartbeatMetrics 评估所需的心跳指标字段
+type heartbeatMetrics struct {
+	CPUUsage    float64 `json:"cpu_usage"`
+	MemoryUsed  int     `json:"memory_used"`
+	MemoryTotal int     `json:"memory_total"`
+	SwapUsed    int     `json:"swap_used"`
+	SwapTotal   int     `json:"swap_total"`
+	DiskUsage   float64 `json:"disk_usage"`
+	NetworkIn   int     `json:"network_in"`
+	NetworkOut  int     `json:"network_out"`
+	Load1       float64 `json:"load_1"`
+	Load5       float64 `json:"load_5"`
+	Load15      float64 `json:"load_15"`
+	Disks       []struct {
+		Usage float64 `json:"usage"`
+	} `json:"disks"`
+}
+
+// snapshot 设备在本轮评估中的状态与最近一次心跳指标
+type snapshot struct {
+	device    models.Device
+	metrics   *heartbeatMetrics
+	updatedAt time.Time
+}
+
+type alertKey struct {
+	ruleID   uint
+	deviceID string
+}
+
+// Evaluate 评估所有启用的规则，维护告警的pending、firing、resolved状态
+// 同一规则在同一设备上只保留一条未恢复的告警；规则停用、删除或设备不再属于目标时告警随之恢复
+func (s *Service) Evaluate(now time.Time) error {
+	var rules []*models.AlertRule
+	if err := s.db.Preload("Creator").Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return err
+	}
+
+	var active []*models.Alert
+	if err := s.db.Where("status IN ?", []string{models.AlertStatusPending, models.AlertStatusFiring}).
+		Find(&active).Error; err != nil {
+		return err
+	}
+	alerts := make(map[alertKey]*models.Alert, len(active))
+	for _, a := range active {
+		alerts[alertKey{a.RuleID, a.DeviceID}] = a
+	}
+
+	var silences []*models.AlertSilence
+	if err := s.db.Where("starts_at <= ? AND ends_at > ?", now, now).Find(&silences).Error; err != nil {
+		return err
+	}
+
+	snapshots := make(map[string]*snapshot)
+	seen := make(map[alertKey]bool)
+	skipped := make(map[uint]bool)
+	for _, rule := range rules {
+		targets, err := s.loadTargets(rule, snapshots)
+		if err != nil {
+			// 目标加载失败时保持该规则的告警不变，等待下一轮评估
+			logrus.Errorf("Failed to load targets of alert rule %d: %v", rule.ID, err)
+			skipped[rule.ID] = true
+			continue
+		}
+
+		for _, snap := range targets {
+			key := alertKey{rule.ID, snap.device.ID}
+			seen[key] = true
+
+			value, matched := evaluateRule(rule, snap, now)
+			silenced := false
+			for _, silence := range silences {
+				if silence.Matches(rule.ID, snap.device.ID, now) {
+					silenced = true
+					break
+				}
+			}
+
+			if err := s.transition(rule, snap.device.ID, alerts[key], matched, value, silenced, now); err != nil {
+				logrus.Errorf("Failed to update alert of rule %d on device %s: %v", rule.ID, snap.device.ID, err)
+			}
+		}
+	}
+
+	for key, a := range alerts {
+		if seen[key] || skipped[key.ruleID] {
+			continue
+		}
+		if err := s.resolve(a, now); err != nil {
+			logrus.Errorf("Failed to resolve alert %d: %v", a.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// loadTargets 加载规则目标设备的状态与心跳指标，非管理员创建的规则只评估其名下的设备
+func (s *Service) loadTargets(rule *models.AlertRule, cache map[string]*snapshot) ([]*snapshot, error) {
+	query := s.db.Model(&models.Device{}).Select("id", "status", "last_seen", "heartbeat_interval", "owner_id")
+	switch rule.TargetType {
+	case models.AlertTargetGroup:
+		query = query.Where("group_id = ?", rule.TargetID)
+	case models.AlertTargetDevice:
+		query = query.Where("id = ?", rule.TargetID)
+	}
+	if !rule.Creator.IsAdmin() {
+		query = query.Where("owner_id = ?", rule.CreatedBy)
+	}
+
+	var devices []models.Device
+	if err := query.Find(&devices).Error; err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, d := range devices {
+		if cache[d.ID] == nil {
+			missing = append(missing, d.ID)
+		}
+	}
+	if len(missing) > 0 {
+		var agents []models.Agent
+		if err := s.db.Where("device_id IN ?", missing).Find(&agents).Error; err != nil {
+			return nil, err
+		}
+		byDevice := make(map[string]*models.Agent, len(agents))
+		for i := range agents {
+			byDevice[agents[i].DeviceID] = &agents[i]
+		}
+
+		for _, d := range devices {
+			if cache[d.ID] != nil {
+				continue
+			}
+			snap := &snapshot{device: d}
+			if agent := byDevice[d.ID]; agent != nil && agent.HeartbeatMetrics != "" {
+				var metrics heartbeatMetrics
+				if json.Unmarshal([]byte(agent.HeartbeatMetrics), &metrics) == nil {
+					snap.metrics = &metrics
+					snap.updatedAt = agent.LastHeartbeat
+				}
+			}
+			cache[d.ID] = snap
+		}
+	}
+
+	targets := make([]*snapshot, len(devices))
+	for i, d := range devices {
+		targets[i] = cache[d.ID]
+	}
+	return targets, nil
+}
+
+// evaluateRule 返回指标值以及规则条件是否满足，指标缺失或已过期时视为不满足
+func evaluateRule(rule *models.AlertRule, snap *snapshot, now time.Time) (float64, bool) {
+	if rule.Metric == models.AlertMetricOffline {
+		value := math.Round(now.Sub(snap.device.LastSeen).Seconds())
+		return value, device.Presence(&snap.device, now) == models.StatusOffline
+	}
+
+	if snap.metrics == nil || now.Sub(snap.updatedAt) > device.StaleAfter(snap.device.HeartbeatInterval) {
+		return 0, false
+	}
+
+	value, ok := metricValue(rule.Metric, snap.metrics)
+	if !ok {
+		return 0, false
+	}
+	return value, compare(value, rule.Operator, rule.Threshold)
+}
+
+func metricValue(metric string, m *heartbeatMetrics) (float64, bool) {
+	switch metric {
+	case models.AlertMetricCPUUsage:
+		return m.CPUUsage, true
+	case models.AlertMetricMemoryUsage:
+		if m.MemoryTotal <= 0 {
+			return 0, false
+		}
+		return round2(float64(m.MemoryUsed) / float64(m.MemoryTotal) * 100), true
+	case models.AlertMetricSwapUsage:
+		if m.SwapTotal <= 0 {
+			return 0, true
+		}
+		return round2(float64(m.SwapUsed) / float64(m.SwapTotal) * 100), true
+	case models.AlertMetricDiskUsage:
+		usage := m.DiskUsage
+		for _, disk := range m.Disks {
+			usage = math.Max(usage, disk.Usage)
+		}
+		return usage, true
+	case models.AlertMetricLoad1:
+		return m.Load1, true
+	case models.AlertMetricLoad5:
+		return m.Load5, true
+	case models.AlertMetricLoad15:
+		return m.Load15, true
+	case models.AlertMetricNetworkIn:
+		return float64(m.NetworkIn), true
+	case models.AlertMetricNetworkOut:
+		return float64(m.NetworkOut), true
+	}
+	return 0, false
+}
+
+func compare(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// transition 根据本轮评估结果推进告警状态，均以原状态为条件更新，避免并发评估重复推进
+func (s *Service) transition(rule *models.AlertRule, deviceID string, a *models.Alert, matched bool, value float64, silenced bool, now time.Time) error {
+	if !matched {
+		if a == nil {
+			return nil
+		}
+		return s.resolve(a, now)
+	}
+
+	if a == nil {
+		a = &models.Alert{
+			RuleID:          rule.ID,
+			DeviceID:        deviceID,
+			Status:          models.AlertStatusPending,
+			Value:           value,
+			Silenced:        silenced,
+			StartsAt:        now,
+			LastEvaluatedAt: now,
+		}
+		if rule.Duration == 0 {
+			a.Status = models.AlertStatusFiring
+			a.FiredAt = &now
+		}
+		if err := s.db.Create(a).Error; err != nil {
+			return err
+		}
+		if a.Status == models.AlertStatusFiring {
+			logFiring(rule, a)
+		}
+		return nil
+	}
+
+	updates := map[string]interface{}{
+		"value":             value,
+		"silenced":          silenced,
+		"last_evaluated_at": now,
+	}
+	firing := a.Status == models.AlertStatusPending && now.Sub(a.StartsAt) >= time.Duration(rule.Duration)*time.Second
+	if firing {
+		updates["status"] = models.AlertStatusFiring
+		updates["fired_at"] = &now
+	}
+
+	result := s.db.Model(&models.Alert{}).Where("id = ? AND status = ?", a.ID, a.Status).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if firing && result.RowsAffected > 0 {
+		a.Status = models.AlertStatusFiring
+		a.Value = value
+		a.Silenced = silenced
+		a.FiredAt = &now
+		logFiring(rule, a)
+	}
+	return nil
+}
+
+// resolve 恢复告警，尚未触发的pending告警直接删除
+func (s *Service) resolve(a *models.Alert, now time.Time) error {
+	if a.Status == models.AlertStatusPending {
+		return s.db.Where("id = ? AND status = ?", a.ID, models.AlertStatusPending).Delete(&models.Alert{}).Error
+	}
+
+	result := s.db.Model(&models.Alert{}).
+		Where("id = ? AND status = ?", a.ID, models.AlertStatusFiring).
+		Updates(map[string]interface{}{
+			"status":      models.AlertStatusResolved,
+			"resolved_at": &now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logrus.Infof("Alert %d of rule %d resolved on device %s", a.ID, a.RuleID, a.DeviceID)
+	}
+	return nil
+}
+
+func logFiring(rule *models.AlertRule, a *models.Alert) {
+	logrus.Warnf("Alert %d firing: rule %q on device %s, %s = %.2f", a.ID, rule.Name, a.DeviceID, rule.Metric, a.Value)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
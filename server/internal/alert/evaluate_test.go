@@ -0,0 +1,90 @@
+package alert
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/XRSec/Cslite/models"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		value     float64
+		operator  string
+		threshold float64
+		want      bool
+	}{
+		{91, ">", 90, true},
+		{90, ">", 90, false},
+		{90, ">=", 90, true},
+		{89.99, ">=", 90, false},
+		{5, "<", 10, true},
+		{10, "<", 10, false},
+		{10, "<=", 10, true},
+		{11, "<=", 10, false},
+		{100, "==", 100, false},
+		{100, "", 0, false},
+	}
+
+	for _, tt := range tests {
+		if got := compare(tt.value, tt.operator, tt.threshold); got != tt.want {
+			t.Errorf("compare(%v, %q, %v) = %v, want %v", tt.value, tt.operator, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestMetricValue(t *testing.T) {
+	var m heartbeatMetrics
+	err := json.Unmarshal([]byte(`{
+		"cpu_usage": 42.5,
+		"memory_used": 512, "memory_total": 2048,
+		"swap_used": 100, "swap_total": 300,
+		"disk_usage": 40,
+		"disks": [{"usage": 35}, {"usage": 87.5}],
+		"network_in": 1024, "network_out": 2048,
+		"load_1": 0.5, "load_5": 0.75, "load_15": 1.25
+	}`), &m)
+	if err != nil {
+		t.Fatalf("unmarshal metrics: %v", err)
+	}
+
+	tests := []struct {
+		metric string
+		want   float64
+		ok     bool
+	}{
+		{models.AlertMetricCPUUsage, 42.5, true},
+		{models.AlertMetricMemoryUsage, 25, true},
+		{models.AlertMetricSwapUsage, 33.33, true},
+		{models.AlertMetricDiskUsage, 87.5, true},
+		{models.AlertMetricLoad1, 0.5, true},
+		{models.AlertMetricLoad5, 0.75, true},
+		{models.AlertMetricLoad15, 1.25, true},
+		{models.AlertMetricNetworkIn, 1024, true},
+		{models.AlertMetricNetworkOut, 2048, true},
+		{"unknown", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := metricValue(tt.metric, &m)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("metricValue(%s) = %v, %v, want %v, %v", tt.metric, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMetricValueMissingTotals(t *testing.T) {
+	m := &heartbeatMetrics{MemoryUsed: 512, SwapUsed: 100, DiskUsage: 70}
+
+	// 没有内存总量时无法计算使用率，不参与评估
+	if _, ok := metricValue(models.AlertMetricMemoryUsage, m); ok {
+		t.Error("memory usage without total should not be evaluated")
+	}
+	// 未启用swap视为使用率为0
+	if got, ok := metricValue(models.AlertMetricSwapUsage, m); !ok || got != 0 {
+		t.Errorf("swap usage without total = %v, %v, want 0, true", got, ok)
+	}
+	if got, ok := metricValue(models.AlertMetricDiskUsage, m); !ok || got != 70 {
+		t.Errorf("disk usage without disks = %v, %v, want 70, true", got, ok)
+	}
+}
@@ -0,0 +1,61 @@
+package alert
+
+import (
+	"sync"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Evaluator 定期评估告警规则
+type Evaluator struct {
+	service  *Service
+	interval time.Duration
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewEvaluator 创建新的告警评估实例
+func NewEvaluator() *Evaluator {
+	interval := config.AppConfig.AlertInterval
+	if interval <= 0 {
+		interval = 30
+	}
+
+	return &Evaluator{
+		service:  NewService(),
+		interval: time.Duration(interval) * time.Second,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动评估循环
+func (e *Evaluator) Start() {
+	e.wg.Add(1)
+	go e.loop()
+}
+
+// Stop 停止评估循环并等待退出
+func (e *Evaluator) Stop() {
+	close(e.stopChan)
+	e.wg.Wait()
+}
+
+func (e *Evaluator) loop() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.service.Evaluate(time.Now()); err != nil {
+				logrus.Error("Failed to evaluate alert rules: ", err)
+			}
+		case <-e.stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package alert
+
+import (
+	"errors"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/gorm"
+)
+
+// maxRuleDuration 规则持续时间的上限（秒）
+const maxRuleDuration = 7 * 24 * 3600
+
+var (
+	validMetrics = map[string]bool{
+		models.AlertMetricCPUUsage:    true,
+		models.AlertMetricMemoryUsage: true,
+		models.AlertMetricSwapUsage:   true,
+		models.AlertMetricDiskUsage:   true,
+		models.AlertMetricLoad1:       true,
+		models.AlertMetricLoad5:       true,
+		models.AlertMetricLoad15:      true,
+		models.AlertMetricNetworkIn:   true,
+		models.AlertMetricNetworkOut:  true,
+		models.AlertMetricOffline:     true,
+	}
+	validOperators = map[string]bool{">": true, ">=": true, "<": true, "<=": true}
+	validSeverity  = map[string]bool{
+		models.AlertSeverityInfo:     true,
+		models.AlertSeverityWarning:  true,
+		models.AlertSeverityCritical: true,
+	}
+)
+
+// Service 告警服务
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建新的告警服务实例
+func NewService() *Service {
+	return &Service{
+		db: config.DB,
+	}
+}
+
+// RuleInput 创建或更新告警规则的参数，更新时未提供的字段保持不变
+type RuleInput struct {
+	Name       *string
+	Metric     *string
+	Operator   *string
+	Threshold  *float64
+	Duration   *int
+	Severity   *string
+	TargetType *string
+	TargetID   *string
+	Enabled    *bool
+}
+
+// SilenceInput 创建静默的参数，StartsAt为空时立即生效
+type SilenceInput struct {
+	RuleID   *uint
+	DeviceID string
+	StartsAt *time.Time
+	EndsAt   time.Time
+	Comment  string
+}
+
+// ListRules 列出告警规则，非管理员只能看到自己创建的规则
+func (s *Service) ListRules(userID uint, isAdmin bool) ([]*models.AlertRule, error) {
+	query := s.db.Order("id ASC")
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	var rules []*models.AlertRule
+	if err := query.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CreateRule 创建告警规则，运算符默认为>，级别默认为warning，目标默认为全部设备
+func (s *Service) CreateRule(userID uint, isAdmin bool, input RuleInput) (*models.AlertRule, error) {
+	rule := &models.AlertRule{
+		Operator:   ">",
+		Severity:   models.AlertSeverityWarning,
+		TargetType: models.AlertTargetAll,
+		Enabled:    true,
+		CreatedBy:  userID,
+	}
+	input.apply(rule)
+
+	if err := s.validateRule(rule, userID, isAdmin); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(rule).Error; err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// UpdateRule 更新告警规则，规则停用后其未恢复的告警在下一次评估时恢复
+func (s *Service) UpdateRule(ruleID uint, userID uint, isAdmin bool, input RuleInput) (*models.AlertRule, error) {
+	rule, err := s.findRule(ruleID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	input.apply(rule)
+	if err := s.validateRule(rule, userID, isAdmin); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(rule).Error; err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// DeleteRule 删除告警规则及其告警与静默
+func (s *Service) DeleteRule(ruleID uint, userID uint, isAdmin bool) error {
+	rule, err := s.findRule(ruleID, userID, isAdmin)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rule_id = ?", rule.ID).Delete(&models.Alert{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("rule_id = ?", rule.ID).Delete(&models.AlertSilence{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(rule).Error
+	})
+}
+
+func (s *Service) findRule(ruleID uint, userID uint, isAdmin bool) (*models.AlertRule, error) {
+	query := s.db
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	var rule models.AlertRule
+	if err := query.First(&rule, ruleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRuleNotFound
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (input *RuleInput) apply(rule *models.AlertRule) {
+	if input.Name != nil {
+		rule.Name = *input.Name
+	}
+	if input.Metric != nil {
+		rule.Metric = *input.Metric
+	}
+	if input.Operator != nil {
+		rule.Operator = *input.Operator
+	}
+	if input.Threshold != nil {
+		rule.Threshold = *input.Threshold
+	}
+	if input.Duration != nil {
+		rule.Duration = *input.Duration
+	}
+	if input.Severity != nil {
+		rule.Severity = *input.Severity
+	}
+	if input.TargetType != nil {
+		rule.TargetType = *input.TargetType
+	}
+	if input.TargetID != nil {
+		rule.TargetID = *input.TargetID
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+}
+
+// validateRule 校验规则参数，并确认目标分组或设备存在且归属于当前用户
+func (s *Service) validateRule(rule *models.AlertRule, userID uint, isAdmin bool) error {
+	if rule.Name == "" || len(rule.Name) > 100 ||
+		!validMetrics[rule.Metric] || !validOperators[rule.Operator] || !validSeverity[rule.Severity] ||
+		rule.Duration < 0 || rule.Duration > maxRuleDuration {
+		return ErrInvalidRule
+	}
+
+	switch rule.TargetType {
+	case models.AlertTargetAll:
+		rule.TargetID = ""
+	case models.AlertTargetGroup:
+		query := s.db.Model(&models.Group{}).Where("id = ?", rule.TargetID)
+		if !isAdmin {
+			query = query.Where("created_by = ?", userID)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrGroupNotFound
+		}
+	case models.AlertTargetDevice:
+		query := s.db.Model(&models.Device{}).Where("id = ?", rule.TargetID)
+		if !isAdmin {
+			query = query.Where("owner_id = ?", userID)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrDeviceNotFound
+		}
+	default:
+		return ErrInvalidRule
+	}
+
+	return nil
+}
+
+// ListAlerts 分页列出告警，非管理员只能看到自己规则产生的告警
+// 支持按status、rule_id、device_id、severity过滤，status为active时返回未恢复的告警
+func (s *Service) ListAlerts(userID uint, isAdmin bool, page, limit int, filters map[string]interface{}) ([]*models.Alert, int64, error) {
+	query := s.db.Model(&models.Alert{}).
+		Joins("JOIN alert_rules ON alert_rules.id = alerts.rule_id")
+
+	if !isAdmin {
+		query = query.Where("alert_rules.created_by = ?", userID)
+	}
+	if status, ok := filters["status"].(string); ok && status != "" {
+		if status == "active" {
+			query = query.Where("alerts.status IN ?", []string{models.AlertStatusPending, models.AlertStatusFiring})
+		} else {
+			query = query.Where("alerts.status = ?", status)
+		}
+	}
+	if ruleID, ok := filters["rule_id"].(uint); ok && ruleID > 0 {
+		query = query.Where("alerts.rule_id = ?", ruleID)
+	}
+	if deviceID, ok := filters["device_id"].(string); ok && deviceID != "" {
+		query = query.Where("alerts.device_id = ?", deviceID)
+	}
+	if severity, ok := filters["severity"].(string); ok && severity != "" {
+		query = query.Where("alert_rules.severity = ?", severity)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var alerts []*models.Alert
+	offset := (page - 1) * limit
+	if err := query.Preload("Rule").Order("alerts.id DESC").Offset(offset).Limit(limit).Find(&alerts).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return alerts, total, nil
+}
+
+// ListSilences 列出尚未失效的静默，非管理员只能看到自己创建的静默
+func (s *Service) ListSilences(userID uint, isAdmin bool) ([]*models.AlertSilence, error) {
+	query := s.db.Where("ends_at > ?", time.Now()).Order("id ASC")
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	var silences []*models.AlertSilence
+	if err := query.Find(&silences).Error; err != nil {
+		return nil, err
+	}
+	return silences, nil
+}
+
+// CreateSilence 创建静默，非管理员必须指定自己创建的规则
+func (s *Service) CreateSilence(userID uint, isAdmin bool, input SilenceInput) (*models.AlertSilence, error) {
+	startsAt := time.Now()
+	if input.StartsAt != nil {
+		startsAt = *input.StartsAt
+	}
+	if !input.EndsAt.After(startsAt) || !input.EndsAt.After(time.Now()) || len(input.Comment) > 255 {
+		return nil, ErrInvalidSilence
+	}
+
+	if input.RuleID == nil {
+		if !isAdmin {
+			return nil, ErrInvalidSilence
+		}
+	} else if _, err := s.findRule(*input.RuleID, userID, isAdmin); err != nil {
+		return nil, err
+	}
+
+	silence := &models.AlertSilence{
+		RuleID:    input.RuleID,
+		DeviceID:  input.DeviceID,
+		StartsAt:  startsAt,
+		EndsAt:    input.EndsAt,
+		Comment:   input.Comment,
+		CreatedBy: userID,
+	}
+	if err := s.db.Create(silence).Error; err != nil {
+		return nil, err
+	}
+	return silence, nil
+}
+
+// DeleteSilence 删除静默，匹配的告警在下一次评估时取消静默
+func (s *Service) DeleteSilence(silenceID uint, userID uint, isAdmin bool) error {
+	query := s.db.Where("id = ?", silenceID)
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	result := query.Delete(&models.AlertSilence{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSilenceNotFound
+	}
+	return nil
+}
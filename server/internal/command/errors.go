@@ -8,4 +8,5 @@ var (
 	ErrInvalidCommandStatus  = errors.New("invalid command status for this operation") // 命令状态无效，无法执行此操作
 	ErrInvalidAction         = errors.New("invalid action")                            // 无效的操作
 	ErrInvalidCronExpression = errors.New("invalid cron expression")                   // 无效的cron表达式
+	ErrNoTargets             = errors.New("no target devices")                         // 没有可执行的目标设备
 )
@@ -5,65 +5,145 @@ import (
 	"time"
 
 	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/execution"
+	"github.com/XRSec/Cslite/internal/log"
+	"github.com/XRSec/Cslite/internal/notification"
+	"github.com/XRSec/Cslite/internal/scheduler"
 	"github.com/XRSec/Cslite/models"
 	"github.com/XRSec/Cslite/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	db *gorm.DB
+	db            *gorm.DB
+	executions    *execution.Service
+	notifications *notification.Service
 }
 
 func NewService() *Service {
 	return &Service{
-		db: config.DB,
+		db:            config.DB,
+		executions:    execution.NewService(),
+		notifications: notification.NewService(),
 	}
 }
 
 type CreateCommandInput struct {
-	Name        string              `json:"name"`
-	Type        string              `json:"type"`
-	Schedule    string              `json:"schedule"`
-	Content     string              `json:"content"`
-	TargetType  string              `json:"target_type"`
-	TargetIDs   []string            `json:"target_ids"`
-	Timeout     int                 `json:"timeout"`
-	RetryPolicy *models.RetryPolicy `json:"retry_policy"`
-	EnvVars     map[string]string   `json:"env_vars"`
+	Name           string                 `json:"name"`
+	Type           string                 `json:"type"`
+	Schedule       string                 `json:"schedule"`
+	Interpreter    string                 `json:"interpreter"`
+	Content        string                 `json:"content"`
+	Script         string                 `json:"script"`
+	Args           []string               `json:"args"`
+	RunAs          string                 `json:"run_as"`
+	RunAsGroup     string                 `json:"run_as_group"`
+	WorkingDir     string                 `json:"working_dir"`
+	Umask          string                 `json:"umask"`
+	TargetType     string                 `json:"target_type"`
+	TargetIDs      []string               `json:"target_ids"`
+	Timeout        int                    `json:"timeout"`
+	RetryPolicy    *models.RetryPolicy    `json:"retry_policy"`
+	EnvVars        map[string]string      `json:"env_vars"`
+	Concurrency    int                    `json:"concurrency"`
+	LockKey        string                 `json:"lock_key"`
+	ResourceLimits *models.ResourceLimits `json:"resource_limits"`
+	NotifyOn       string                 `json:"notify_on"`
+	NotifyChannels []uint                 `json:"notify_channels"`
 }
 
 func (s *Service) CreateCommand(userID uint, input *CreateCommandInput) (*models.Command, error) {
 	targetIDsJSON, _ := json.Marshal(input.TargetIDs)
 	retryPolicyJSON, _ := json.Marshal(input.RetryPolicy)
 	envVarsJSON, _ := json.Marshal(input.EnvVars)
+	var argsJSON, limitsJSON []byte
+	if len(input.Args) > 0 {
+		argsJSON, _ = json.Marshal(input.Args)
+	}
+	if !input.ResourceLimits.IsZero() {
+		limitsJSON, _ = json.Marshal(input.ResourceLimits)
+	}
+	var channelsJSON []byte
+	if len(input.NotifyChannels) > 0 {
+		channelsJSON, _ = json.Marshal(input.NotifyChannels)
+	}
+
+	// 通知渠道须为创建者本人的渠道
+	if err := s.notifications.CheckChannels(userID, input.NotifyChannels); err != nil {
+		return nil, err
+	}
 
 	command := &models.Command{
-		ID:          utils.GenerateCommandID(),
-		Name:        input.Name,
-		Type:        input.Type,
-		Schedule:    input.Schedule,
-		Content:     input.Content,
-		TargetType:  input.TargetType,
-		TargetIDs:   targetIDsJSON,
-		Timeout:     input.Timeout,
-		RetryPolicy: retryPolicyJSON,
-		EnvVars:     envVarsJSON,
-		Status:      models.CommandStatusPending,
-		CreatedBy:   userID,
+		ID:             utils.GenerateCommandID(),
+		Name:           input.Name,
+		Type:           input.Type,
+		Schedule:       input.Schedule,
+		Interpreter:    input.Interpreter,
+		Content:        input.Content,
+		Script:         input.Script,
+		Args:           argsJSON,
+		RunAs:          input.RunAs,
+		RunAsGroup:     input.RunAsGroup,
+		WorkingDir:     input.WorkingDir,
+		Umask:          input.Umask,
+		ResourceLimits: limitsJSON,
+		TargetType:     input.TargetType,
+		TargetIDs:      targetIDsJSON,
+		Timeout:        input.Timeout,
+		RetryPolicy:    retryPolicyJSON,
+		EnvVars:        envVarsJSON,
+		Concurrency:    input.Concurrency,
+		LockKey:        input.LockKey,
+		NotifyOn:       input.NotifyOn,
+		NotifyChannels: channelsJSON,
+		Status:         models.CommandStatusPending,
+		CreatedBy:      userID,
 	}
 
 	if command.Type == models.CommandTypeImmediate {
 		command.Status = models.CommandStatusRunning
 	}
 
-	if err := s.db.Create(command).Error; err != nil {
-		return nil, err
+	nextRun, err := scheduler.NextRun(command.Type, command.Schedule, time.Now())
+	if err != nil {
+		return nil, ErrInvalidCronExpression
 	}
+	command.NextRun = nextRun
 
+	// 立即执行的命令没有可执行的目标设备时直接拒绝，不创建命令
 	if command.Type == models.CommandTypeImmediate {
-		go s.executeCommand(command)
+		deviceIDs, err := s.executions.ResolveTargets(s.db, command)
+		if err != nil {
+			return nil, err
+		}
+		if len(deviceIDs) == 0 {
+			return nil, ErrNoTargets
+		}
+	}
+
+	var dispatched *models.Execution
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(command).Error; err != nil {
+			return err
+		}
+
+		// 立即执行的命令在创建时即下发到各目标设备
+		if command.Type == models.CommandTypeImmediate {
+			var err error
+			if dispatched, err = s.executions.Dispatch(tx, command); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
+	s.executions.NotifyTargets(dispatched)
+
 	return command, nil
 }
 
@@ -133,27 +213,60 @@ func (s *Service) UpdateCommandStatus(commandID string, action string, userID ui
 		return err
 	}
 
+	var status string
+	updates := make(map[string]interface{})
 	switch action {
 	case "pause":
 		if command.Status != models.CommandStatusRunning {
 			return ErrInvalidCommandStatus
 		}
-		command.Status = models.CommandStatusPaused
+		status = models.CommandStatusPaused
 	case "resume":
 		if command.Status != models.CommandStatusPaused {
 			return ErrInvalidCommandStatus
 		}
-		command.Status = models.CommandStatusRunning
+		status = models.CommandStatusRunning
+		// 恢复cron命令时从当前时刻重新计算，避免补跑暂停期间错过的调度
+		if command.Type == models.CommandTypeCron {
+			nextRun, err := scheduler.NextRun(command.Type, command.Schedule, time.Now())
+			if err != nil {
+				return ErrInvalidCronExpression
+			}
+			updates["next_run"] = nextRun
+		}
 	case "cancel":
 		if command.Status == models.CommandStatusCompleted || command.Status == models.CommandStatusCancelled {
 			return ErrInvalidCommandStatus
 		}
-		command.Status = models.CommandStatusCancelled
+		status = models.CommandStatusCancelled
 	default:
 		return ErrInvalidAction
 	}
 
-	return s.db.Save(&command).Error
+	updates["status"] = status
+
+	// 以读取时的状态为条件只更新变化的列，避免覆盖调度器同时认领的next_run与执行汇总写入的状态
+	update := s.db.Model(&models.Command{}).
+		Where("id = ? AND status = ?", command.ID, command.Status).
+		Updates(updates)
+	if update.Error != nil {
+		return update.Error
+	}
+	if update.RowsAffected == 0 {
+		return ErrInvalidCommandStatus
+	}
+	command.Status = status
+
+	// 唤醒执行中的设备，尽快下发暂停、恢复或取消指令
+	if err := s.executions.NotifyCommand(command.ID); err != nil {
+		logrus.Errorf("Failed to notify devices of command %s: %v", command.ID, err)
+	}
+
+	if command.Status == models.CommandStatusCancelled {
+		return s.executions.CancelPending(command.ID)
+	}
+
+	return nil
 }
 
 func (s *Service) GetCommandResults(commandID string, userID uint, isAdmin bool) ([]*ExecutionDetail, error) {
@@ -169,21 +282,49 @@ func (s *Service) GetCommandResults(commandID string, userID uint, isAdmin bool)
 	}
 
 	var executions []models.Execution
-	if err := s.db.Where("command_id = ?", commandID).Preload("Results.Device").Find(&executions).Error; err != nil {
+	if err := s.db.Where("command_id = ?", commandID).
+		Preload("Results", func(db *gorm.DB) *gorm.DB {
+			return db.Order("attempt")
+		}).
+		Preload("Results.Device").
+		Find(&executions).Error; err != nil {
 		return nil, err
 	}
 
 	details := make([]*ExecutionDetail, len(executions))
 	for i, exec := range executions {
-		deviceResults := make([]*DeviceResult, len(exec.Results))
-		for j, result := range exec.Results {
-			deviceResults[j] = &DeviceResult{
-				DeviceID: result.DeviceID,
-				Status:   result.Status,
-				ExitCode: result.ExitCode,
-				Output:   result.Output,
-				LogURL:   "/logs/download/" + result.LogPath,
+		// 每台设备以最后一次执行为准，历次执行记录在attempts中
+		latest := execution.LatestAttempts(exec.Results)
+		deviceResults := make([]*DeviceResult, len(latest))
+		for j, result := range latest {
+			deviceResult := &DeviceResult{
+				DeviceID:      result.DeviceID,
+				Attempt:       result.Attempt,
+				Status:        result.Status,
+				DeliveryState: result.DeliveryState,
+				ExitCode:      result.ExitCode,
+				Output:        result.Output,
+				ResourceUsage: result.ResourceUsage,
+				LogURL:        log.DownloadURL(result.LogPath),
+			}
+
+			for _, attempt := range exec.Results {
+				if attempt.DeviceID != result.DeviceID {
+					continue
+				}
+				deviceResult.Attempts = append(deviceResult.Attempts, &AttemptResult{
+					Attempt:       attempt.Attempt,
+					Status:        attempt.Status,
+					ExitCode:      attempt.ExitCode,
+					ResourceUsage: attempt.ResourceUsage,
+					NotBefore:     attempt.NotBefore,
+					StartedAt:     attempt.StartedAt,
+					CompletedAt:   attempt.CompletedAt,
+					LogURL:        log.DownloadURL(attempt.LogPath),
+				})
 			}
+
+			deviceResults[j] = deviceResult
 		}
 
 		details[i] = &ExecutionDetail{
@@ -198,29 +339,6 @@ func (s *Service) GetCommandResults(commandID string, userID uint, isAdmin bool)
 	return details, nil
 }
 
-func (s *Service) executeCommand(command *models.Command) {
-	execution := &models.Execution{
-		ID:        utils.GenerateExecutionID(),
-		CommandID: command.ID,
-		Status:    models.ExecutionStatusRunning,
-		StartedAt: time.Now(),
-	}
-
-	s.db.Create(execution)
-
-	s.db.Model(command).Update("status", models.CommandStatusRunning)
-}
-
-// calculateNextRun 计算下次执行时间（供客户端参考，服务端不负责调度）
-// func calculateNextRun(schedule string) (time.Time, error) {
-// 	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-// 	sched, err := parser.Parse(schedule)
-// 	if err != nil {
-// 		return time.Time{}, err
-// 	}
-// 	return sched.Next(time.Now()), nil
-// }
-
 type ExecutionDetail struct {
 	ID            string          `json:"id"`
 	Status        string          `json:"status"`
@@ -230,9 +348,24 @@ type ExecutionDetail struct {
 }
 
 type DeviceResult struct {
-	DeviceID string `json:"device_id"`
-	Status   string `json:"status"`
-	ExitCode int    `json:"exit_code"`
-	Output   string `json:"output"`
-	LogURL   string `json:"log_url"`
+	DeviceID      string           `json:"device_id"`
+	Attempt       int              `json:"attempt"`
+	Status        string           `json:"status"`
+	DeliveryState string           `json:"delivery_state"`
+	ExitCode      int              `json:"exit_code"`
+	Output        string           `json:"output"`
+	ResourceUsage datatypes.JSON   `json:"resource_usage,omitempty"`
+	LogURL        string           `json:"log_url"`
+	Attempts      []*AttemptResult `json:"attempts"`
+}
+
+type AttemptResult struct {
+	Attempt       int            `json:"attempt"`
+	Status        string         `json:"status"`
+	ExitCode      int            `json:"exit_code"`
+	ResourceUsage datatypes.JSON `json:"resource_usage,omitempty"`
+	NotBefore     *time.Time     `json:"not_before,omitempty"`
+	StartedAt     time.Time      `json:"started_at"`
+	CompletedAt   *time.Time     `json:"completed_at,omitempty"`
+	LogURL        string         `json:"log_url"`
 }
@@ -0,0 +1,166 @@
+package command
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	config.AppConfig = &config.Config{FileDir: t.TempDir()}
+	db := testutil.OpenDB(t)
+
+	db.Create(&models.User{ID: 1, Username: "admin", Password: "x", Role: models.RoleAdmin})
+	db.Create(&models.User{ID: 2, Username: "alice", Password: "x", Role: models.RoleUser})
+	return NewService(), db
+}
+
+// createRunningCommand 创建执行中的命令，dev_1已开始执行，dev_2仍在等待下发
+func createRunningCommand(t *testing.T, db *gorm.DB, id, cmdType string) {
+	t.Helper()
+	command := &models.Command{
+		ID:         id,
+		Name:       id,
+		Type:       cmdType,
+		Schedule:   "*/5 * * * *",
+		Content:    "uptime",
+		TargetType: models.TargetTypeDevices,
+		Status:     models.CommandStatusRunning,
+		CreatedBy:  2,
+	}
+	if err := db.Create(command).Error; err != nil {
+		t.Fatalf("create command: %v", err)
+	}
+
+	executionID := "exec_" + id
+	db.Create(&models.Execution{ID: executionID, CommandID: id, Status: models.ExecutionStatusRunning})
+	db.Create(&models.ExecutionResult{ID: "res_" + id + "_1", ExecutionID: executionID, DeviceID: "dev_1", Attempt: 1,
+		Status: models.ResultStatusRunning, DeliveryState: models.DeliveryStateRunning})
+	db.Create(&models.ExecutionResult{ID: "res_" + id + "_2", ExecutionID: executionID, DeviceID: "dev_2", Attempt: 1,
+		Status: models.ResultStatusPending, DeliveryState: models.DeliveryStateQueued})
+}
+
+func commandStatus(db *gorm.DB, id string) string {
+	var command models.Command
+	db.First(&command, "id = ?", id)
+	return command.Status
+}
+
+func TestUpdateCommandStatus(t *testing.T) {
+	s, db := newTestService(t)
+	createRunningCommand(t, db, "cmd_1", models.CommandTypeImmediate)
+
+	steps := []struct {
+		action string
+		userID uint
+		err    error
+		status string
+	}{
+		{"resume", 2, ErrInvalidCommandStatus, models.CommandStatusRunning},
+		{"pause", 2, nil, models.CommandStatusPaused},
+		{"pause", 2, ErrInvalidCommandStatus, models.CommandStatusPaused},
+		{"stop", 2, ErrInvalidAction, models.CommandStatusPaused},
+		{"resume", 2, nil, models.CommandStatusRunning},
+		{"cancel", 3, gorm.ErrRecordNotFound, models.CommandStatusRunning},
+		{"cancel", 2, nil, models.CommandStatusCancelled},
+		{"cancel", 2, ErrInvalidCommandStatus, models.CommandStatusCancelled},
+	}
+
+	for _, step := range steps {
+		err := s.UpdateCommandStatus("cmd_1", step.action, step.userID, false)
+		if err != step.err {
+			t.Errorf("%s by user %d error = %v, want %v", step.action, step.userID, err, step.err)
+		}
+		if got := commandStatus(db, "cmd_1"); got != step.status {
+			t.Errorf("after %s status = %s, want %s", step.action, got, step.status)
+		}
+	}
+}
+
+func TestCancelCommand(t *testing.T) {
+	s, db := newTestService(t)
+	createRunningCommand(t, db, "cmd_1", models.CommandTypeImmediate)
+
+	if err := s.UpdateCommandStatus("cmd_1", "cancel", 1, true); err != nil {
+		t.Fatalf("cancel error: %v", err)
+	}
+
+	// 未开始的结果直接取消，执行中的结果等待Agent收到取消指令后上报
+	var results []models.ExecutionResult
+	db.Where("execution_id = ?", "exec_cmd_1").Order("device_id").Find(&results)
+	if results[0].Status != models.ResultStatusRunning || results[1].Status != models.ResultStatusCancelled {
+		t.Errorf("result statuses = %s, %s, want running, cancelled", results[0].Status, results[1].Status)
+	}
+	if got := commandStatus(db, "cmd_1"); got != models.CommandStatusCancelled {
+		t.Errorf("command status = %s, want cancelled", got)
+	}
+}
+
+func TestResumeCronCommand(t *testing.T) {
+	s, db := newTestService(t)
+	createRunningCommand(t, db, "cmd_cron", models.CommandTypeCron)
+
+	s.UpdateCommandStatus("cmd_cron", "pause", 2, false)
+	if err := s.UpdateCommandStatus("cmd_cron", "resume", 2, false); err != nil {
+		t.Fatalf("resume error: %v", err)
+	}
+
+	var command models.Command
+	db.First(&command, "id = ?", "cmd_cron")
+	if command.NextRun == nil || command.NextRun.Minute()%5 != 0 {
+		t.Errorf("next_run = %v, want next 5 minute boundary", command.NextRun)
+	}
+}
+
+// afterNextQuery 在下一次查询命令后执行fn，模拟读取与更新之间调度器或执行汇总并发修改命令
+func afterNextQuery(t *testing.T, db *gorm.DB, fn func(tx *gorm.DB)) {
+	t.Helper()
+	fired := false
+	err := db.Callback().Query().After("gorm:query").Register(fmt.Sprintf("test:after_query_%p", &fired), func(tx *gorm.DB) {
+		if fired || tx.Statement.Table != "commands" {
+			return
+		}
+		fired = true
+		fn(tx.Session(&gorm.Session{NewDB: true}))
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+}
+
+func TestUpdateCommandStatusConcurrent(t *testing.T) {
+	s, db := newTestService(t)
+	createRunningCommand(t, db, "cmd_cron", models.CommandTypeCron)
+	createRunningCommand(t, db, "cmd_1", models.CommandTypeImmediate)
+
+	// 暂停时调度器刚认领了下一次触发，next_run与last_run不被覆盖
+	claimed := time.Date(2030, 1, 1, 0, 5, 0, 0, time.UTC)
+	afterNextQuery(t, db, func(tx *gorm.DB) {
+		tx.Model(&models.Command{}).Where("id = ?", "cmd_cron").
+			Updates(map[string]interface{}{"next_run": claimed, "last_run": claimed})
+	})
+	if err := s.UpdateCommandStatus("cmd_cron", "pause", 2, false); err != nil {
+		t.Fatalf("pause error: %v", err)
+	}
+	var command models.Command
+	db.First(&command, "id = ?", "cmd_cron")
+	if command.Status != models.CommandStatusPaused || command.NextRun == nil || !command.NextRun.Equal(claimed) {
+		t.Errorf("status = %s, next_run = %v, want paused, %v", command.Status, command.NextRun, claimed)
+	}
+
+	// 取消时执行刚汇总完成，不再把已完成的命令改为取消
+	afterNextQuery(t, db, func(tx *gorm.DB) {
+		tx.Model(&models.Command{}).Where("id = ?", "cmd_1").Update("status", models.CommandStatusCompleted)
+	})
+	if err := s.UpdateCommandStatus("cmd_1", "cancel", 2, false); err != ErrInvalidCommandStatus {
+		t.Errorf("cancel completed command error = %v, want ErrInvalidCommandStatus", err)
+	}
+	if got := commandStatus(db, "cmd_1"); got != models.CommandStatusCompleted {
+		t.Errorf("command status = %s, want completed", got)
+	}
+}
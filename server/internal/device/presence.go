@@ -0,0 +1,91 @@
+package device
+
+import (
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+)
+
+// StaleAfter 设备超过该时长未心跳即标记为失联，interval为Agent上报的心跳间隔（秒），取与服务端配置中较大的一个
+func StaleAfter(interval int) time.Duration {
+	return heartbeatIntervals(config.AppConfig.DeviceStaleAfter, 3, interval)
+}
+
+// OfflineAfter 设备超过该时长未心跳即标记为离线
+func OfflineAfter(interval int) time.Duration {
+	offline := heartbeatIntervals(config.AppConfig.DeviceOfflineAfter, 5, interval)
+	if stale := StaleAfter(interval); offline < stale {
+		return stale
+	}
+	return offline
+}
+
+func heartbeatIntervals(n, fallback, interval int) time.Duration {
+	if n <= 0 {
+		n = fallback
+	}
+	if interval < config.AppConfig.HeartbeatInterval {
+		interval = config.AppConfig.HeartbeatInterval
+	}
+	return time.Duration(interval*n) * time.Second
+}
+
+// Presence 根据记录的状态、最近一次心跳时间与心跳间隔推算设备当前状态
+// 后台巡检按间隔更新状态，查询时据此补齐巡检间隔内的变化
+func Presence(device *models.Device, now time.Time) string {
+	since := now.Sub(device.LastSeen)
+	switch {
+	case device.Status == models.StatusOffline || since > OfflineAfter(device.HeartbeatInterval):
+		return models.StatusOffline
+	case device.Status == models.StatusStale || since > StaleAfter(device.HeartbeatInterval):
+		return models.StatusStale
+	}
+	return device.Status
+}
+
+// SweepPresence 将错过心跳的设备由在线、忙碌转为失联，再转为离线，并记录状态变化事件
+func (s *Service) SweepPresence(now time.Time) (int, error) {
+	// 服务端配置的心跳间隔是各设备阈值的下限，先按下限筛选，再按设备上报的间隔逐个判断
+	var devices []models.Device
+	if err := s.db.Select("id", "status", "last_seen", "heartbeat_interval").
+		Where("status IN ? AND last_seen < ?",
+			[]string{models.StatusOnline, models.StatusBusy, models.StatusStale}, now.Add(-StaleAfter(0))).
+		Find(&devices).Error; err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, device := range devices {
+		staleBefore := now.Add(-StaleAfter(device.HeartbeatInterval))
+		offlineBefore := now.Add(-OfflineAfter(device.HeartbeatInterval))
+		if !device.LastSeen.Before(staleBefore) {
+			continue
+		}
+
+		target, threshold := models.StatusStale, staleBefore
+		if device.LastSeen.Before(offlineBefore) {
+			target, threshold = models.StatusOffline, offlineBefore
+		}
+		if device.Status == target {
+			continue
+		}
+
+		// 以原状态和心跳时间为条件更新，避免覆盖巡检期间刚到达的心跳
+		result := s.db.Model(&models.Device{}).
+			Where("id = ? AND status = ? AND last_seen < ?", device.ID, device.Status, threshold).
+			Update("status", target)
+		if result.Error != nil {
+			return changed, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		s.events.StatusChanged(device.ID, device.Status, target, "missed_heartbeats")
+		s.webhooks.DeviceStatusChanged(device.ID, device.Status, target)
+		changed++
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,86 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/models"
+)
+
+func TestPresence(t *testing.T) {
+	newTestService(t)
+	now := time.Now()
+
+	// 服务端心跳间隔60秒，3个周期失联，5个周期离线；Agent上报更长的间隔时按上报值计算
+	tests := []struct {
+		name     string
+		status   string
+		since    time.Duration
+		interval int
+		want     string
+	}{
+		{"recent", models.StatusBusy, time.Minute, 0, models.StatusBusy},
+		{"missed heartbeats", models.StatusOnline, 4 * time.Minute, 0, models.StatusStale},
+		{"long gone", models.StatusOnline, 6 * time.Minute, 0, models.StatusOffline},
+		{"recorded stale", models.StatusStale, time.Minute, 0, models.StatusStale},
+		{"recorded offline", models.StatusOffline, time.Minute, 0, models.StatusOffline},
+		{"slow agent", models.StatusOnline, 6 * time.Minute, 300, models.StatusOnline},
+		{"slow agent stale", models.StatusOnline, 16 * time.Minute, 300, models.StatusStale},
+		{"fast agent", models.StatusOnline, 4 * time.Minute, 10, models.StatusStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := &models.Device{Status: tt.status, LastSeen: now.Add(-tt.since), HeartbeatInterval: tt.interval}
+			if got := Presence(device, now); got != tt.want {
+				t.Errorf("Presence = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweepPresence(t *testing.T) {
+	s, db := newTestService(t)
+	now := time.Now()
+
+	devices := []struct {
+		id       string
+		status   string
+		since    time.Duration
+		interval int
+		want     string
+	}{
+		{"dev_1", models.StatusOnline, time.Minute, 0, models.StatusOnline},
+		{"dev_2", models.StatusBusy, 4 * time.Minute, 0, models.StatusStale},
+		{"dev_3", models.StatusStale, 6 * time.Minute, 0, models.StatusOffline},
+		{"dev_4", models.StatusOnline, 6 * time.Minute, 300, models.StatusOnline},
+		{"dev_5", models.StatusOnline, 30 * time.Minute, 300, models.StatusOffline},
+	}
+	for _, d := range devices {
+		db.Create(&models.Device{ID: d.id, Name: d.id, Platform: "linux", OwnerID: 1, Status: d.status,
+			LastSeen: now.Add(-d.since), HeartbeatInterval: d.interval})
+	}
+
+	changed, err := s.SweepPresence(now)
+	if err != nil || changed != 3 {
+		t.Fatalf("SweepPresence = %d, %v, want 3 changes", changed, err)
+	}
+	for _, d := range devices {
+		var device models.Device
+		db.First(&device, "id = ?", d.id)
+		if device.Status != d.want {
+			t.Errorf("%s status = %s, want %s", d.id, device.Status, d.want)
+		}
+	}
+
+	var events int64
+	db.Model(&models.DeviceEvent{}).Where("type = ?", models.DeviceEventStatusChange).Count(&events)
+	if events != 3 {
+		t.Errorf("status change events = %d, want 3", events)
+	}
+
+	// 状态没有变化时不重复记录
+	if changed, _ := s.SweepPresence(now); changed != 0 {
+		t.Errorf("second sweep changed %d devices", changed)
+	}
+}
@@ -2,23 +2,32 @@
 package device
 
 import (
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/event"
+	"github.com/XRSec/Cslite/internal/webhook"
 	"github.com/XRSec/Cslite/models"
 	"github.com/XRSec/Cslite/utils"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 // Service 设备服务结构体
 type Service struct {
-	db *gorm.DB // 数据库连接
+	db       *gorm.DB         // 数据库连接
+	events   *event.Service   // 设备事件服务
+	webhooks *webhook.Service // Webhook推送服务
 }
 
 // NewService 创建新的设备服务实例
 func NewService() *Service {
 	return &Service{
-		db: config.DB,
+		db:       config.DB,
+		events:   event.NewService(),
+		webhooks: webhook.NewService(),
 	}
 }
 
@@ -38,6 +47,7 @@ func (s *Service) CreateDevice(userID uint, name, platform string) (*models.Devi
 	if err := s.db.Create(device).Error; err != nil {
 		return nil, "", err
 	}
+	s.events.Registered(device, "api")
 
 	// 生成安装命令
 	installCommand := generateInstallCommand(device.ID)
@@ -85,7 +95,7 @@ func (s *Service) ListDevices(userID uint, isAdmin bool, page, limit int, filter
 
 	// 计算每个设备的当前状态
 	for _, device := range devices {
-		device.Status = s.calculateDeviceStatus(device.LastSeen)
+		device.Status = Presence(device, time.Now())
 	}
 
 	return devices, total, nil
@@ -108,26 +118,71 @@ func (s *Service) GetDevice(deviceID string, userID uint, isAdmin bool) (*models
 	}
 
 	// 计算设备当前状态
-	device.Status = s.calculateDeviceStatus(device.LastSeen)
+	device.Status = Presence(&device, time.Now())
 
-	// 获取设备指标信息
-	metrics, _ := s.getDeviceMetrics(deviceID)
-	if metrics != nil {
-		device.IPAddress = metrics["ip_address"].(string)
+	return &device, nil
+}
+
+// UpdateDevice 更新设备名称、最大并发数与默认环境变量，未提供的字段保持不变
+func (s *Service) UpdateDevice(deviceID string, userID uint, isAdmin bool, name *string, maxConcurrency *int, envVars map[string]string) (*models.Device, error) {
+	var device models.Device
+
+	query := s.db
+	// 非管理员只能修改自己的设备
+	if !isAdmin {
+		query = query.Where("owner_id = ?", userID)
+	}
+
+	if err := query.First(&device, "id = ?", deviceID).Error; err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if name != nil {
+		updates["name"] = *name
+	}
+	if maxConcurrency != nil {
+		updates["max_concurrency"] = *maxConcurrency
+	}
+	if envVars != nil {
+		envVarsJSON, _ := json.Marshal(envVars)
+		updates["env_vars"] = datatypes.JSON(envVarsJSON)
+	}
+	if len(updates) == 0 {
+		return &device, nil
+	}
+
+	if err := s.db.Model(&device).Updates(updates).Error; err != nil {
+		return nil, err
 	}
 
 	return &device, nil
 }
 
 func (s *Service) DeleteDevices(deviceIDs []string, userID uint, isAdmin bool) (int64, error) {
-	query := s.db.Where("id IN ?", deviceIDs)
+	query := s.db.Model(&models.Device{}).Where("id IN ?", deviceIDs)
 
 	if !isAdmin {
 		query = query.Where("owner_id = ?", userID)
 	}
 
-	result := query.Delete(&models.Device{})
-	return result.RowsAffected, result.Error
+	var ids []string
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result := s.db.Where("id IN ?", ids).Delete(&models.Device{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for _, id := range ids {
+		s.events.Deleted(id, userID)
+	}
+	return result.RowsAffected, nil
 }
 
 func (s *Service) UpdateDeviceStatus(deviceID string, status string) error {
@@ -145,37 +200,59 @@ func (s *Service) GetDeviceStatus(deviceID string) (map[string]interface{}, erro
 		return nil, err
 	}
 
-	device.Status = s.calculateDeviceStatus(device.LastSeen)
+	device.Status = Presence(&device, time.Now())
 
-	metrics, _ := s.getDeviceMetrics(deviceID)
+	metrics, err := s.GetDeviceMetrics(deviceID)
+	if err != nil {
+		return nil, err
+	}
 
 	return map[string]interface{}{
-		"id":           device.ID,
-		"status":       device.Status,
-		"last_updated": device.LastSeen,
-		"metrics":      metrics,
+		"id":                 device.ID,
+		"status":             device.Status,
+		"last_updated":       device.LastSeen,
+		"ip_address":         device.IPAddress,
+		"metrics":            metrics.Values,
+		"metrics_updated_at": metrics.UpdatedAt,
+		"metrics_stale":      metrics.Stale,
 	}, nil
 }
 
-func (s *Service) calculateDeviceStatus(lastSeen time.Time) string {
-	if time.Since(lastSeen) > time.Hour {
-		return models.StatusOffline
-	}
-	return models.StatusOnline
+// DeviceMetrics 设备Agent最近一次心跳上报的指标
+type DeviceMetrics struct {
+	Values    map[string]interface{} // 指标内容，从未上报过时为nil
+	UpdatedAt *time.Time             // 最近一次心跳时间
+	Stale     bool                   // 超过StaleAfter未更新，或从未上报
 }
 
-func (s *Service) getDeviceMetrics(deviceID string) (map[string]interface{}, error) {
+// GetDeviceMetrics 读取设备Agent最近一次心跳上报的指标，设备尚未注册Agent时返回过期的空指标
+func (s *Service) GetDeviceMetrics(deviceID string) (*DeviceMetrics, error) {
 	var agent models.Agent
 	if err := s.db.Where("device_id = ?", deviceID).First(&agent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &DeviceMetrics{Stale: true}, nil
+		}
 		return nil, err
 	}
 
-	return map[string]interface{}{
-		"cpu_usage":    12.3,
-		"memory_usage": 1536,
-		"disk_usage":   41,
-		"ip_address":   "192.168.1.100",
-	}, nil
+	metrics := &DeviceMetrics{Stale: true}
+	if agent.HeartbeatMetrics != "" {
+		if err := json.Unmarshal([]byte(agent.HeartbeatMetrics), &metrics.Values); err != nil {
+			metrics.Values = nil
+		}
+	}
+	if !agent.LastHeartbeat.IsZero() {
+		var device models.Device
+		if err := s.db.Select("heartbeat_interval").First(&device, "id = ?", deviceID).Error; err != nil {
+			return nil, err
+		}
+
+		updatedAt := agent.LastHeartbeat
+		metrics.UpdatedAt = &updatedAt
+		metrics.Stale = metrics.Values == nil || time.Since(updatedAt) > StaleAfter(device.HeartbeatInterval)
+	}
+
+	return metrics, nil
 }
 
 func generateInstallCommand(deviceID string) string {
@@ -0,0 +1,54 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	config.AppConfig = &config.Config{FileDir: t.TempDir(), HeartbeatInterval: 60, DeviceStaleAfter: 3, DeviceOfflineAfter: 5}
+	db := testutil.OpenDB(t)
+
+	db.Create(&models.User{ID: 1, Username: "admin", Password: "x", Role: models.RoleAdmin})
+	return NewService(), db
+}
+
+func TestGetDeviceMetrics(t *testing.T) {
+	s, db := newTestService(t)
+	now := time.Now()
+	db.Create(&models.Device{ID: "dev_1", Name: "web-01", Platform: "linux", OwnerID: 1, Status: models.StatusOnline, LastSeen: now, IPAddress: "203.0.113.24"})
+	db.Create(&models.Device{ID: "dev_2", Name: "web-02", Platform: "linux", OwnerID: 1, Status: models.StatusOnline, LastSeen: now})
+	db.Create(&models.Agent{ID: "agt_1", DeviceID: "dev_1", LastHeartbeat: now, HeartbeatMetrics: `{"cpu_usage":37.5,"memory_used":1024}`})
+
+	// 没有Agent的设备返回过期的空指标
+	metrics, err := s.GetDeviceMetrics("dev_2")
+	if err != nil || metrics.Values != nil || !metrics.Stale || metrics.UpdatedAt != nil {
+		t.Fatalf("metrics without agent = %+v, %v", metrics, err)
+	}
+
+	status, err := s.GetDeviceStatus("dev_1")
+	if err != nil {
+		t.Fatalf("GetDeviceStatus error: %v", err)
+	}
+	values, _ := status["metrics"].(map[string]interface{})
+	if values["cpu_usage"] != 37.5 || status["metrics_stale"] != false || status["ip_address"] != "203.0.113.24" {
+		t.Errorf("status = %+v", status)
+	}
+
+	// 超过失联阈值未心跳的指标标记为过期
+	db.Model(&models.Agent{}).Where("id = ?", "agt_1").Update("last_heartbeat", now.Add(-4*time.Minute))
+	if metrics, _ := s.GetDeviceMetrics("dev_1"); !metrics.Stale || metrics.Values["memory_used"] != float64(1024) {
+		t.Errorf("old metrics = %+v", metrics)
+	}
+
+	// 无法解析的指标视为没有上报
+	db.Model(&models.Agent{}).Where("id = ?", "agt_1").Updates(map[string]interface{}{"last_heartbeat": now, "heartbeat_metrics": "{"})
+	if metrics, _ := s.GetDeviceMetrics("dev_1"); !metrics.Stale || metrics.Values != nil {
+		t.Errorf("corrupt metrics = %+v", metrics)
+	}
+}
@@ -0,0 +1,111 @@
+package device
+
+import (
+	"sync"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/event"
+	"github.com/XRSec/Cslite/internal/execution"
+	"github.com/sirupsen/logrus"
+)
+
+// eventPruneInterval 设备事件清理间隔
+const eventPruneInterval = time.Hour
+
+// Sweeper 定期根据心跳检测设备在线状态，将离线设备上迟迟没有结果的任务标记为丢失，并清理过期的设备事件
+type Sweeper struct {
+	service    *Service
+	executions *execution.Service
+	events     *event.Service
+	lostGrace  time.Duration
+	eventDays  int
+	lastPrune  time.Time
+	interval   time.Duration
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewSweeper 创建新的设备状态巡检实例
+func NewSweeper() *Sweeper {
+	interval := config.AppConfig.DeviceSweepInterval
+	if interval <= 0 {
+		interval = 30
+	}
+
+	return &Sweeper{
+		service:    NewService(),
+		executions: execution.NewService(),
+		events:     event.NewService(),
+		lostGrace:  time.Duration(config.AppConfig.LostResultGrace) * time.Second,
+		eventDays:  config.AppConfig.DeviceEventDays,
+		interval:   time.Duration(interval) * time.Second,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Start 启动巡检循环
+func (w *Sweeper) Start() {
+	w.wg.Add(1)
+	go w.loop()
+}
+
+// Stop 停止巡检循环并等待退出
+func (w *Sweeper) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *Sweeper) loop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.sweep()
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+func (w *Sweeper) sweep() {
+	now := time.Now()
+
+	w.pruneEvents(now)
+
+	changed, err := w.service.SweepPresence(now)
+	if err != nil {
+		logrus.Error("Failed to sweep device presence: ", err)
+		return
+	}
+	if changed > 0 {
+		logrus.Infof("Device presence sweep changed %d devices", changed)
+	}
+
+	// 设备判定离线后再等待lostGrace，仍未恢复才判定任务丢失
+	lostAfter := func(interval int) time.Duration { return OfflineAfter(interval) + w.lostGrace }
+	if err := w.executions.ExpireLost(now, lostAfter); err != nil {
+		logrus.Error("Failed to expire lost results: ", err)
+	}
+}
+
+// pruneEvents 每小时删除一次超过保留天数的设备事件
+func (w *Sweeper) pruneEvents(now time.Time) {
+	if w.eventDays <= 0 || now.Sub(w.lastPrune) < eventPruneInterval {
+		return
+	}
+	w.lastPrune = now
+
+	deleted, err := w.events.Prune(now.AddDate(0, 0, -w.eventDays))
+	if err != nil {
+		logrus.Error("Failed to prune device events: ", err)
+		return
+	}
+	if deleted > 0 {
+		logrus.Infof("Pruned %d device events", deleted)
+	}
+}
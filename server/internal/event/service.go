@@ -0,0 +1,121 @@
+// event 包提供了设备事件的记录服务
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Service 设备事件服务
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建新的设备事件服务实例
+func NewService() *Service {
+	return &Service{
+		db: config.DB,
+	}
+}
+
+// Record 记录一条设备事件，写入失败只记录日志，不影响调用方的主流程
+func (s *Service) Record(deviceID, eventType, message string, details map[string]interface{}) {
+	event := &models.DeviceEvent{
+		DeviceID: deviceID,
+		Type:     eventType,
+		Message:  message,
+	}
+	if len(details) > 0 {
+		event.Details, _ = json.Marshal(details)
+	}
+
+	if err := s.db.Create(event).Error; err != nil {
+		logrus.Errorf("Failed to record %s event for device %s: %v", eventType, deviceID, err)
+	}
+}
+
+// StatusChanged 记录设备在线状态变化
+func (s *Service) StatusChanged(deviceID, from, to, reason string) {
+	s.Record(deviceID, models.DeviceEventStatusChange, "Device status changed from "+from+" to "+to, map[string]interface{}{
+		"from":   from,
+		"to":     to,
+		"reason": reason,
+	})
+}
+
+// Registered 记录设备注册，source为agent（Agent通过API Key注册）或api（在控制台创建）
+func (s *Service) Registered(device *models.Device, source string) {
+	s.Record(device.ID, models.DeviceEventRegister, "Device registered via "+source, map[string]interface{}{
+		"source":   source,
+		"name":     device.Name,
+		"platform": device.Platform,
+		"owner_id": device.OwnerID,
+	})
+}
+
+// HeartbeatGap 记录心跳中断后恢复，interval为配置的心跳间隔
+func (s *Service) HeartbeatGap(deviceID string, lastHeartbeat, now time.Time, interval time.Duration) {
+	gap := now.Sub(lastHeartbeat)
+	missed := 0
+	if interval > 0 {
+		missed = int(gap/interval) - 1
+	}
+	s.Record(deviceID, models.DeviceEventHeartbeatGap, fmt.Sprintf("No heartbeat for %s", gap.Round(time.Second)), map[string]interface{}{
+		"last_heartbeat": lastHeartbeat,
+		"gap_seconds":    int(gap.Seconds()),
+		"missed":         missed,
+	})
+}
+
+// CommandDispatched 记录命令下发到设备，deliveryCount大于1表示未确认后的重新下发
+func (s *Service) CommandDispatched(deviceID string, command *models.Command, result *models.ExecutionResult, deliveryCount int) {
+	s.Record(deviceID, models.DeviceEventCommandDispatch, "Command "+command.Name+" dispatched", map[string]interface{}{
+		"command_id":     command.ID,
+		"execution_id":   result.ExecutionID,
+		"attempt":        result.Attempt,
+		"delivery_count": deliveryCount,
+	})
+}
+
+// CommandResult 记录命令执行结果，source为agent（Agent上报）、timeout或lost（服务端判定）
+func (s *Service) CommandResult(result *models.ExecutionResult, status string, exitCode int, source string) {
+	s.Record(result.DeviceID, models.DeviceEventCommandResult, fmt.Sprintf("Command finished with status %s (exit code %d)", status, exitCode), map[string]interface{}{
+		"execution_id": result.ExecutionID,
+		"attempt":      result.Attempt,
+		"status":       status,
+		"exit_code":    exitCode,
+		"source":       source,
+	})
+}
+
+// GroupChanged 记录设备所属分组变化，分组为空表示未分组
+func (s *Service) GroupChanged(deviceID, from, to, reason string) {
+	message := "Device moved to group " + to
+	if to == "" {
+		message = "Device removed from group " + from
+	}
+	s.Record(deviceID, models.DeviceEventGroupChange, message, map[string]interface{}{
+		"from":   from,
+		"to":     to,
+		"reason": reason,
+	})
+}
+
+// Deleted 记录设备被删除
+func (s *Service) Deleted(deviceID string, userID uint) {
+	s.Record(deviceID, models.DeviceEventDelete, "Device deleted", map[string]interface{}{
+		"deleted_by": userID,
+	})
+}
+
+// Prune 删除早于before的设备事件
+func (s *Service) Prune(before time.Time) (int64, error) {
+	result := s.db.Where("created_at < ?", before).Delete(&models.DeviceEvent{})
+	return result.RowsAffected, result.Error
+}
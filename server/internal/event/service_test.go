@@ -0,0 +1,43 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+)
+
+func TestRecordAndPrune(t *testing.T) {
+	config.AppConfig = &config.Config{FileDir: t.TempDir()}
+	db := testutil.OpenDB(t)
+	s := NewService()
+
+	s.StatusChanged("dev_1", models.StatusOnline, models.StatusStale, "missed_heartbeats")
+	s.Deleted("dev_1", 2)
+
+	var events []models.DeviceEvent
+	db.Order("id").Find(&events)
+	if len(events) != 2 || events[0].Type != models.DeviceEventStatusChange || events[1].Type != models.DeviceEventDelete {
+		t.Fatalf("events = %+v", events)
+	}
+	var details map[string]string
+	json.Unmarshal(events[0].Details, &details)
+	if details["from"] != "online" || details["to"] != "stale" || details["reason"] != "missed_heartbeats" {
+		t.Errorf("details = %s", events[0].Details)
+	}
+
+	// 只删除早于保留期限的事件
+	db.Model(&models.DeviceEvent{}).Where("id = ?", events[0].ID).Update("created_at", time.Now().AddDate(0, 0, -100))
+	deleted, err := s.Prune(time.Now().AddDate(0, 0, -90))
+	if err != nil || deleted != 1 {
+		t.Fatalf("Prune = %d, %v, want 1", deleted, err)
+	}
+	var remaining int64
+	db.Model(&models.DeviceEvent{}).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("remaining events = %d, want 1", remaining)
+	}
+}
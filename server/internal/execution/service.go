@@ -0,0 +1,508 @@
+// execution 包负责命令执行的下发、逐设备结果跟踪与状态汇总
+package execution
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/event"
+	"github.com/XRSec/Cslite/internal/notification"
+	"github.com/XRSec/Cslite/internal/notify"
+	"github.com/XRSec/Cslite/internal/webhook"
+	"github.com/XRSec/Cslite/models"
+	"github.com/XRSec/Cslite/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// resultTimeoutGrace 服务端判定超时前额外等待的时间，留给Agent自行上报timeout结果
+const resultTimeoutGrace = 2 * time.Minute
+
+// Service 执行服务结构体
+type Service struct {
+	db            *gorm.DB              // 数据库连接
+	notifier      *notify.Hub           // 设备唤醒通知
+	webhooks      *webhook.Service      // Webhook推送服务
+	notifications *notification.Service // 邮件与群聊通知服务
+	events        *event.Service        // 设备事件服务
+}
+
+// NewService 创建新的执行服务实例
+func NewService() *Service {
+	return &Service{
+		db:            config.DB,
+		notifier:      notify.Default,
+		webhooks:      webhook.NewService(),
+		notifications: notification.NewService(),
+		events:        event.NewService(),
+	}
+}
+
+// ResolveTargets 解析命令的目标设备列表，groups类型会展开为组内设备
+func (s *Service) ResolveTargets(tx *gorm.DB, command *models.Command) ([]string, error) {
+	var targetIDs []string
+	if command.TargetIDs != nil {
+		if err := json.Unmarshal(command.TargetIDs, &targetIDs); err != nil {
+			return nil, err
+		}
+	}
+	if len(targetIDs) == 0 {
+		return nil, nil
+	}
+
+	query := tx.Model(&models.Device{})
+
+	switch command.TargetType {
+	case models.TargetTypeGroups:
+		query = query.Where("group_id IN ?", targetIDs)
+	default:
+		query = query.Where("id IN ?", targetIDs)
+	}
+
+	// 普通用户只能对自己的设备下发命令
+	var creator models.User
+	if err := tx.First(&creator, command.CreatedBy).Error; err != nil {
+		return nil, err
+	}
+	if !creator.IsAdmin() {
+		query = query.Where("owner_id = ?", command.CreatedBy)
+	}
+
+	var deviceIDs []string
+	if err := query.Pluck("id", &deviceIDs).Error; err != nil {
+		return nil, err
+	}
+
+	return deviceIDs, nil
+}
+
+// Dispatch 为命令创建一次执行，并为每个目标设备生成待执行的结果记录
+// tx为nil时在新事务中执行并在提交后唤醒目标设备，否则由调用方在事务提交后调用NotifyTargets
+func (s *Service) Dispatch(tx *gorm.DB, command *models.Command) (*models.Execution, error) {
+	if tx == nil {
+		var execution *models.Execution
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			execution, err = s.Dispatch(tx, command)
+			return err
+		})
+		if err == nil {
+			s.NotifyTargets(execution)
+		}
+		return execution, err
+	}
+
+	deviceIDs, err := s.ResolveTargets(tx, command)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	execution := &models.Execution{
+		ID:        utils.GenerateExecutionID(),
+		CommandID: command.ID,
+		Status:    models.ExecutionStatusPending,
+		StartedAt: now,
+	}
+
+	// 没有可执行的目标设备时直接判定失败
+	if len(deviceIDs) == 0 {
+		execution.Status = models.ExecutionStatusFailed
+		execution.CompletedAt = &now
+	}
+
+	if err := tx.Create(execution).Error; err != nil {
+		return nil, err
+	}
+
+	// 与Finalize一致，非cron命令随执行结束，避免命令停留在running
+	if len(deviceIDs) == 0 && command.Type != models.CommandTypeCron {
+		if err := tx.Model(&models.Command{}).
+			Where("id = ? AND status <> ?", command.ID, models.CommandStatusCancelled).
+			Update("status", models.CommandStatusFailed).Error; err != nil {
+			return nil, err
+		}
+		command.Status = models.CommandStatusFailed
+	}
+
+	if len(deviceIDs) > 0 {
+		results := make([]*models.ExecutionResult, len(deviceIDs))
+		for i, deviceID := range deviceIDs {
+			results[i] = &models.ExecutionResult{
+				ID:          utils.GenerateExecutionID(),
+				ExecutionID: execution.ID,
+				DeviceID:    deviceID,
+				Attempt:     1,
+				Status:      models.ResultStatusPending,
+				StartedAt:   now,
+			}
+		}
+		if err := tx.Create(&results).Error; err != nil {
+			return nil, err
+		}
+
+		execution.Results = make([]models.ExecutionResult, len(results))
+		for i, result := range results {
+			execution.Results[i] = *result
+		}
+	}
+
+	return execution, nil
+}
+
+// NotifyTargets 唤醒执行的目标设备，使长轮询中的Agent立即拉取任务
+func (s *Service) NotifyTargets(execution *models.Execution) {
+	if execution == nil {
+		return
+	}
+
+	deviceIDs := make([]string, len(execution.Results))
+	for i, result := range execution.Results {
+		deviceIDs[i] = result.DeviceID
+	}
+	s.notifier.Notify(deviceIDs...)
+}
+
+// NotifyCommand 唤醒命令所有未结束执行的目标设备，用于下发暂停、恢复与取消指令
+func (s *Service) NotifyCommand(commandID string) error {
+	var deviceIDs []string
+	if err := s.db.Model(&models.ExecutionResult{}).
+		Joins("JOIN executions ON executions.id = execution_results.execution_id").
+		Where("executions.command_id = ? AND executions.status IN ?", commandID,
+			[]string{models.ExecutionStatusPending, models.ExecutionStatusRunning}).
+		Distinct().
+		Pluck("execution_results.device_id", &deviceIDs).Error; err != nil {
+		return err
+	}
+
+	s.notifier.Notify(deviceIDs...)
+	return nil
+}
+
+// NotifyQueued 唤醒执行中仍在等待下发的目标设备，用于命令并发名额释放后继续下发
+func (s *Service) NotifyQueued(executionID string) error {
+	var deviceIDs []string
+	if err := s.db.Model(&models.ExecutionResult{}).
+		Where("execution_id = ? AND status = ? AND delivery_state = ?", executionID,
+			models.ResultStatusPending, models.DeliveryStateQueued).
+		Distinct().
+		Pluck("device_id", &deviceIDs).Error; err != nil {
+		return err
+	}
+
+	s.notifier.Notify(deviceIDs...)
+	return nil
+}
+
+// Finalize 在所有目标设备都已上报、超时或取消后汇总执行状态
+func (s *Service) Finalize(executionID string) error {
+	var execution models.Execution
+	if err := s.db.Preload("Command").First(&execution, "id = ?", executionID).Error; err != nil {
+		return err
+	}
+
+	if execution.Status != models.ExecutionStatusPending && execution.Status != models.ExecutionStatusRunning {
+		return nil
+	}
+
+	var all []models.ExecutionResult
+	if err := s.db.Where("execution_id = ?", executionID).Order("attempt").Find(&all).Error; err != nil {
+		return err
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	// 每台设备只以最后一次执行的结果参与汇总，失败的结果按重试策略重新下发
+	results := LatestAttempts(all)
+	policy := retryPolicy(&execution.Command)
+	for i, r := range results {
+		if !retryableStatus(r.Status) || !policy.CanRetry(r.Attempt) || execution.Command.Status == models.CommandStatusCancelled {
+			continue
+		}
+
+		retry, err := s.scheduleRetry(&r, policy)
+		if err != nil {
+			return err
+		}
+		results[i] = *retry
+	}
+
+	allDone := true
+	hasRunning := false
+	hasFailure := false
+	allCancelled := true
+	for _, r := range results {
+		switch r.Status {
+		case models.ResultStatusPending:
+			allDone = false
+		case models.ResultStatusRunning:
+			allDone = false
+			hasRunning = true
+		case models.ResultStatusFailed, models.ResultStatusTimeout, models.ResultStatusLost, models.ResultStatusInterpreterUnavailable, models.ResultStatusOOMKilled:
+			hasFailure = true
+		}
+		if r.Status != models.ResultStatusCancelled {
+			allCancelled = false
+		}
+	}
+
+	if !allDone {
+		if hasRunning && execution.Status == models.ExecutionStatusPending {
+			return s.db.Model(&execution).Update("status", models.ExecutionStatusRunning).Error
+		}
+		return nil
+	}
+
+	executionStatus := models.ExecutionStatusCompleted
+	if hasFailure {
+		executionStatus = models.ExecutionStatusFailed
+	} else if allCancelled {
+		executionStatus = models.ExecutionStatusCancelled
+	}
+
+	completedAt := time.Now()
+	result := s.db.Model(&models.Execution{}).
+		Where("id = ? AND status IN ?", executionID, []string{models.ExecutionStatusPending, models.ExecutionStatusRunning}).
+		Updates(map[string]interface{}{
+			"status":       executionStatus,
+			"completed_at": &completedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 已由并发请求完成汇总
+		return nil
+	}
+
+	execution.Status = executionStatus
+	execution.CompletedAt = &completedAt
+	s.webhooks.ExecutionFinished(&execution, results)
+	s.notifications.ExecutionFinished(&execution, results)
+
+	// cron命令在本次执行结束后继续等待下次调度，已取消的命令保持取消状态
+	if execution.Command.Type != models.CommandTypeCron {
+		if err := s.db.Model(&models.Command{}).
+			Where("id = ? AND status <> ?", execution.CommandID, models.CommandStatusCancelled).
+			Update("status", executionStatus).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LatestAttempts 返回每台设备最后一次执行的结果，保持设备首次出现的顺序
+func LatestAttempts(results []models.ExecutionResult) []models.ExecutionResult {
+	index := make(map[string]int)
+	var latest []models.ExecutionResult
+	for _, r := range results {
+		i, ok := index[r.DeviceID]
+		if !ok {
+			index[r.DeviceID] = len(latest)
+			latest = append(latest, r)
+			continue
+		}
+		if r.Attempt > latest[i].Attempt {
+			latest[i] = r
+		}
+	}
+	return latest
+}
+
+// scheduleRetry 为失败的设备结果创建下一次执行，按退避时间延后下发
+// 并发汇总时由 (execution_id, device_id, attempt) 唯一索引保证只创建一次
+func (s *Service) scheduleRetry(failed *models.ExecutionResult, policy *models.RetryPolicy) (*models.ExecutionResult, error) {
+	notBefore := time.Now().Add(policy.Backoff(failed.Attempt))
+	retry := &models.ExecutionResult{
+		ID:          utils.GenerateExecutionID(),
+		ExecutionID: failed.ExecutionID,
+		DeviceID:    failed.DeviceID,
+		Attempt:     failed.Attempt + 1,
+		NotBefore:   &notBefore,
+		Status:      models.ResultStatusPending,
+		StartedAt:   notBefore,
+	}
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(retry)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		logrus.Infof("Execution %s on device %s failed, retry %d scheduled at %s",
+			failed.ExecutionID, failed.DeviceID, retry.Attempt, notBefore.Format(time.RFC3339))
+		return retry, nil
+	}
+
+	// 已由并发请求创建
+	if err := s.db.Where("execution_id = ? AND device_id = ? AND attempt = ?",
+		failed.ExecutionID, failed.DeviceID, failed.Attempt+1).First(retry).Error; err != nil {
+		return nil, err
+	}
+	return retry, nil
+}
+
+// retryPolicy 解析命令的重试策略，未设置时返回nil
+func retryPolicy(command *models.Command) *models.RetryPolicy {
+	if command.RetryPolicy == nil {
+		return nil
+	}
+
+	var policy models.RetryPolicy
+	if err := json.Unmarshal(command.RetryPolicy, &policy); err != nil {
+		return nil
+	}
+	return &policy
+}
+
+// retryableStatus 判断结果状态是否可以重试
+func retryableStatus(status string) bool {
+	return status == models.ResultStatusFailed || status == models.ResultStatusTimeout || status == models.ResultStatusLost
+}
+
+// ExpireTimedOut 将已下发到设备、超过命令超时时间仍未上报的设备结果标记为超时
+// 超时从Agent确认收到（未确认时从下发）开始计算，仍在队列中等待下发的结果不会超时
+func (s *Service) ExpireTimedOut() error {
+	var results []models.ExecutionResult
+	if err := s.db.Preload("Execution.Command").
+		Where("status IN ? AND delivery_state IN ?",
+			[]string{models.ResultStatusPending, models.ResultStatusRunning},
+			[]string{models.DeliveryStateDelivered, models.DeliveryStateAcknowledged, models.DeliveryStateRunning}).
+		Find(&results).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expired := make(map[string]bool)
+	for _, r := range results {
+		startedAt := r.StartedAt
+		if r.AckedAt != nil {
+			startedAt = *r.AckedAt
+		} else if r.DeliveredAt != nil {
+			startedAt = *r.DeliveredAt
+		}
+
+		timeout := time.Duration(r.Execution.Command.Timeout)*time.Second + resultTimeoutGrace
+		if now.Sub(startedAt) < timeout {
+			continue
+		}
+
+		update := s.db.Model(&models.ExecutionResult{}).
+			Where("id = ? AND status = ? AND delivery_state = ?", r.ID, r.Status, r.DeliveryState).
+			Updates(map[string]interface{}{
+				"status":         models.ResultStatusTimeout,
+				"delivery_state": models.DeliveryStateDone,
+				"exit_code":      -1,
+				"completed_at":   &now,
+			})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			continue
+		}
+
+		logrus.Warnf("Execution %s on device %s timed out without result", r.ExecutionID, r.DeviceID)
+		s.events.CommandResult(&r, models.ResultStatusTimeout, -1, "timeout")
+		expired[r.ExecutionID] = true
+	}
+
+	for executionID := range expired {
+		if err := s.Finalize(executionID); err != nil {
+			logrus.Errorf("Failed to finalize execution %s: %v", executionID, err)
+		}
+	}
+
+	return nil
+}
+
+// ExpireLost 将已下发到离线设备、且设备超过lostAfter未心跳仍未上报的结果标记为丢失
+// lostAfter按设备上报的心跳间隔（秒，未上报为0）返回判定丢失的时长，间隔为0时应为最短时长
+// 尚未下发的结果保留在队列中，等待设备重新上线
+func (s *Service) ExpireLost(now time.Time, lostAfter func(heartbeatInterval int) time.Duration) error {
+	var rows []struct {
+		models.ExecutionResult
+		DeviceLastSeen          time.Time
+		DeviceHeartbeatInterval int
+	}
+	if err := s.db.Table("execution_results").
+		Select("execution_results.*, devices.last_seen AS device_last_seen, devices.heartbeat_interval AS device_heartbeat_interval").
+		Joins("JOIN devices ON devices.id = execution_results.device_id").
+		Where("devices.status = ? AND devices.last_seen < ?", models.StatusOffline, now.Add(-lostAfter(0))).
+		Where("execution_results.status IN ? AND execution_results.delivery_state IN ?",
+			[]string{models.ResultStatusPending, models.ResultStatusRunning},
+			[]string{models.DeliveryStateDelivered, models.DeliveryStateAcknowledged, models.DeliveryStateRunning}).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	lost := make(map[string]bool)
+	for _, row := range rows {
+		if !row.DeviceLastSeen.Before(now.Add(-lostAfter(row.DeviceHeartbeatInterval))) {
+			continue
+		}
+
+		r := row.ExecutionResult
+		update := s.db.Model(&models.ExecutionResult{}).
+			Where("id = ? AND status = ?", r.ID, r.Status).
+			Updates(map[string]interface{}{
+				"status":         models.ResultStatusLost,
+				"delivery_state": models.DeliveryStateDone,
+				"exit_code":      -1,
+				"completed_at":   &now,
+			})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			continue
+		}
+
+		logrus.Warnf("Execution %s on device %s lost, device is offline", r.ExecutionID, r.DeviceID)
+		s.events.CommandResult(&r, models.ResultStatusLost, -1, "lost")
+		lost[r.ExecutionID] = true
+	}
+
+	for executionID := range lost {
+		if err := s.Finalize(executionID); err != nil {
+			logrus.Errorf("Failed to finalize execution %s: %v", executionID, err)
+		}
+	}
+
+	return nil
+}
+
+// CancelPending 取消命令尚未开始执行的设备结果
+func (s *Service) CancelPending(commandID string) error {
+	var executionIDs []string
+	if err := s.db.Model(&models.Execution{}).
+		Where("command_id = ? AND status IN ?", commandID, []string{models.ExecutionStatusPending, models.ExecutionStatusRunning}).
+		Pluck("id", &executionIDs).Error; err != nil {
+		return err
+	}
+	if len(executionIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&models.ExecutionResult{}).
+		Where("execution_id IN ? AND status = ?", executionIDs, models.ResultStatusPending).
+		Updates(map[string]interface{}{
+			"status":         models.ResultStatusCancelled,
+			"delivery_state": models.DeliveryStateDone,
+			"completed_at":   &now,
+		}).Error; err != nil {
+		return err
+	}
+
+	for _, executionID := range executionIDs {
+		if err := s.Finalize(executionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
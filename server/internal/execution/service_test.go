@@ -0,0 +1,412 @@
+package execution
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	config.AppConfig = &config.Config{FileDir: t.TempDir()}
+	db := testutil.OpenDB(t)
+
+	db.Create(&models.User{ID: 1, Username: "admin", Password: "x", Role: models.RoleAdmin})
+	db.Create(&models.User{ID: 2, Username: "alice", Password: "x", Role: models.RoleUser})
+	db.Create(&models.Device{ID: "dev_1", Name: "web-01", Platform: "linux", OwnerID: 1, GroupID: "grp_web"})
+	db.Create(&models.Device{ID: "dev_2", Name: "web-02", Platform: "linux", OwnerID: 2, GroupID: "grp_web"})
+	db.Create(&models.Device{ID: "dev_3", Name: "db-01", Platform: "linux", OwnerID: 2})
+	return NewService(), db
+}
+
+func newCommand(id, cmdType, targetType, targets string, createdBy uint) *models.Command {
+	return &models.Command{
+		ID:         id,
+		Name:       id,
+		Type:       cmdType,
+		Content:    "uptime",
+		TargetType: targetType,
+		TargetIDs:  datatypes.JSON(targets),
+		Status:     models.CommandStatusPending,
+		Timeout:    60,
+		CreatedBy:  createdBy,
+	}
+}
+
+// dispatch 创建命令并下发一次执行
+func dispatch(t *testing.T, s *Service, db *gorm.DB, command *models.Command) *models.Execution {
+	t.Helper()
+	if err := db.Create(command).Error; err != nil {
+		t.Fatalf("create command: %v", err)
+	}
+	execution, err := s.Dispatch(nil, command)
+	if err != nil {
+		t.Fatalf("Dispatch error: %v", err)
+	}
+	return execution
+}
+
+// setResult 直接修改设备结果的状态，模拟Agent上报
+func setResult(t *testing.T, db *gorm.DB, executionID, deviceID, status string) {
+	t.Helper()
+	update := db.Model(&models.ExecutionResult{}).
+		Where("execution_id = ? AND device_id = ?", executionID, deviceID).
+		Updates(map[string]interface{}{"status": status, "delivery_state": models.DeliveryStateDone})
+	if update.Error != nil || update.RowsAffected == 0 {
+		t.Fatalf("set result %s/%s: %v", executionID, deviceID, update.Error)
+	}
+}
+
+func resultDevices(execution *models.Execution) string {
+	var deviceIDs []string
+	for _, r := range execution.Results {
+		deviceIDs = append(deviceIDs, r.DeviceID)
+	}
+	sort.Strings(deviceIDs)
+	return strings.Join(deviceIDs, ",")
+}
+
+func TestDispatch(t *testing.T) {
+	s, db := newTestService(t)
+
+	tests := []struct {
+		name    string
+		command *models.Command
+		devices string
+	}{
+		{"devices", newCommand("cmd_1", models.CommandTypeImmediate, models.TargetTypeDevices, `["dev_1","dev_3"]`, 1), "dev_1,dev_3"},
+		{"groups", newCommand("cmd_2", models.CommandTypeImmediate, models.TargetTypeGroups, `["grp_web"]`, 1), "dev_1,dev_2"},
+		{"owner only", newCommand("cmd_3", models.CommandTypeImmediate, models.TargetTypeDevices, `["dev_1","dev_2","dev_3"]`, 2), "dev_2,dev_3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execution := dispatch(t, s, db, tt.command)
+			if execution.Status != models.ExecutionStatusPending {
+				t.Errorf("execution status = %s, want pending", execution.Status)
+			}
+			if got := resultDevices(execution); got != tt.devices {
+				t.Errorf("result devices = %s, want %s", got, tt.devices)
+			}
+
+			var count int64
+			db.Model(&models.ExecutionResult{}).
+				Where("execution_id = ? AND status = ? AND attempt = 1", execution.ID, models.ResultStatusPending).
+				Count(&count)
+			if int(count) != len(execution.Results) {
+				t.Errorf("stored %d pending results, want %d", count, len(execution.Results))
+			}
+		})
+	}
+}
+
+func TestDispatchWithoutTargets(t *testing.T) {
+	s, db := newTestService(t)
+
+	execution := dispatch(t, s, db, newCommand("cmd_1", models.CommandTypeImmediate, models.TargetTypeDevices, `["dev_9"]`, 1))
+	if execution.Status != models.ExecutionStatusFailed || execution.CompletedAt == nil {
+		t.Errorf("execution status = %s, completed_at = %v", execution.Status, execution.CompletedAt)
+	}
+
+	var command models.Command
+	db.First(&command, "id = ?", "cmd_1")
+	if command.Status != models.CommandStatusFailed {
+		t.Errorf("command status = %s, want failed", command.Status)
+	}
+
+	// cron命令保持等待下次调度
+	dispatch(t, s, db, newCommand("cmd_2", models.CommandTypeCron, models.TargetTypeDevices, `[]`, 1))
+	var cron models.Command
+	db.First(&cron, "id = ?", "cmd_2")
+	if cron.Status != models.CommandStatusPending {
+		t.Errorf("cron command status = %s, want pending", cron.Status)
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		cmdType   string
+		statuses  []string
+		execution string
+		command   string
+	}{
+		{"all completed", models.CommandTypeImmediate, []string{models.ResultStatusCompleted, models.ResultStatusCompleted}, models.ExecutionStatusCompleted, models.CommandStatusCompleted},
+		{"one failed", models.CommandTypeImmediate, []string{models.ResultStatusCompleted, models.ResultStatusFailed}, models.ExecutionStatusFailed, models.CommandStatusFailed},
+		{"timeout counts as failure", models.CommandTypeImmediate, []string{models.ResultStatusTimeout, models.ResultStatusCancelled}, models.ExecutionStatusFailed, models.CommandStatusFailed},
+		{"all cancelled", models.CommandTypeImmediate, []string{models.ResultStatusCancelled, models.ResultStatusCancelled}, models.ExecutionStatusCancelled, models.CommandStatusCancelled},
+		{"cancelled and completed", models.CommandTypeImmediate, []string{models.ResultStatusCancelled, models.ResultStatusCompleted}, models.ExecutionStatusCompleted, models.CommandStatusCompleted},
+		{"still pending", models.CommandTypeImmediate, []string{models.ResultStatusCompleted, models.ResultStatusPending}, models.ExecutionStatusPending, models.CommandStatusPending},
+		{"running", models.CommandTypeImmediate, []string{models.ResultStatusRunning, models.ResultStatusPending}, models.ExecutionStatusRunning, models.CommandStatusPending},
+		{"cron keeps command status", models.CommandTypeCron, []string{models.ResultStatusFailed, models.ResultStatusCompleted}, models.ExecutionStatusFailed, models.CommandStatusPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newTestService(t)
+			execution := dispatch(t, s, db, newCommand("cmd_1", tt.cmdType, models.TargetTypeGroups, `["grp_web"]`, 1))
+
+			for i, status := range tt.statuses {
+				if status != models.ResultStatusPending {
+					setResult(t, db, execution.ID, []string{"dev_1", "dev_2"}[i], status)
+				}
+			}
+			if err := s.Finalize(execution.ID); err != nil {
+				t.Fatalf("Finalize error: %v", err)
+			}
+
+			var got models.Execution
+			db.Preload("Command").First(&got, "id = ?", execution.ID)
+			if got.Status != tt.execution || got.Command.Status != tt.command {
+				t.Errorf("execution = %s, command = %s, want %s, %s", got.Status, got.Command.Status, tt.execution, tt.command)
+			}
+			if done := got.CompletedAt != nil; done != (tt.execution != models.ExecutionStatusPending && tt.execution != models.ExecutionStatusRunning) {
+				t.Errorf("completed_at = %v for status %s", got.CompletedAt, got.Status)
+			}
+		})
+	}
+}
+
+func TestFinalizeKeepsFinishedExecution(t *testing.T) {
+	s, db := newTestService(t)
+	execution := dispatch(t, s, db, newCommand("cmd_1", models.CommandTypeImmediate, models.TargetTypeDevices, `["dev_1"]`, 1))
+
+	setResult(t, db, execution.ID, "dev_1", models.ResultStatusCompleted)
+	s.Finalize(execution.ID)
+
+	// 汇总完成后再次汇总不改变结果
+	setResult(t, db, execution.ID, "dev_1", models.ResultStatusFailed)
+	if err := s.Finalize(execution.ID); err != nil {
+		t.Fatalf("Finalize error: %v", err)
+	}
+	var got models.Execution
+	db.First(&got, "id = ?", execution.ID)
+	if got.Status != models.ExecutionStatusCompleted {
+		t.Errorf("execution status = %s, want completed", got.Status)
+	}
+}
+
+func TestLatestAttempts(t *testing.T) {
+	results := []models.ExecutionResult{
+		{DeviceID: "dev_1", Attempt: 1, Status: models.ResultStatusFailed},
+		{DeviceID: "dev_2", Attempt: 1, Status: models.ResultStatusCompleted},
+		{DeviceID: "dev_1", Attempt: 3, Status: models.ResultStatusCompleted},
+		{DeviceID: "dev_1", Attempt: 2, Status: models.ResultStatusFailed},
+	}
+
+	latest := LatestAttempts(results)
+	if len(latest) != 2 || latest[0].DeviceID != "dev_1" || latest[0].Attempt != 3 || latest[1].DeviceID != "dev_2" {
+		t.Errorf("LatestAttempts = %+v", latest)
+	}
+}
+
+func TestExpireTimedOut(t *testing.T) {
+	s, db := newTestService(t)
+	execution := dispatch(t, s, db, newCommand("cmd_1", models.CommandTypeImmediate, models.TargetTypeGroups, `["grp_web"]`, 1))
+
+	// dev_1 确认收到已超过超时时间，dev_2 仍在队列中等待下发
+	acked := time.Now().Add(-60*time.Second - resultTimeoutGrace - time.Second)
+	db.Model(&models.ExecutionResult{}).
+		Where("execution_id = ? AND device_id = ?", execution.ID, "dev_1").
+		Updates(map[string]interface{}{"delivery_state": models.DeliveryStateAcknowledged, "acked_at": acked})
+	db.Model(&models.ExecutionResult{}).
+		Where("execution_id = ? AND device_id = ?", execution.ID, "dev_2").
+		Update("started_at", acked)
+
+	if err := s.ExpireTimedOut(); err != nil {
+		t.Fatalf("ExpireTimedOut error: %v", err)
+	}
+
+	var results []models.ExecutionResult
+	db.Where("execution_id = ?", execution.ID).Order("device_id").Find(&results)
+	if results[0].Status != models.ResultStatusTimeout || results[0].ExitCode != -1 || results[0].DeliveryState != models.DeliveryStateDone {
+		t.Errorf("dev_1 result = %s/%s exit %d, want timeout", results[0].Status, results[0].DeliveryState, results[0].ExitCode)
+	}
+	if results[1].Status != models.ResultStatusPending {
+		t.Errorf("queued dev_2 result = %s, want pending", results[1].Status)
+	}
+
+	// 剩余设备取消后执行汇总为失败
+	if err := s.CancelPending("cmd_1"); err != nil {
+		t.Fatalf("CancelPending error: %v", err)
+	}
+	var got models.Execution
+	db.First(&got, "id = ?", execution.ID)
+	if got.Status != models.ExecutionStatusFailed {
+		t.Errorf("execution status = %s, want failed", got.Status)
+	}
+}
+
+func TestFinalizeSchedulesRetry(t *testing.T) {
+	s, db := newTestService(t)
+	command := newCommand("cmd_1", models.CommandTypeImmediate, models.TargetTypeGroups, `["grp_web"]`, 1)
+	command.RetryPolicy = datatypes.JSON(`{"enabled":true,"max_attempts":2,"backoff_seconds":60}`)
+	execution := dispatch(t, s, db, command)
+
+	setResult(t, db, execution.ID, "dev_1", models.ResultStatusFailed)
+	setResult(t, db, execution.ID, "dev_2", models.ResultStatusCompleted)
+
+	// 并发汇总时重试只创建一次
+	before := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := s.Finalize(execution.ID); err != nil {
+			t.Fatalf("Finalize error: %v", err)
+		}
+	}
+
+	var retries []models.ExecutionResult
+	db.Where("execution_id = ? AND device_id = ? AND attempt = 2", execution.ID, "dev_1").Find(&retries)
+	if len(retries) != 1 {
+		t.Fatalf("retries = %d, want 1", len(retries))
+	}
+	if retries[0].Status != models.ResultStatusPending || retries[0].NotBefore == nil ||
+		retries[0].NotBefore.Before(before.Add(60*time.Second)) {
+		t.Errorf("retry status = %s, not_before = %v", retries[0].Status, retries[0].NotBefore)
+	}
+
+	var got models.Execution
+	db.First(&got, "id = ?", execution.ID)
+	if got.Status != models.ExecutionStatusPending {
+		t.Errorf("execution status = %s while retry is pending", got.Status)
+	}
+
+	// 重试再次失败且达到最大次数后执行失败
+	setResult(t, db, execution.ID, "dev_1", models.ResultStatusFailed)
+	db.Model(&models.ExecutionResult{}).Where("id = ?", retries[0].ID).Update("status", models.ResultStatusFailed)
+	if err := s.Finalize(execution.ID); err != nil {
+		t.Fatalf("Finalize error: %v", err)
+	}
+	var count int64
+	db.Model(&models.ExecutionResult{}).Where("execution_id = ?", execution.ID).Count(&count)
+	db.First(&got, "id = ?", execution.ID)
+	if count != 3 || got.Status != models.ExecutionStatusFailed {
+		t.Errorf("results = %d, execution status = %s, want 3, failed", count, got.Status)
+	}
+}
+
+func TestFinalizeRetriedSuccess(t *testing.T) {
+	s, db := newTestService(t)
+	command := newCommand("cmd_1", models.CommandTypeImmediate, models.TargetTypeDevices, `["dev_1"]`, 1)
+	command.RetryPolicy = datatypes.JSON(`{"enabled":true,"max_attempts":3}`)
+	execution := dispatch(t, s, db, command)
+
+	setResult(t, db, execution.ID, "dev_1", models.ResultStatusTimeout)
+	s.Finalize(execution.ID)
+
+	// 只以最后一次执行的结果汇总
+	db.Model(&models.ExecutionResult{}).
+		Where("execution_id = ? AND attempt = 2", execution.ID).
+		Update("status", models.ResultStatusCompleted)
+	if err := s.Finalize(execution.ID); err != nil {
+		t.Fatalf("Finalize error: %v", err)
+	}
+
+	var got models.Execution
+	db.First(&got, "id = ?", execution.ID)
+	if got.Status != models.ExecutionStatusCompleted {
+		t.Errorf("execution status = %s, want completed", got.Status)
+	}
+}
+
+func TestFinalizeNoRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		status string
+		cancel bool
+	}{
+		{"no policy", ``, models.ResultStatusFailed, false},
+		{"disabled", `{"enabled":false,"max_attempts":3}`, models.ResultStatusFailed, false},
+		{"not retryable", `{"enabled":true,"max_attempts":3}`, models.ResultStatusOOMKilled, false},
+		{"command cancelled", `{"enabled":true,"max_attempts":3}`, models.ResultStatusFailed, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newTestService(t)
+			command := newCommand("cmd_1", models.CommandTypeImmediate, models.TargetTypeDevices, `["dev_1"]`, 1)
+			if tt.policy != "" {
+				command.RetryPolicy = datatypes.JSON(tt.policy)
+			}
+			execution := dispatch(t, s, db, command)
+			if tt.cancel {
+				db.Model(command).Update("status", models.CommandStatusCancelled)
+			}
+
+			setResult(t, db, execution.ID, "dev_1", tt.status)
+			if err := s.Finalize(execution.ID); err != nil {
+				t.Fatalf("Finalize error: %v", err)
+			}
+
+			var count int64
+			db.Model(&models.ExecutionResult{}).Where("execution_id = ?", execution.ID).Count(&count)
+			var got models.Execution
+			db.First(&got, "id = ?", execution.ID)
+			if count != 1 || got.Status != models.ExecutionStatusFailed {
+				t.Errorf("results = %d, execution status = %s, want 1, failed", count, got.Status)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		policy  models.RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{models.RetryPolicy{}, 1, 30 * time.Second},
+		{models.RetryPolicy{}, 3, 120 * time.Second},
+		{models.RetryPolicy{}, 10, 600 * time.Second},
+		{models.RetryPolicy{BackoffSeconds: 10, BackoffMultiplier: 3, MaxBackoffSeconds: 60}, 2, 30 * time.Second},
+		{models.RetryPolicy{BackoffSeconds: 10, BackoffMultiplier: 3, MaxBackoffSeconds: 60}, 3, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("%+v Backoff(%d) = %v, want %v", tt.policy, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestExpireLost(t *testing.T) {
+	s, db := newTestService(t)
+	execution := dispatch(t, s, db, newCommand("cmd_1", models.CommandTypeImmediate, models.TargetTypeDevices, `["dev_1","dev_2","dev_3"]`, 1))
+
+	// 三台设备都已离线20分钟，dev_2的Agent心跳间隔较长尚未判定丢失，dev_3的任务尚未下发
+	now := time.Now()
+	db.Model(&models.Device{}).Where("1 = 1").
+		Updates(map[string]interface{}{"status": models.StatusOffline, "last_seen": now.Add(-20 * time.Minute)})
+	db.Model(&models.Device{}).Where("id = ?", "dev_2").Update("heartbeat_interval", 600)
+	db.Model(&models.ExecutionResult{}).Where("device_id IN ?", []string{"dev_1", "dev_2"}).
+		Update("delivery_state", models.DeliveryStateAcknowledged)
+
+	lostAfter := func(interval int) time.Duration {
+		if interval < 60 {
+			interval = 60
+		}
+		return time.Duration(interval*10) * time.Second
+	}
+	if err := s.ExpireLost(now, lostAfter); err != nil {
+		t.Fatalf("ExpireLost error: %v", err)
+	}
+
+	var results []models.ExecutionResult
+	db.Where("execution_id = ?", execution.ID).Order("device_id").Find(&results)
+	got := results[0].Status + "," + results[1].Status + "," + results[2].Status
+	if got != "lost,pending,pending" || results[0].ExitCode != -1 || results[0].CompletedAt == nil {
+		t.Errorf("result statuses = %s, exit code %d", got, results[0].ExitCode)
+	}
+
+	var events int64
+	db.Model(&models.DeviceEvent{}).Where("device_id = ? AND type = ?", "dev_1", models.DeviceEventCommandResult).Count(&events)
+	if events != 1 {
+		t.Errorf("dev_1 command result events = %d, want 1", events)
+	}
+}
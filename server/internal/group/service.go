@@ -1,19 +1,25 @@
 package group
 
 import (
+	"encoding/json"
+
 	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/event"
 	"github.com/XRSec/Cslite/models"
 	"github.com/XRSec/Cslite/utils"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events *event.Service
 }
 
 func NewService() *Service {
 	return &Service{
-		db: config.DB,
+		db:     config.DB,
+		events: event.NewService(),
 	}
 }
 
@@ -54,6 +60,41 @@ func (s *Service) ListGroups(userID uint, isAdmin bool) ([]*models.Group, error)
 	return groups, nil
 }
 
+// UpdateGroup 更新分组名称、描述与默认环境变量，未提供的字段保持不变
+func (s *Service) UpdateGroup(groupID string, userID uint, isAdmin bool, name, description *string, envVars map[string]string) (*models.Group, error) {
+	var group models.Group
+
+	query := s.db
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	if err := query.First(&group, "id = ?", groupID).Error; err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if name != nil {
+		updates["name"] = *name
+	}
+	if description != nil {
+		updates["description"] = *description
+	}
+	if envVars != nil {
+		envVarsJSON, _ := json.Marshal(envVars)
+		updates["env_vars"] = datatypes.JSON(envVarsJSON)
+	}
+	if len(updates) == 0 {
+		return &group, nil
+	}
+
+	if err := s.db.Model(&group).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
 func (s *Service) AddDevicesToGroup(groupID string, deviceIDs []string, userID uint, isAdmin bool) (int64, error) {
 	var group models.Group
 	query := s.db
@@ -72,8 +113,31 @@ func (s *Service) AddDevicesToGroup(groupID string, deviceIDs []string, userID u
 		deviceQuery = deviceQuery.Where("owner_id = ?", userID)
 	}
 
-	result := deviceQuery.Update("group_id", groupID)
-	return result.RowsAffected, result.Error
+	// 记录分组变化需要设备原来的分组
+	var devices []models.Device
+	if err := deviceQuery.Select("id", "group_id").Find(&devices).Error; err != nil {
+		return 0, err
+	}
+	if len(devices) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+
+	result := s.db.Model(&models.Device{}).Where("id IN ?", ids).Update("group_id", groupID)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for _, d := range devices {
+		if d.GroupID != groupID {
+			s.events.GroupChanged(d.ID, d.GroupID, groupID, "moved")
+		}
+	}
+	return result.RowsAffected, nil
 }
 
 func (s *Service) DeleteGroup(groupID string, userID uint, isAdmin bool) (int64, error) {
@@ -88,10 +152,16 @@ func (s *Service) DeleteGroup(groupID string, userID uint, isAdmin bool) (int64,
 		return 0, err
 	}
 
-	var reassignedCount int64
-	s.db.Model(&models.Device{}).Where("group_id = ?", groupID).Count(&reassignedCount)
+	var deviceIDs []string
+	s.db.Model(&models.Device{}).Where("group_id = ?", groupID).Pluck("id", &deviceIDs)
+	reassignedCount := int64(len(deviceIDs))
 
 	s.db.Model(&models.Device{}).Where("group_id = ?", groupID).Update("group_id", nil)
+	for _, id := range deviceIDs {
+		s.events.GroupChanged(id, groupID, "", "group_deleted")
+	}
+
+	s.db.Where("group_id = ?", groupID).Delete(&models.RetentionRule{})
 
 	if err := s.db.Delete(&group).Error; err != nil {
 		return 0, err
@@ -5,5 +5,10 @@ import "errors"
 
 // 日志相关的错误定义
 var (
-	ErrLogNotFound = errors.New("log file not found") // 日志文件未找到
+	ErrLogNotFound       = errors.New("log file not found")     // 日志文件未找到
+	ErrInvalidLogID      = errors.New("invalid log id")         // 日志ID非法（包含路径穿越等）
+	ErrInvalidLogContent = errors.New("invalid log content")    // 日志内容无法解码
+	ErrUploadOffset      = errors.New("upload offset mismatch") // 日志分片偏移与已接收大小不一致
+	ErrLogTooLarge       = errors.New("log too large")          // 日志超过大小上限
+	ErrDeviceNotFound    = errors.New("device not found")       // 设备不存在或无权访问
 )
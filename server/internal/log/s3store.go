@@ -0,0 +1,422 @@
+package log
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+)
+
+// emptyPayloadHash 空请求体的SHA256摘要
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3AppendLocks 按日志ID哈希分段串行化追加与提交，服务内多个S3Store实例共用
+var s3AppendLocks [64]sync.Mutex
+
+// S3Store S3兼容对象存储的日志存储（AWS S3、MinIO等），使用SigV4签名
+// 流式分片先追加到本地暂存文件，执行结束时一次性上传，避免每个分片都重新上传整个对象
+type S3Store struct {
+	endpoint  *url.URL     // 服务地址，如 http://127.0.0.1:9000
+	region    string       // 区域
+	bucket    string       // 存储桶
+	prefix    string       // 对象键前缀
+	accessKey string       // 访问密钥ID
+	secretKey string       // 访问密钥
+	pathStyle bool         // 是否使用路径风格访问（MinIO需要开启）
+	client    *http.Client // HTTP客户端
+	spool     *LocalStore  // 流式分片的本地暂存
+}
+
+// NewS3Store 根据配置创建S3日志存储实例
+func NewS3Store() *S3Store {
+	endpoint, _ := url.Parse(config.AppConfig.S3Endpoint)
+
+	return &S3Store{
+		endpoint:  endpoint,
+		region:    config.AppConfig.S3Region,
+		bucket:    config.AppConfig.S3Bucket,
+		prefix:    config.AppConfig.S3Prefix,
+		accessKey: config.AppConfig.S3AccessKey,
+		secretKey: config.AppConfig.S3SecretKey,
+		pathStyle: config.AppConfig.S3PathStyle,
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		spool: &LocalStore{
+			baseDir: filepath.Join(config.AppConfig.FileDir, "logs-spool"),
+		},
+	}
+}
+
+// lock 获取日志ID对应的锁
+func (s *S3Store) lock(logID string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(logID))
+	mu := &s3AppendLocks[h.Sum32()%uint32(len(s3AppendLocks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Put 上传完整日志对象，覆盖已有对象并丢弃尚未提交的流式分片
+func (s *S3Store) Put(logID string, r io.Reader) error {
+	if err := validateLogID(logID); err != nil {
+		return err
+	}
+
+	unlock := s.lock(logID)
+	defer unlock()
+
+	if err := s.put(logID, r); err != nil {
+		return err
+	}
+	return s.spool.Delete(logID)
+}
+
+func (s *S3Store) put(logID string, r io.Reader) error {
+	// 签名需要内容摘要，非文件的内容先写入暂存目录的临时文件，再以固定长度流式上传，避免整份日志驻留内存
+	file, ok := r.(*os.File)
+	if !ok {
+		if err := os.MkdirAll(s.spool.baseDir, 0755); err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(s.spool.baseDir, "put-*.tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(tmp, r); err != nil {
+			return err
+		}
+		file = tmp
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodPut, s.prefix+logID, nil, file, size, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkS3Response(resp, http.MethodPut, logID)
+}
+
+// Append 追加日志分片到本地暂存文件，由Commit上传
+func (s *S3Store) Append(logID string, data []byte) error {
+	unlock := s.lock(logID)
+	defer unlock()
+
+	return s.spool.Append(logID, data)
+}
+
+// Commit 将暂存的流式分片上传为日志对象，没有暂存内容时不处理
+func (s *S3Store) Commit(logID string) error {
+	unlock := s.lock(logID)
+	defer unlock()
+
+	file, err := s.spool.Open(logID)
+	if err == ErrLogNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.put(logID, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return s.spool.Delete(logID)
+}
+
+// Open 下载日志对象，对象不存在时读取执行中尚未提交的本地暂存
+func (s *S3Store) Open(logID string) (io.ReadCloser, error) {
+	if err := validateLogID(logID); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodGet, s.prefix+logID, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return s.spool.Open(logID)
+	}
+	if err := checkS3Response(resp, http.MethodGet, logID); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// Delete 删除日志对象及其暂存文件
+func (s *S3Store) Delete(logID string) error {
+	if err := validateLogID(logID); err != nil {
+		return err
+	}
+	if err := s.spool.Delete(logID); err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodDelete, s.prefix+logID, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkS3Response(resp, http.MethodDelete, logID)
+}
+
+// listBucketResult ListObjectsV2 响应结构
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// Stat 获取日志对象的大小与修改时间，对象不存在时读取本地暂存
+func (s *S3Store) Stat(logID string) (*LogObject, error) {
+	if err := validateLogID(logID); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodHead, s.prefix+logID, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return s.spool.Stat(logID)
+	}
+	if err := checkS3Response(resp, http.MethodHead, logID); err != nil {
+		return nil, err
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &LogObject{
+		LogID:   logID,
+		Size:    resp.ContentLength,
+		ModTime: modTime,
+	}, nil
+}
+
+// Walk 按ListObjectsV2分页遍历指定前缀的日志对象，每页为一批
+func (s *S3Store) Walk(prefix string, fn func(objects []*LogObject) error) error {
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("max-keys", strconv.Itoa(walkBatchSize))
+		query.Set("prefix", s.prefix+prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil, 0, emptyPayloadHash)
+		if err != nil {
+			return err
+		}
+
+		if err := checkS3Response(resp, http.MethodGet, "?list-type=2"); err != nil {
+			resp.Body.Close()
+			return err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		objects := make([]*LogObject, 0, len(result.Contents))
+		for _, item := range result.Contents {
+			objects = append(objects, &LogObject{
+				LogID:   strings.TrimPrefix(item.Key, s.prefix),
+				Size:    item.Size,
+				ModTime: item.LastModified,
+			})
+		}
+		if len(objects) > 0 {
+			if err := fn(objects); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do 构造并发送经过SigV4签名的请求，key为空时请求存储桶本身，payloadHash为请求体的SHA256摘要
+func (s *S3Store) do(method, key string, query url.Values, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	if s.endpoint == nil || s.endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint is not configured")
+	}
+
+	host := s.endpoint.Host
+	path := "/"
+	if s.pathStyle {
+		path += s.bucket
+		if key != "" {
+			path += "/" + key
+		}
+	} else {
+		host = s.bucket + "." + host
+		path += key
+	}
+
+	canonicalURI := s3Escape(path, false)
+	canonicalQuery := canonicalQueryString(query)
+
+	rawURL := s.endpoint.Scheme + "://" + host + canonicalURI
+	if canonicalQuery != "" {
+		rawURL += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	s.sign(req, host, canonicalURI, canonicalQuery, payloadHash, time.Now().UTC())
+
+	return s.client.Do(req)
+}
+
+// sign 按SigV4为请求签名，签名头为host、x-amz-content-sha256与x-amz-date
+func (s *S3Store) sign(req *http.Request, host, canonicalURI, canonicalQuery, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// checkS3Response 将非2xx响应转换为错误
+func checkS3Response(resp *http.Response, method, key string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s failed: %s %s", method, key, resp.Status, strings.TrimSpace(string(message)))
+}
+
+// canonicalQueryString 按SigV4规则对查询参数排序并编码
+func canonicalQueryString(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// s3Escape 按RFC 3986编码，encodeSlash为false时保留路径分隔符
+func s3Escape(value string, encodeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			builder.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&builder, "%%%02X", c)
+	}
+	return builder.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
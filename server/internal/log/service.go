@@ -1,29 +1,33 @@
 package log
 
 import (
-	"fmt"
+	"encoding/base64"
+	"errors"
 	"io"
-	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/XRSec/Cslite/config"
 	"github.com/XRSec/Cslite/models"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	db *gorm.DB
+	db    *gorm.DB
+	store LogStore
 }
 
 func NewService() *Service {
 	return &Service{
-		db: config.DB,
+		db:    config.DB,
+		store: NewLogStore(),
 	}
 }
 
 type CommandLog struct {
 	ExecutionID   string `json:"execution_id"`
 	DeviceID      string `json:"device_id"`
+	Attempt       int    `json:"attempt"`
 	Status        string `json:"status"`
 	ExitCode      int    `json:"exit_code"`
 	OutputPreview string `json:"output_preview"`
@@ -33,11 +37,20 @@ type CommandLog struct {
 }
 
 type DeviceLog struct {
-	ID        string `json:"id"`
-	DeviceID  string `json:"device_id"`
-	Type      string `json:"type"`
-	Timestamp string `json:"timestamp"`
-	Message   string `json:"message"`
+	ID        uint64         `json:"id"`
+	DeviceID  string         `json:"device_id"`
+	Type      string         `json:"type"`
+	Timestamp string         `json:"timestamp"`
+	Message   string         `json:"message"`
+	Details   datatypes.JSON `json:"details,omitempty"`
+}
+
+// DeviceLogFilter 设备日志查询条件，From/To为零值时不限制
+type DeviceLogFilter struct {
+	DeviceID string
+	Type     string
+	From     time.Time
+	To       time.Time
 }
 
 type UserLog struct {
@@ -84,10 +97,11 @@ func (s *Service) GetCommandLogs(commandID string, deviceID string, status strin
 		log := &CommandLog{
 			ExecutionID:   result.ExecutionID,
 			DeviceID:      result.DeviceID,
+			Attempt:       result.Attempt,
 			Status:        result.Status,
 			ExitCode:      result.ExitCode,
 			OutputPreview: outputPreview,
-			LogURL:        fmt.Sprintf("/logs/download/%s_%s.log", result.ExecutionID, result.DeviceID),
+			LogURL:        DownloadURL(result.LogPath),
 			StartedAt:     result.StartedAt.Format("2006-01-02T15:04:05Z"),
 		}
 
@@ -101,25 +115,56 @@ func (s *Service) GetCommandLogs(commandID string, deviceID string, status strin
 	return logs, total, nil
 }
 
-func (s *Service) GetDeviceLogs(deviceID string, logType string, page, limit int) ([]*DeviceLog, int64, error) {
-	logs := []*DeviceLog{
-		{
-			ID:        "log_dev_001",
-			DeviceID:  deviceID,
-			Type:      "heartbeat",
-			Timestamp: "2025-06-20T03:00:00Z",
-			Message:   "CPU: 12%, Memory: 1523MB",
-		},
-		{
-			ID:        "log_dev_002",
-			DeviceID:  deviceID,
-			Type:      "register",
-			Timestamp: "2025-06-20T02:00:00Z",
-			Message:   "Device registered successfully",
-		},
+// GetDeviceLogs 按时间倒序查询设备事件，非管理员只能查询自己的设备，已删除设备的事件仍可查询
+func (s *Service) GetDeviceLogs(userID uint, isAdmin bool, filter DeviceLogFilter, page, limit int) ([]*DeviceLog, int64, error) {
+	deviceQuery := s.db.Unscoped().Select("id").Where("id = ?", filter.DeviceID)
+	if !isAdmin {
+		deviceQuery = deviceQuery.Where("owner_id = ?", userID)
 	}
 
-	return logs, 2, nil
+	var device models.Device
+	if err := deviceQuery.First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, ErrDeviceNotFound
+		}
+		return nil, 0, err
+	}
+
+	query := s.db.Model(&models.DeviceEvent{}).Where("device_id = ?", filter.DeviceID)
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at <= ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.DeviceEvent
+	offset := (page - 1) * limit
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+
+	logs := make([]*DeviceLog, len(events))
+	for i, e := range events {
+		logs[i] = &DeviceLog{
+			ID:        e.ID,
+			DeviceID:  e.DeviceID,
+			Type:      e.Type,
+			Timestamp: e.CreatedAt.Format(time.RFC3339),
+			Message:   e.Message,
+			Details:   e.Details,
+		}
+	}
+
+	return logs, total, nil
 }
 
 func (s *Service) GetUserLogs(userID uint, action string, page, limit int) ([]*UserLog, int64, error) {
@@ -145,16 +190,63 @@ func (s *Service) GetUserLogs(userID uint, action string, page, limit int) ([]*U
 	return logs, 2, nil
 }
 
-func (s *Service) DownloadLog(logID string) (io.ReadCloser, error) {
-	logPath := filepath.Join(config.AppConfig.FileDir, "logs", logID)
+func (s *Service) DownloadLog(logID string, userID uint, isAdmin bool) (io.ReadCloser, error) {
+	if !logIDPattern.MatchString(logID) {
+		return nil, ErrInvalidLogID
+	}
 
-	file, err := os.Open(logPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrLogNotFound
-		}
+	// 仅允许下载自己创建的命令产生的日志
+	query := s.db.Model(&models.ExecutionResult{}).
+		Joins("JOIN executions ON execution_results.execution_id = executions.id").
+		Joins("JOIN commands ON executions.command_id = commands.id").
+		Where("execution_results.log_path = ?", logID)
+
+	if !isAdmin {
+		query = query.Where("commands.created_by = ?", userID)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
 		return nil, err
 	}
+	if count == 0 {
+		return nil, ErrLogNotFound
+	}
+
+	return s.store.Open(logID)
+}
+
+// WriteEncodedLog 解码Base64日志内容并完整写入存储
+func (s *Service) WriteEncodedLog(logID, encoded string) error {
+	content, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidLogContent
+	}
+
+	return putBytes(s.store, logID, content)
+}
+
+// AppendLog 向日志追加分片内容
+func (s *Service) AppendLog(logID string, data []byte) error {
+	return s.store.Append(logID, data)
+}
+
+// CommitLog 持久化流式追加的日志
+func (s *Service) CommitLog(logID string) error {
+	return s.store.Commit(logID)
+}
+
+// DeleteLog 删除日志
+func (s *Service) DeleteLog(logID string) error {
+	return s.store.Delete(logID)
+}
+
+// StatLog 获取存储中日志的大小与修改时间
+func (s *Service) StatLog(logID string) (*LogObject, error) {
+	return s.store.Stat(logID)
+}
 
-	return file, nil
+// WalkLogs 分批遍历存储中指定前缀的日志
+func (s *Service) WalkLogs(prefix string, fn func(objects []*LogObject) error) error {
+	return s.store.Walk(prefix, fn)
 }
@@ -0,0 +1,118 @@
+package log
+
+import (
+	"encoding/base64"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	config.AppConfig = &config.Config{FileDir: t.TempDir()}
+	db := testutil.OpenDB(t)
+	return NewService(), db
+}
+
+func TestWriteEncodedLogDownload(t *testing.T) {
+	s, db := newTestService(t)
+	logID := LogID("exec_1", "dev_1", 1)
+
+	db.Create(&models.Command{ID: "cmd_1", Name: "uptime", Type: models.CommandTypeImmediate, Content: "uptime", TargetType: models.TargetTypeDevices, CreatedBy: 2})
+	db.Create(&models.Execution{ID: "exec_1", CommandID: "cmd_1", Status: models.ExecutionStatusCompleted})
+	db.Create(&models.ExecutionResult{ID: "res_1", ExecutionID: "exec_1", DeviceID: "dev_1", Attempt: 1, Status: models.ResultStatusCompleted, LogPath: logID})
+
+	if err := s.WriteEncodedLog(logID, "not base64!"); err != ErrInvalidLogContent {
+		t.Errorf("WriteEncodedLog invalid content error = %v, want ErrInvalidLogContent", err)
+	}
+	if err := s.WriteEncodedLog(logID, base64.StdEncoding.EncodeToString([]byte("line 1\nline 2\n"))); err != nil {
+		t.Fatalf("WriteEncodedLog error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		logID   string
+		userID  uint
+		isAdmin bool
+		err     error
+	}{
+		{"creator", logID, 2, false, nil},
+		{"admin", logID, 1, true, nil},
+		{"other user", logID, 3, false, ErrLogNotFound},
+		{"unknown log", "exec_2_dev_1.log", 1, true, ErrLogNotFound},
+		{"path traversal", "../cslite.db", 1, true, ErrInvalidLogID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := s.DownloadLog(tt.logID, tt.userID, tt.isAdmin)
+			if err != tt.err {
+				t.Fatalf("DownloadLog error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			defer r.Close()
+			data, _ := io.ReadAll(r)
+			if string(data) != "line 1\nline 2\n" {
+				t.Errorf("DownloadLog = %q", data)
+			}
+		})
+	}
+}
+
+func TestGetDeviceLogs(t *testing.T) {
+	s, db := newTestService(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	db.Create(&models.Device{ID: "dev_1", Name: "web-01", Platform: "linux", OwnerID: 2})
+	db.Create(&models.Device{ID: "dev_2", Name: "web-02", Platform: "linux", OwnerID: 2})
+	events := []models.DeviceEvent{
+		{DeviceID: "dev_1", Type: models.DeviceEventRegister, Message: "Device registered via agent", CreatedAt: now.Add(-3 * time.Hour)},
+		{DeviceID: "dev_1", Type: models.DeviceEventStatusChange, Message: "Device status changed from online to stale", CreatedAt: now.Add(-2 * time.Hour)},
+		{DeviceID: "dev_1", Type: models.DeviceEventStatusChange, Message: "Device status changed from stale to online", CreatedAt: now.Add(-time.Hour)},
+		{DeviceID: "dev_2", Type: models.DeviceEventDelete, Message: "Device deleted", CreatedAt: now},
+	}
+	for i := range events {
+		db.Create(&events[i])
+	}
+	db.Delete(&models.Device{}, "id = ?", "dev_2")
+
+	tests := []struct {
+		name    string
+		userID  uint
+		isAdmin bool
+		filter  DeviceLogFilter
+		page    int
+		total   int64
+		first   string
+		err     error
+	}{
+		{"newest first", 2, false, DeviceLogFilter{DeviceID: "dev_1"}, 1, 3, "Device status changed from stale to online", nil},
+		{"second page", 2, false, DeviceLogFilter{DeviceID: "dev_1"}, 2, 3, "Device registered via agent", nil},
+		{"by type", 2, false, DeviceLogFilter{DeviceID: "dev_1", Type: models.DeviceEventRegister}, 1, 1, "Device registered via agent", nil},
+		{"time range", 1, true, DeviceLogFilter{DeviceID: "dev_1", From: now.Add(-150 * time.Minute), To: now.Add(-90 * time.Minute)}, 1, 1, "Device status changed from online to stale", nil},
+		{"deleted device", 2, false, DeviceLogFilter{DeviceID: "dev_2"}, 1, 1, "Device deleted", nil},
+		{"other user", 3, false, DeviceLogFilter{DeviceID: "dev_1"}, 1, 0, "", ErrDeviceNotFound},
+		{"unknown device", 1, true, DeviceLogFilter{DeviceID: "dev_9"}, 1, 0, "", ErrDeviceNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, total, err := s.GetDeviceLogs(tt.userID, tt.isAdmin, tt.filter, tt.page, 2)
+			if err != tt.err {
+				t.Fatalf("GetDeviceLogs error = %v, want %v", err, tt.err)
+			}
+			if total != tt.total {
+				t.Errorf("total = %d, want %d", total, tt.total)
+			}
+			if tt.first != "" && (len(logs) == 0 || logs[0].Message != tt.first) {
+				t.Errorf("logs = %+v, want first %q", logs, tt.first)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+)
+
+// 日志存储后端类型
+const (
+	StorageLocal = "local" // 本地文件系统
+	StorageS3    = "s3"    // S3兼容对象存储
+)
+
+// logIDPattern 日志ID只允许字母、数字、下划线、中划线和点，防止路径穿越
+var logIDPattern = regexp.MustCompile(`^[A-Za-z0-9_\-.]+$`)
+
+// LogStore 执行日志存储后端接口
+type LogStore interface {
+	Put(logID string, r io.Reader) error      // 写入完整日志内容，覆盖已有内容
+	Append(logID string, data []byte) error   // 追加日志分片，日志不存在时自动创建
+	Commit(logID string) error                // 持久化追加的分片，执行结束且未上报完整日志时调用
+	Open(logID string) (io.ReadCloser, error) // 打开日志用于读取
+	Delete(logID string) error                // 删除日志，日志不存在时不报错
+	Stat(logID string) (*LogObject, error)    // 获取日志信息，日志不存在时返回ErrLogNotFound
+
+	// Walk 分批遍历指定前缀的日志，每批最多walkBatchSize条，fn返回错误时停止遍历
+	Walk(prefix string, fn func(objects []*LogObject) error) error
+}
+
+// walkBatchSize 遍历日志时每批的数量
+const walkBatchSize = 1000
+
+// LogObject 存储中的日志对象信息
+type LogObject struct {
+	LogID   string    `json:"log_id"`   // 日志ID
+	Size    int64     `json:"size"`     // 日志大小（字节）
+	ModTime time.Time `json:"mod_time"` // 最后修改时间
+}
+
+// NewLogStore 根据配置创建日志存储后端
+func NewLogStore() LogStore {
+	if config.AppConfig.LogStorage == StorageS3 {
+		return NewS3Store()
+	}
+	return NewLocalStore()
+}
+
+// LogID 生成设备执行结果对应的日志ID，同时作为 ExecutionResult.LogPath 保存
+// 重试产生的执行在ID中追加执行次数，首次执行保持原有格式
+func LogID(executionID, deviceID string, attempt int) string {
+	if attempt > 1 {
+		return executionID + "_" + deviceID + "_" + strconv.Itoa(attempt) + ".log"
+	}
+	return executionID + "_" + deviceID + ".log"
+}
+
+// DownloadURL 返回日志ID对应的下载地址
+func DownloadURL(logID string) string {
+	if logID == "" {
+		return ""
+	}
+	return "/logs/download/" + logID
+}
+
+// validateLogID 校验日志ID，拒绝包含路径分隔符或相对路径的ID
+func validateLogID(logID string) error {
+	if !logIDPattern.MatchString(logID) || logID == "." || logID == ".." || filepath.Base(logID) != logID {
+		return ErrInvalidLogID
+	}
+	return nil
+}
+
+// LocalStore 本地文件系统日志存储，日志保存在 FileDir/logs 目录下
+type LocalStore struct {
+	baseDir string // 日志文件根目录
+}
+
+// NewLocalStore 创建新的本地日志存储实例
+func NewLocalStore() *LocalStore {
+	return &LocalStore{
+		baseDir: filepath.Join(config.AppConfig.FileDir, "logs"),
+	}
+}
+
+// Put 写入完整日志内容，覆盖已有文件
+func (s *LocalStore) Put(logID string, r io.Reader) error {
+	path, err := s.resolve(logID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免下载到写了一半的日志
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Append 向日志文件追加分片内容，文件不存在时自动创建
+func (s *LocalStore) Append(logID string, data []byte) error {
+	path, err := s.resolve(logID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(data)
+	return err
+}
+
+// Commit 本地文件追加时已直接写入，无需处理
+func (s *LocalStore) Commit(logID string) error {
+	_, err := s.resolve(logID)
+	return err
+}
+
+// Open 打开日志文件用于读取
+func (s *LocalStore) Open(logID string) (io.ReadCloser, error) {
+	path, err := s.resolve(logID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrLogNotFound
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Delete 删除日志文件
+func (s *LocalStore) Delete(logID string) error {
+	path, err := s.resolve(logID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stat 获取日志文件的大小与修改时间
+func (s *LocalStore) Stat(logID string) (*LogObject, error) {
+	path, err := s.resolve(logID)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrLogNotFound
+		}
+		return nil, err
+	}
+
+	return &LogObject{
+		LogID:   logID,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// Walk 分批读取目录并遍历指定前缀的日志文件，顺序不固定
+func (s *LocalStore) Walk(prefix string, fn func(objects []*LogObject) error) error {
+	dir, err := os.Open(s.baseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer dir.Close()
+
+	for {
+		entries, err := dir.ReadDir(walkBatchSize)
+		if len(entries) == 0 {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		objects := make([]*LogObject, 0, len(entries))
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) || strings.HasSuffix(entry.Name(), ".tmp") {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			objects = append(objects, &LogObject{
+				LogID:   entry.Name(),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+			})
+		}
+
+		if len(objects) > 0 {
+			if err := fn(objects); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resolve 校验日志ID并返回其在存储目录中的绝对路径
+func (s *LocalStore) resolve(logID string) (string, error) {
+	if err := validateLogID(logID); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.baseDir, logID)
+	if filepath.Dir(path) != filepath.Clean(s.baseDir) {
+		return "", ErrInvalidLogID
+	}
+
+	return path, nil
+}
+
+// putBytes 以字节内容写入日志
+func putBytes(store LogStore, logID string, content []byte) error {
+	return store.Put(logID, bytes.NewReader(content))
+}
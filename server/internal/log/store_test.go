@@ -0,0 +1,97 @@
+package log
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestValidateLogID(t *testing.T) {
+	tests := []struct {
+		logID string
+		valid bool
+	}{
+		{"exec_20250619_dev_abc123.log", true},
+		{"exec_1_dev-1_2.log", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../secret.log", false},
+		{"a/b.log", false},
+		{`a\b.log`, false},
+		{"exec 1.log", false},
+		{"exec_1.log\x00", false},
+	}
+
+	for _, tt := range tests {
+		err := validateLogID(tt.logID)
+		if tt.valid && err != nil {
+			t.Errorf("validateLogID(%q) = %v, want nil", tt.logID, err)
+		}
+		if !tt.valid && err != ErrInvalidLogID {
+			t.Errorf("validateLogID(%q) = %v, want ErrInvalidLogID", tt.logID, err)
+		}
+	}
+}
+
+func TestLogID(t *testing.T) {
+	if got := LogID("exec_1", "dev_1", 1); got != "exec_1_dev_1.log" {
+		t.Errorf("LogID attempt 1 = %q", got)
+	}
+	if got := LogID("exec_1", "dev_1", 3); got != "exec_1_dev_1_3.log" {
+		t.Errorf("LogID attempt 3 = %q", got)
+	}
+}
+
+func TestLocalStoreAppendCommit(t *testing.T) {
+	store := &LocalStore{baseDir: t.TempDir()}
+
+	store.Append("exec_1_dev_1.log", []byte("a"))
+	store.Append("exec_1_dev_1.log", []byte("b"))
+	if err := store.Commit("exec_1_dev_1.log"); err != nil {
+		t.Fatalf("Commit error: %v", err)
+	}
+	if got := readLog(t, store, "exec_1_dev_1.log"); got != "ab" {
+		t.Errorf("Open = %q, want %q", got, "ab")
+	}
+	if err := store.Commit("../x"); err != ErrInvalidLogID {
+		t.Errorf("Commit invalid id error = %v, want ErrInvalidLogID", err)
+	}
+}
+
+func TestLocalStoreStatWalk(t *testing.T) {
+	store := &LocalStore{baseDir: t.TempDir()}
+
+	if err := store.Walk("", func([]*LogObject) error { return nil }); err != nil {
+		t.Fatalf("Walk on empty store error: %v", err)
+	}
+
+	total := walkBatchSize + 5
+	for i := 0; i < total; i++ {
+		store.Append("exec_"+strconv.Itoa(i)+".log", []byte("abc"))
+	}
+	store.Append("other.log", []byte("abc"))
+
+	seen := make(map[string]bool)
+	err := store.Walk("exec_", func(batch []*LogObject) error {
+		for _, object := range batch {
+			if object.Size != 3 {
+				t.Errorf("Walk object %s size = %d, want 3", object.LogID, object.Size)
+			}
+			seen[object.LogID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk error: %v", err)
+	}
+	if len(seen) != total || seen["other.log"] {
+		t.Errorf("Walk visited %d logs, want %d with prefix", len(seen), total)
+	}
+
+	if object, err := store.Stat("exec_0.log"); err != nil || object.Size != 3 {
+		t.Errorf("Stat = %+v, %v", object, err)
+	}
+	if _, err := store.Stat("missing.log"); err != ErrLogNotFound {
+		t.Errorf("Stat missing error = %v, want ErrLogNotFound", err)
+	}
+}
@@ -0,0 +1,158 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/XRSec/Cslite/config"
+)
+
+// uploadDir 分片上传的暂存目录，上传完成后解压写入日志存储
+func uploadDir() string {
+	return filepath.Join(config.AppConfig.FileDir, "uploads")
+}
+
+// uploadLocks 按日志ID串行化同一日志的分片追加、完成与丢弃，避免并发请求交错写入暂存文件
+var uploadLocks [64]sync.Mutex
+
+func lockUpload(logID string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(logID))
+	mu := &uploadLocks[h.Sum32()%uint32(len(uploadLocks))]
+	mu.Lock()
+	return mu
+}
+
+// AppendUpload 按偏移追加gzip压缩的日志分片，返回已接收的字节数
+// 偏移小于已接收大小且分片已完整接收时视为重复上传，不做修改
+func (s *Service) AppendUpload(logID string, offset int64, data []byte) (int64, error) {
+	if err := validateLogID(logID); err != nil {
+		return 0, err
+	}
+	defer lockUpload(logID).Unlock()
+
+	if err := os.MkdirAll(uploadDir(), 0755); err != nil {
+		return 0, err
+	}
+
+	path := filepath.Join(uploadDir(), logID+".gz.part")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	received := info.Size()
+
+	if offset < received && offset+int64(len(data)) <= received {
+		return received, nil
+	}
+	if offset != received {
+		return received, ErrUploadOffset
+	}
+	// 压缩后的大小不会超过上限，超过时直接拒绝
+	if offset+int64(len(data)) > maxLogSize() {
+		file.Close()
+		os.Remove(path)
+		return 0, ErrLogTooLarge
+	}
+
+	if _, err := file.WriteAt(data, offset); err != nil {
+		return received, err
+	}
+	return received + int64(len(data)), nil
+}
+
+// CompleteUpload 解压已接收的日志并完整写入存储，随后删除暂存文件
+func (s *Service) CompleteUpload(logID string) error {
+	if err := validateLogID(logID); err != nil {
+		return err
+	}
+	defer lockUpload(logID).Unlock()
+
+	path := filepath.Join(uploadDir(), logID+".gz.part")
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		os.Remove(path)
+		return ErrInvalidLogContent
+	}
+	defer reader.Close()
+
+	// 内容损坏或解压后超过上限时丢弃暂存文件，存储写入失败时保留，等待Agent重新提交最后一个分片
+	if err := s.store.Put(logID, &maxSizeReader{r: reader, remaining: maxLogSize()}); err != nil {
+		if errors.Is(err, ErrLogTooLarge) {
+			os.Remove(path)
+			return ErrLogTooLarge
+		}
+		if errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, io.ErrUnexpectedEOF) {
+			os.Remove(path)
+			return ErrInvalidLogContent
+		}
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// DiscardUpload 删除未完成上传的暂存文件
+func (s *Service) DiscardUpload(logID string) error {
+	if err := validateLogID(logID); err != nil {
+		return err
+	}
+	defer lockUpload(logID).Unlock()
+
+	err := os.Remove(filepath.Join(uploadDir(), logID+".gz.part"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// maxLogSize 单个日志的大小上限（字节）
+func maxLogSize() int64 {
+	size := config.AppConfig.LogMaxSizeMB
+	if size <= 0 {
+		size = 256
+	}
+	return size * 1024 * 1024
+}
+
+// maxSizeReader 读取超过remaining字节时返回ErrLogTooLarge，防止解压炸弹
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.remaining <= 0 {
+		var b [1]byte
+		if n, err := m.r.Read(b[:]); n > 0 {
+			return 0, ErrLogTooLarge
+		} else if err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+
+	if int64(len(p)) > m.remaining {
+		p = p[:m.remaining]
+	}
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	return n, err
+}
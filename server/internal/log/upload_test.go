@@ -0,0 +1,146 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/XRSec/Cslite/config"
+)
+
+func newTestUploadService(t *testing.T) *Service {
+	config.AppConfig = &config.Config{FileDir: t.TempDir(), LogMaxSizeMB: 1}
+	return &Service{store: &LocalStore{baseDir: t.TempDir()}}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+func TestCompleteUpload(t *testing.T) {
+	service := newTestUploadService(t)
+	logID := "exec_1_dev_1.log"
+	content := strings.Repeat("line\n", 1000)
+	data := gzipBytes(t, []byte(content))
+
+	half := len(data) / 2
+	if received, err := service.AppendUpload(logID, 0, data[:half]); err != nil || received != int64(half) {
+		t.Fatalf("AppendUpload first part = %d, %v", received, err)
+	}
+	if _, err := service.AppendUpload(logID, 0, data[:half]); err != nil {
+		t.Fatalf("AppendUpload retry of received part error: %v", err)
+	}
+	if _, err := service.AppendUpload(logID, int64(half+1), data[half:]); err != ErrUploadOffset {
+		t.Fatalf("AppendUpload with gap error = %v, want ErrUploadOffset", err)
+	}
+	if _, err := service.AppendUpload(logID, int64(half), data[half:]); err != nil {
+		t.Fatalf("AppendUpload second part error: %v", err)
+	}
+
+	if err := service.CompleteUpload(logID); err != nil {
+		t.Fatalf("CompleteUpload error: %v", err)
+	}
+	if got := readLog(t, service.store, logID); got != content {
+		t.Errorf("stored log has %d bytes, want %d", len(got), len(content))
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir(), logID+".gz.part")); !os.IsNotExist(err) {
+		t.Errorf("part file not removed: %v", err)
+	}
+}
+
+func TestCompleteUploadRejectsGzipBomb(t *testing.T) {
+	service := newTestUploadService(t)
+	logID := "exec_1_dev_1.log"
+
+	// 2MB的零字节压缩后只有几KB，解压后超过1MB的上限
+	data := gzipBytes(t, make([]byte, 2*1024*1024))
+	if _, err := service.AppendUpload(logID, 0, data); err != nil {
+		t.Fatalf("AppendUpload error: %v", err)
+	}
+
+	if err := service.CompleteUpload(logID); err != ErrLogTooLarge {
+		t.Fatalf("CompleteUpload error = %v, want ErrLogTooLarge", err)
+	}
+	if _, err := service.store.Open(logID); err != ErrLogNotFound {
+		t.Errorf("truncated log was stored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir(), logID+".gz.part")); !os.IsNotExist(err) {
+		t.Errorf("part file not removed: %v", err)
+	}
+}
+
+func TestAppendUploadRejectsOversizedPart(t *testing.T) {
+	service := newTestUploadService(t)
+
+	_, err := service.AppendUpload("exec_1_dev_1.log", 0, make([]byte, 1024*1024+1))
+	if err != ErrLogTooLarge {
+		t.Fatalf("AppendUpload error = %v, want ErrLogTooLarge", err)
+	}
+}
+
+func TestCompleteUploadRejectsInvalidGzip(t *testing.T) {
+	service := newTestUploadService(t)
+	logID := "exec_1_dev_1.log"
+
+	if _, err := service.AppendUpload(logID, 0, []byte("not gzip")); err != nil {
+		t.Fatalf("AppendUpload error: %v", err)
+	}
+	if err := service.CompleteUpload(logID); err != ErrInvalidLogContent {
+		t.Fatalf("CompleteUpload error = %v, want ErrInvalidLogContent", err)
+	}
+}
+
+func TestAppendUploadConcurrent(t *testing.T) {
+	service := newTestUploadService(t)
+	logID := "exec_1_dev_1.log"
+
+	// 多个请求同时上传偏移0的不同分片，只有一个写入，其余视为重复或偏移不一致
+	const writers = 32
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	written := 0
+	start := make(chan struct{})
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := bytes.Repeat([]byte{byte('A' + i)}, 1024*(i+1))
+			<-start
+			received, err := service.AppendUpload(logID, 0, data)
+			if err == nil && received == int64(len(data)) {
+				mu.Lock()
+				written++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	data, err := os.ReadFile(filepath.Join(uploadDir(), logID+".gz.part"))
+	if err != nil {
+		t.Fatalf("read part file: %v", err)
+	}
+	if written != 1 || int(data[0]-'A'+1)*1024 != len(data) || !bytes.Equal(data, bytes.Repeat(data[:1], len(data))) {
+		t.Errorf("%d writers succeeded, part file has %d bytes starting with %q", written, len(data), data[:1])
+	}
+
+	if err := service.DiscardUpload(logID); err != nil {
+		t.Fatalf("DiscardUpload error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir(), logID+".gz.part")); !os.IsNotExist(err) {
+		t.Errorf("part file not removed: %v", err)
+	}
+	if err := service.DiscardUpload(logID); err != nil {
+		t.Errorf("DiscardUpload without part file error: %v", err)
+	}
+}
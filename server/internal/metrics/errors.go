@@ -0,0 +1,11 @@
+// metrics 包提供了设备指标历史的记录、汇总与查询服务
+package metrics
+
+import "errors"
+
+// 指标历史相关的错误定义
+var (
+	ErrInvalidRange  = errors.New("invalid metrics time range") // 查询时间范围无效
+	ErrInvalidStep   = errors.New("invalid metrics step")       // 查询步长无效
+	ErrTooManyPoints = errors.New("too many metrics points")    // 查询返回的数据点过多
+)
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Roller 定期汇总指标历史并清理超出保留时间的样本
+type Roller struct {
+	service  *Service
+	interval time.Duration
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRoller 创建新的指标汇总实例
+func NewRoller() *Roller {
+	interval := config.AppConfig.MetricsInterval
+	if interval <= 0 {
+		interval = 300
+	}
+
+	return &Roller{
+		service:  NewService(),
+		interval: time.Duration(interval) * time.Second,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动汇总循环
+func (r *Roller) Start() {
+	r.wg.Add(1)
+	go r.loop()
+}
+
+// Stop 停止汇总循环并等待退出
+func (r *Roller) Stop() {
+	close(r.stopChan)
+	r.wg.Wait()
+}
+
+func (r *Roller) loop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.run()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+func (r *Roller) run() {
+	now := time.Now()
+
+	created, err := r.service.Rollup(now)
+	if err != nil {
+		logrus.Error("Failed to roll up device metrics: ", err)
+	} else if created > 0 {
+		logrus.Debugf("Metrics rollup wrote %d samples", created)
+	}
+
+	deleted, err := r.service.Prune(now)
+	if err != nil {
+		logrus.Error("Failed to prune device metrics: ", err)
+		return
+	}
+	if deleted > 0 {
+		logrus.Infof("Metrics retention removed %d samples", deleted)
+	}
+}
@@ -0,0 +1,331 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPoints 单次查询最多返回的数据点数
+const maxPoints = 2000
+
+// defaultPoints 未指定步长时按时间范围自动选择步长的目标数据点数
+const defaultPoints = 300
+
+// resolution 指标存储粒度，interval为0表示原始样本
+type resolution struct {
+	name      string
+	interval  time.Duration
+	retention func() time.Duration
+}
+
+// resolutions 按粒度从细到粗排列
+var resolutions = []resolution{
+	{models.MetricResolutionRaw, 0, func() time.Duration {
+		return time.Duration(config.AppConfig.MetricsRawHours) * time.Hour
+	}},
+	{models.MetricResolution5m, 5 * time.Minute, func() time.Duration {
+		return time.Duration(config.AppConfig.Metrics5mDays) * 24 * time.Hour
+	}},
+	{models.MetricResolution1h, time.Hour, func() time.Duration {
+		return time.Duration(config.AppConfig.Metrics1hDays) * 24 * time.Hour
+	}},
+}
+
+// rollups 汇总顺序，每次汇总从上一级粒度读取数据，batch为单次查询覆盖的时间桶数
+var rollups = []struct {
+	source, target string
+	interval       time.Duration
+	batch          int
+}{
+	{models.MetricResolutionRaw, models.MetricResolution5m, 5 * time.Minute, 12},
+	{models.MetricResolution5m, models.MetricResolution1h, time.Hour, 24},
+}
+
+// Service 指标历史服务
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建新的指标历史服务实例
+func NewService() *Service {
+	return &Service{
+		db: config.DB,
+	}
+}
+
+// Series 指标历史查询结果
+type Series struct {
+	DeviceID   string                 `json:"device_id"`
+	From       time.Time              `json:"from"`
+	To         time.Time              `json:"to"`
+	Step       int                    `json:"step"`       // 数据点间隔（秒）
+	Resolution string                 `json:"resolution"` // 数据来源粒度
+	Points     []*models.MetricSample `json:"points"`
+}
+
+// Record 写入一条心跳原始样本
+func (s *Service) Record(deviceID string, at time.Time, sample *models.MetricSample) error {
+	sample.DeviceID = deviceID
+	sample.Resolution = models.MetricResolutionRaw
+	sample.Timestamp = at
+	sample.CPUMax = sample.CPUUsage
+	sample.Samples = 1
+
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(sample).Error
+}
+
+// Query 查询设备在[from, to)内的指标历史，step为0时按时间范围自动选择
+// 根据步长与各粒度的保留时间选择数据来源，步长大于来源粒度时再按步长合并
+func (s *Service) Query(deviceID string, from, to time.Time, step time.Duration) (*Series, error) {
+	if !to.After(from) {
+		return nil, ErrInvalidRange
+	}
+	if step < 0 {
+		return nil, ErrInvalidStep
+	}
+	if step == 0 {
+		step = to.Sub(from) / defaultPoints
+	}
+
+	res := pickResolution(from, step, time.Now())
+
+	// 原始样本的最小间隔为心跳周期，汇总样本的步长取粒度的整数倍
+	minStep := res.interval
+	if minStep == 0 {
+		minStep = time.Duration(config.AppConfig.HeartbeatInterval) * time.Second
+	}
+	if step <= minStep {
+		step = minStep
+	} else if res.interval > 0 && step%res.interval != 0 {
+		step = (step/res.interval + 1) * res.interval
+	}
+
+	if to.Sub(from)/step > maxPoints {
+		return nil, ErrTooManyPoints
+	}
+
+	samples := []*models.MetricSample{}
+	if err := s.db.Where("device_id = ? AND resolution = ? AND timestamp >= ? AND timestamp < ?",
+		deviceID, res.name, from, to).
+		Order("timestamp").
+		Find(&samples).Error; err != nil {
+		return nil, err
+	}
+
+	if step > minStep {
+		samples = downsample(deviceID, res.name, samples, step)
+	}
+
+	return &Series{
+		DeviceID:   deviceID,
+		From:       from,
+		To:         to,
+		Step:       int(step / time.Second),
+		Resolution: res.name,
+		Points:     samples,
+	}, nil
+}
+
+// pickResolution 选择间隔不超过步长、且保留时间覆盖查询起点的最粗粒度，以减少读取的样本数
+// 没有满足条件的粒度时退而选择保留时间覆盖起点的最细粒度，仍没有则使用最粗粒度
+func pickResolution(from time.Time, step time.Duration, now time.Time) resolution {
+	covers := func(r resolution) bool {
+		retention := r.retention()
+		return retention <= 0 || !from.Before(now.Add(-retention))
+	}
+
+	for i := len(resolutions) - 1; i >= 0; i-- {
+		if r := resolutions[i]; r.interval <= step && covers(r) {
+			return r
+		}
+	}
+	for _, r := range resolutions {
+		if covers(r) {
+			return r
+		}
+	}
+	return resolutions[len(resolutions)-1]
+}
+
+// Rollup 将已结束的时间桶逐级汇总为5分钟与1小时样本，返回写入的汇总样本数
+func (s *Service) Rollup(now time.Time) (int, error) {
+	total := 0
+	for _, r := range rollups {
+		n, err := s.rollup(r.source, r.target, r.interval, r.batch, now)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (s *Service) rollup(source, target string, interval time.Duration, batch int, now time.Time) (int, error) {
+	end := now.Truncate(interval)
+
+	start, err := s.rollupStart(source, target, interval)
+	if err != nil || start.IsZero() {
+		return 0, err
+	}
+
+	// 早于来源粒度保留时间的数据已被清理，无需回溯
+	for _, r := range resolutions {
+		if r.name != source {
+			continue
+		}
+		if retention := r.retention(); retention > 0 {
+			if cutoff := now.Add(-retention).Truncate(interval); start.Before(cutoff) {
+				start = cutoff
+			}
+		}
+	}
+
+	created := 0
+	for windowStart := start; windowStart.Before(end); {
+		windowEnd := windowStart.Add(interval * time.Duration(batch))
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+
+		var samples []*models.MetricSample
+		if err := s.db.Where("resolution = ? AND timestamp >= ? AND timestamp < ?", source, windowStart, windowEnd).
+			Order("device_id, timestamp").
+			Find(&samples).Error; err != nil {
+			return created, err
+		}
+
+		var buckets []*models.MetricSample
+		for i := 0; i < len(samples); {
+			j := i
+			for j < len(samples) && samples[j].DeviceID == samples[i].DeviceID {
+				j++
+			}
+			buckets = append(buckets, downsample(samples[i].DeviceID, target, samples[i:j], interval)...)
+			i = j
+		}
+
+		if len(buckets) > 0 {
+			if err := s.db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(buckets, 500).Error; err != nil {
+				return created, err
+			}
+			created += len(buckets)
+		}
+
+		windowStart = windowEnd
+	}
+
+	return created, nil
+}
+
+// rollupStart 返回下一个待汇总的时间桶，从未汇总过时从最早的来源样本开始，没有来源样本时返回零值
+func (s *Service) rollupStart(source, target string, interval time.Duration) (time.Time, error) {
+	var latest struct {
+		Timestamp *time.Time
+	}
+	if err := s.db.Model(&models.MetricSample{}).
+		Select("MAX(timestamp) AS timestamp").
+		Where("resolution = ?", target).
+		Scan(&latest).Error; err != nil {
+		return time.Time{}, err
+	}
+	if latest.Timestamp != nil {
+		return latest.Timestamp.Add(interval), nil
+	}
+
+	var earliest struct {
+		Timestamp *time.Time
+	}
+	if err := s.db.Model(&models.MetricSample{}).
+		Select("MIN(timestamp) AS timestamp").
+		Where("resolution = ?", source).
+		Scan(&earliest).Error; err != nil {
+		return time.Time{}, err
+	}
+	if earliest.Timestamp == nil {
+		return time.Time{}, nil
+	}
+	return earliest.Timestamp.Truncate(interval), nil
+}
+
+// Prune 删除超出各粒度保留时间的样本，保留时间为0表示不限制，返回删除的样本数
+func (s *Service) Prune(now time.Time) (int64, error) {
+	var deleted int64
+	for _, r := range resolutions {
+		retention := r.retention()
+		if retention <= 0 {
+			continue
+		}
+
+		result := s.db.Where("resolution = ? AND timestamp < ?", r.name, now.Add(-retention)).
+			Delete(&models.MetricSample{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+	return deleted, nil
+}
+
+// downsample 将同一设备按时间排序的样本按步长分桶合并，各项指标按包含的原始样本数加权平均，CPU峰值取最大值
+func downsample(deviceID, resolution string, samples []*models.MetricSample, step time.Duration) []*models.MetricSample {
+	buckets := make([]*models.MetricSample, 0, len(samples))
+	for i := 0; i < len(samples); {
+		bucket := samples[i].Timestamp.Truncate(step)
+		j := i
+		for j < len(samples) && samples[j].Timestamp.Truncate(step).Equal(bucket) {
+			j++
+		}
+		buckets = append(buckets, aggregate(deviceID, resolution, bucket, samples[i:j]))
+		i = j
+	}
+	return buckets
+}
+
+func aggregate(deviceID, resolution string, bucket time.Time, samples []*models.MetricSample) *models.MetricSample {
+	out := &models.MetricSample{
+		DeviceID:   deviceID,
+		Resolution: resolution,
+		Timestamp:  bucket,
+	}
+
+	var cpu, memory, memoryTotal, swap, disk, in, outRate, load float64
+	for _, sample := range samples {
+		weight := sample.Samples
+		if weight <= 0 {
+			weight = 1
+		}
+		w := float64(weight)
+
+		cpu += sample.CPUUsage * w
+		memory += float64(sample.MemoryUsed) * w
+		memoryTotal += float64(sample.MemoryTotal) * w
+		swap += float64(sample.SwapUsed) * w
+		disk += sample.DiskUsage * w
+		in += float64(sample.NetworkIn) * w
+		outRate += float64(sample.NetworkOut) * w
+		load += sample.Load1 * w
+
+		out.CPUMax = math.Max(out.CPUMax, sample.CPUMax)
+		out.Samples += weight
+	}
+
+	n := float64(out.Samples)
+	out.CPUUsage = round2(cpu / n)
+	out.MemoryUsed = int(math.Round(memory / n))
+	out.MemoryTotal = int(math.Round(memoryTotal / n))
+	out.SwapUsed = int(math.Round(swap / n))
+	out.DiskUsage = round2(disk / n)
+	out.NetworkIn = int(math.Round(in / n))
+	out.NetworkOut = int(math.Round(outRate / n))
+	out.Load1 = round2(load / n)
+	return out
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+)
+
+func TestPickResolution(t *testing.T) {
+	config.AppConfig = &config.Config{MetricsRawHours: 24, Metrics5mDays: 7, Metrics1hDays: 90}
+	now := time.Date(2025, 6, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		from time.Time
+		step time.Duration
+		want string
+	}{
+		{"recent fine step", now.Add(-time.Hour), time.Minute, models.MetricResolutionRaw},
+		{"recent five minute step", now.Add(-time.Hour), 5 * time.Minute, models.MetricResolution5m},
+		{"recent hourly step", now.Add(-time.Hour), 2 * time.Hour, models.MetricResolution1h},
+		{"beyond raw retention", now.Add(-48 * time.Hour), time.Minute, models.MetricResolution5m},
+		{"beyond 5m retention", now.Add(-30 * 24 * time.Hour), time.Minute, models.MetricResolution1h},
+		{"beyond all retention", now.Add(-365 * 24 * time.Hour), time.Minute, models.MetricResolution1h},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickResolution(tt.from, tt.step, now); got.name != tt.want {
+				t.Errorf("pickResolution() = %s, want %s", got.name, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickResolutionUnlimitedRetention(t *testing.T) {
+	config.AppConfig = &config.Config{MetricsRawHours: 0, Metrics5mDays: 7, Metrics1hDays: 90}
+	now := time.Date(2025, 6, 20, 12, 0, 0, 0, time.UTC)
+
+	if got := pickResolution(now.Add(-365*24*time.Hour), time.Minute, now); got.name != models.MetricResolutionRaw {
+		t.Errorf("pickResolution() = %s, want %s", got.name, models.MetricResolutionRaw)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	base := time.Date(2025, 6, 20, 12, 0, 0, 0, time.UTC)
+	samples := []*models.MetricSample{
+		{Timestamp: base.Add(30 * time.Second), CPUUsage: 10, CPUMax: 15, MemoryUsed: 100, MemoryTotal: 1000, DiskUsage: 50, Load1: 1, Samples: 1},
+		{Timestamp: base.Add(4 * time.Minute), CPUUsage: 40, CPUMax: 90, MemoryUsed: 400, MemoryTotal: 1000, DiskUsage: 50, Load1: 2, Samples: 3},
+		{Timestamp: base.Add(5 * time.Minute), CPUUsage: 20, CPUMax: 20, MemoryUsed: 200, MemoryTotal: 1000, DiskUsage: 60, NetworkIn: 10, Samples: 0},
+	}
+
+	got := downsample("dev_1", models.MetricResolution5m, samples, 5*time.Minute)
+	if len(got) != 2 {
+		t.Fatalf("downsample() returned %d buckets, want 2", len(got))
+	}
+
+	first := got[0]
+	if !first.Timestamp.Equal(base) || first.DeviceID != "dev_1" || first.Resolution != models.MetricResolution5m {
+		t.Errorf("first bucket = %+v", first)
+	}
+	if first.Samples != 4 {
+		t.Errorf("first bucket samples = %d, want 4", first.Samples)
+	}
+	// 按样本数加权：(10*1 + 40*3) / 4
+	if first.CPUUsage != 32.5 || first.CPUMax != 90 {
+		t.Errorf("first bucket cpu = %v, max = %v, want 32.5, 90", first.CPUUsage, first.CPUMax)
+	}
+	if first.MemoryUsed != 325 || first.MemoryTotal != 1000 || first.Load1 != 1.75 {
+		t.Errorf("first bucket memory = %d/%d, load = %v", first.MemoryUsed, first.MemoryTotal, first.Load1)
+	}
+
+	// 样本数为0的旧数据按1计
+	second := got[1]
+	if !second.Timestamp.Equal(base.Add(5*time.Minute)) || second.Samples != 1 || second.CPUUsage != 20 || second.NetworkIn != 10 {
+		t.Errorf("second bucket = %+v", second)
+	}
+
+	if got := downsample("dev_1", models.MetricResolution5m, nil, 5*time.Minute); len(got) != 0 {
+		t.Errorf("downsample(nil) = %v, want empty", got)
+	}
+}
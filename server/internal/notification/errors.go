@@ -0,0 +1,12 @@
+// notification 包提供了邮件与群聊机器人通知渠道的管理与发送服务
+package notification
+
+import "errors"
+
+// 通知相关的错误定义
+var (
+	ErrChannelNotFound   = errors.New("notification channel not found") // 通知渠道不存在
+	ErrInvalidChannel    = errors.New("invalid notification channel")   // 通知渠道参数无效
+	ErrSMTPNotConfigured = errors.New("smtp is not configured")         // 未配置SMTP服务器
+	ErrNoRecipients      = errors.New("no email recipients")            // 没有可用的收件人
+)
@@ -0,0 +1,140 @@
+package notification
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/XRSec/Cslite/models"
+)
+
+// maxTemplateSize 自定义模板的长度上限
+const maxTemplateSize = 4000
+
+// maxFailedDevices 消息中列出的失败设备数上限
+const maxFailedDevices = 20
+
+// defaultTemplate 默认消息模板，第一行同时作为邮件主题
+const defaultTemplate = `{{.Title}}
+命令：{{.CommandName}}（{{.CommandID}}）
+执行：{{.ExecutionID}}
+结果：共 {{.Total}} 台设备，成功 {{.Succeeded}} 台，失败 {{.Failed}} 台
+{{- range .FailedDevices}}
+- {{.Name}}（{{.DeviceID}}）：{{.Status}}，退出码 {{.ExitCode}}
+{{- end}}
+{{- if .CompletedAt}}
+完成时间：{{.CompletedAt.Format "2006-01-02 15:04:05"}}
+{{- end}}`
+
+// Message 模板可用的数据
+type Message struct {
+	Event         string         // 事件：execution.completed、execution.failed、test
+	Title         string         // 标题
+	CommandID     string         // 命令ID
+	CommandName   string         // 命令名称
+	ExecutionID   string         // 执行ID
+	Status        string         // 执行状态
+	Total         int            // 目标设备数
+	Succeeded     int            // 成功设备数
+	Failed        int            // 失败设备数
+	FailedDevices []FailedDevice // 失败的设备（最多20台）
+	StartedAt     time.Time      // 开始时间
+	CompletedAt   *time.Time     // 完成时间
+}
+
+// FailedDevice 执行失败的设备
+type FailedDevice struct {
+	DeviceID string
+	Name     string
+	Status   string
+	ExitCode int
+}
+
+// parseTemplate 解析消息模板，为空时使用默认模板
+func parseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultTemplate
+	}
+	return template.New("message").Option("missingkey=zero").Parse(text)
+}
+
+// render 按渠道模板生成消息，返回主题与正文；自定义模板执行失败时退回默认模板
+func render(channel *models.NotificationChannel, msg *Message) (string, string) {
+	var buf bytes.Buffer
+	tmpl, err := parseTemplate(channel.Template)
+	if err == nil {
+		err = tmpl.Execute(&buf, msg)
+	}
+	if err != nil {
+		buf.Reset()
+		tmpl, _ = parseTemplate("")
+		tmpl.Execute(&buf, msg)
+	}
+
+	body := strings.TrimSpace(buf.String())
+	subject := msg.Title
+	if line := strings.TrimSpace(strings.SplitN(body, "\n", 2)[0]); line != "" {
+		subject = line
+	}
+	return subject, body
+}
+
+// executionMessage 根据执行记录与每台设备最后一次执行的结果生成消息
+func executionMessage(execution *models.Execution, results []models.ExecutionResult, names map[string]string) *Message {
+	msg := &Message{
+		Event:       models.WebhookEventExecutionCompleted,
+		Title:       "[Cslite] 命令「" + execution.Command.Name + "」执行成功",
+		CommandID:   execution.CommandID,
+		CommandName: execution.Command.Name,
+		ExecutionID: execution.ID,
+		Status:      execution.Status,
+		Total:       len(results),
+		StartedAt:   execution.StartedAt,
+		CompletedAt: execution.CompletedAt,
+	}
+	if execution.Status == models.ExecutionStatusFailed {
+		msg.Event = models.WebhookEventExecutionFailed
+		msg.Title = "[Cslite] 命令「" + execution.Command.Name + "」执行失败"
+	}
+
+	for _, r := range results {
+		switch r.Status {
+		case models.ResultStatusCompleted:
+			msg.Succeeded++
+		case models.ResultStatusCancelled:
+		default:
+			msg.Failed++
+			if len(msg.FailedDevices) < maxFailedDevices {
+				msg.FailedDevices = append(msg.FailedDevices, FailedDevice{
+					DeviceID: r.DeviceID,
+					Name:     names[r.DeviceID],
+					Status:   r.Status,
+					ExitCode: r.ExitCode,
+				})
+			}
+		}
+	}
+	return msg
+}
+
+// testMessage 测试通知使用的示例消息，便于预览模板效果
+func testMessage() *Message {
+	now := time.Now()
+	return &Message{
+		Event:       "test",
+		Title:       "[Cslite] 通知渠道测试",
+		CommandID:   "cmd_example",
+		CommandName: "示例命令",
+		ExecutionID: "exec_example",
+		Status:      models.ExecutionStatusFailed,
+		Total:       3,
+		Succeeded:   2,
+		Failed:      1,
+		FailedDevices: []FailedDevice{
+			{DeviceID: "dev_example", Name: "示例设备", Status: models.ResultStatusTimeout, ExitCode: -1},
+		},
+		StartedAt:   now.Add(-time.Minute),
+		CompletedAt: &now,
+	}
+}
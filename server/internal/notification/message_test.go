@@ -0,0 +1,51 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XRSec/Cslite/models"
+)
+
+func TestExecutionMessage(t *testing.T) {
+	execution := &models.Execution{
+		ID:        "exec_1",
+		CommandID: "cmd_1",
+		Status:    models.ExecutionStatusFailed,
+		Command:   models.Command{Name: "deploy"},
+	}
+	results := []models.ExecutionResult{
+		{DeviceID: "dev_1", Status: models.ResultStatusCompleted},
+		{DeviceID: "dev_2", Status: models.ResultStatusFailed, ExitCode: 2},
+		{DeviceID: "dev_3", Status: models.ResultStatusCancelled},
+		{DeviceID: "dev_4", Status: models.ResultStatusLost},
+	}
+
+	msg := executionMessage(execution, results, map[string]string{"dev_2": "web-02"})
+	if msg.Event != models.WebhookEventExecutionFailed || msg.Total != 4 || msg.Succeeded != 1 || msg.Failed != 2 {
+		t.Errorf("message = %+v", msg)
+	}
+	if len(msg.FailedDevices) != 2 || msg.FailedDevices[0].Name != "web-02" || msg.FailedDevices[0].ExitCode != 2 {
+		t.Errorf("failed devices = %+v", msg.FailedDevices)
+	}
+}
+
+func TestRender(t *testing.T) {
+	msg := testMessage()
+
+	subject, body := render(&models.NotificationChannel{}, msg)
+	if subject != msg.Title || !strings.Contains(body, msg.CommandName) {
+		t.Errorf("default template subject = %q, body = %q", subject, body)
+	}
+
+	subject, body = render(&models.NotificationChannel{Template: "{{.CommandName}} {{.Status}}\n{{.ExecutionID}}"}, msg)
+	if subject != msg.CommandName+" "+msg.Status || body != subject+"\n"+msg.ExecutionID {
+		t.Errorf("custom template subject = %q, body = %q", subject, body)
+	}
+
+	// 自定义模板执行失败时退回默认模板
+	subject, _ = render(&models.NotificationChannel{Template: "{{.Missing.Field}}"}, msg)
+	if subject != msg.Title {
+		t.Errorf("fallback subject = %q, want %q", subject, msg.Title)
+	}
+}
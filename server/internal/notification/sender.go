@@ -0,0 +1,244 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+	"github.com/XRSec/Cslite/utils"
+)
+
+// send 通过渠道发送一条消息，to为邮件渠道未配置收件人时的默认收件人
+func (s *Service) send(channel *models.NotificationChannel, msg *Message, to string) error {
+	subject, body := render(channel, msg)
+
+	if channel.Type == models.ChannelTypeEmail {
+		recipients := channel.Target
+		if recipients == "" {
+			recipients = to
+		}
+		return sendEmail(recipients, subject, body)
+	}
+	return sendChat(channel, body)
+}
+
+// sendEmail 通过配置的SMTP服务器发送纯文本邮件，recipients为逗号分隔的收件人列表
+func sendEmail(recipients, subject, body string) error {
+	cfg := config.AppConfig
+	if cfg.SMTPHost == "" || cfg.SMTPFrom == "" {
+		return ErrSMTPNotConfigured
+	}
+	if strings.TrimSpace(recipients) == "" {
+		return ErrNoRecipients
+	}
+
+	from, err := mail.ParseAddress(cfg.SMTPFrom)
+	if err != nil {
+		return err
+	}
+	list, err := mail.ParseAddressList(recipients)
+	if err != nil {
+		return err
+	}
+
+	to := make([]string, len(list))
+	headerTo := make([]string, len(list))
+	for i, addr := range list {
+		to[i] = addr.Address
+		headerTo[i] = addr.String()
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(headerTo, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+
+	return smtpSend(from.Address, to, msg.Bytes())
+}
+
+// smtpSend 连接SMTP服务器投递邮件：隐式TLS或在服务器支持时升级STARTTLS，配置了用户名时进行认证
+func smtpSend(from string, to []string, msg []byte) error {
+	cfg := config.AppConfig
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))
+	timeout := notifyTimeout()
+	tlsConfig := &tls.Config{ServerName: cfg.SMTPHost}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if cfg.SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !cfg.SMTPTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.SMTPUsername != "" {
+		// PlainAuth只允许在TLS连接或本机服务器上发送密码
+		if err := client.Auth(smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// sendChat 以文本消息发送到群聊机器人，飞书与钉钉配置了密钥时附带签名
+func sendChat(channel *models.NotificationChannel, text string) error {
+	target := channel.Target
+	var payload map[string]interface{}
+
+	switch channel.Type {
+	case models.ChannelTypeSlack:
+		payload = map[string]interface{}{"text": text}
+	case models.ChannelTypeFeishu:
+		payload = map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": text},
+		}
+		if channel.Secret != "" {
+			timestamp := time.Now().Unix()
+			payload["timestamp"] = strconv.FormatInt(timestamp, 10)
+			payload["sign"] = feishuSign(channel.Secret, timestamp)
+		}
+	case models.ChannelTypeDingTalk:
+		payload = map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		}
+		if channel.Secret != "" {
+			timestamp := time.Now().UnixMilli()
+			u, err := url.Parse(target)
+			if err != nil {
+				return err
+			}
+			query := u.Query()
+			query.Set("timestamp", strconv.FormatInt(timestamp, 10))
+			query.Set("sign", dingTalkSign(channel.Secret, timestamp))
+			u.RawQuery = query.Encode()
+			target = u.String()
+		}
+	case models.ChannelTypeWeCom:
+		payload = map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		}
+	default:
+		return ErrInvalidChannel
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := utils.NewOutboundClient(notifyTimeout(), config.AppConfig.AllowPrivateTargets)
+	resp, err := client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	// 飞书、钉钉、企业微信在HTTP 200中以code/errcode返回业务错误
+	var result struct {
+		Code    *int   `json:"code"`
+		ErrCode *int   `json:"errcode"`
+		Msg     string `json:"msg"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if json.Unmarshal(respBody, &result) == nil {
+		if result.Code != nil && *result.Code != 0 {
+			return fmt.Errorf("error code %d: %s", *result.Code, result.Msg)
+		}
+		if result.ErrCode != nil && *result.ErrCode != 0 {
+			return fmt.Errorf("error code %d: %s", *result.ErrCode, result.ErrMsg)
+		}
+	}
+	return nil
+}
+
+// feishuSign 飞书签名：以"时间戳\n密钥"为key对空消息做HMAC-SHA256后Base64编码
+func feishuSign(secret string, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(strconv.FormatInt(timestamp, 10)+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// dingTalkSign 钉钉签名：以密钥对"毫秒时间戳\n密钥"做HMAC-SHA256后Base64编码
+func dingTalkSign(secret string, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func notifyTimeout() time.Duration {
+	timeout := config.AppConfig.NotifyTimeout
+	if timeout <= 0 {
+		timeout = 10
+	}
+	return time.Duration(timeout) * time.Second
+}
@@ -0,0 +1,200 @@
+package notification
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+	"github.com/XRSec/Cslite/utils"
+)
+
+// smtpSession 测试SMTP服务器收到的一封邮件
+type smtpSession struct {
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPServer 在本机启动只接收一封邮件的最小SMTP服务器（不支持STARTTLS与认证）
+func startSMTPServer(t *testing.T) (int, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		var session smtpSession
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				session.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				session.to = append(session.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				session.data = data.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				sessions <- session
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, sessions
+}
+
+func TestSendEmail(t *testing.T) {
+	port, sessions := startSMTPServer(t)
+	config.AppConfig = &config.Config{
+		SMTPHost:      "127.0.0.1",
+		SMTPPort:      port,
+		SMTPFrom:      "Cslite <cslite@example.com>",
+		NotifyTimeout: 5,
+	}
+
+	body := "命令执行失败\n- web-01（dev_1）：failed，退出码 1"
+	if err := sendEmail("ops@example.com, Alice <alice@example.com>", "[Cslite] 执行失败", body); err != nil {
+		t.Fatalf("sendEmail error: %v", err)
+	}
+
+	session := <-sessions
+	if session.from != "cslite@example.com" {
+		t.Errorf("MAIL FROM = %q", session.from)
+	}
+	if strings.Join(session.to, ",") != "ops@example.com,alice@example.com" {
+		t.Errorf("RCPT TO = %v", session.to)
+	}
+
+	header, encoded, ok := strings.Cut(session.data, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message has no header separator: %q", session.data)
+	}
+	for _, want := range []string{
+		"From: \"Cslite\" <cslite@example.com>",
+		"To: <ops@example.com>, \"Alice\" <alice@example.com>",
+		"Subject: =?utf-8?q?",
+		"Content-Transfer-Encoding: base64",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("header missing %q:\n%s", want, header)
+		}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(encoded, "\r\n", ""))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if string(decoded) != body {
+		t.Errorf("body = %q, want %q", decoded, body)
+	}
+}
+
+func TestSendEmailNotConfigured(t *testing.T) {
+	config.AppConfig = &config.Config{}
+	if err := sendEmail("ops@example.com", "subject", "body"); err != ErrSMTPNotConfigured {
+		t.Errorf("sendEmail error = %v, want ErrSMTPNotConfigured", err)
+	}
+
+	config.AppConfig = &config.Config{SMTPHost: "127.0.0.1", SMTPFrom: "cslite@example.com"}
+	if err := sendEmail(" ", "subject", "body"); err != ErrNoRecipients {
+		t.Errorf("sendEmail error = %v, want ErrNoRecipients", err)
+	}
+}
+
+func TestSendChat(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+		io.WriteString(w, `{"code":0,"msg":"success"}`)
+	}))
+	defer server.Close()
+
+	channel := &models.NotificationChannel{Type: models.ChannelTypeFeishu, Target: server.URL, Secret: "secret"}
+
+	// 默认不允许访问内网地址
+	config.AppConfig = &config.Config{NotifyTimeout: 5}
+	if err := sendChat(channel, "hello"); !errors.Is(err, utils.ErrForbiddenAddress) {
+		t.Fatalf("sendChat to loopback error = %v, want ErrForbiddenAddress", err)
+	}
+
+	config.AppConfig = &config.Config{NotifyTimeout: 5, AllowPrivateTargets: true}
+	if err := sendChat(channel, "hello"); err != nil {
+		t.Fatalf("sendChat error: %v", err)
+	}
+	if payload["msg_type"] != "text" || payload["sign"] == nil || payload["timestamp"] == nil {
+		t.Errorf("feishu payload = %v", payload)
+	}
+	if content, _ := payload["content"].(map[string]interface{}); content["text"] != "hello" {
+		t.Errorf("feishu content = %v", payload["content"])
+	}
+}
+
+func TestSendChatBusinessError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"errcode":310000,"errmsg":"sign not match"}`)
+	}))
+	defer server.Close()
+
+	config.AppConfig = &config.Config{NotifyTimeout: 5, AllowPrivateTargets: true}
+	channel := &models.NotificationChannel{Type: models.ChannelTypeDingTalk, Target: server.URL}
+	if err := sendChat(channel, "hello"); err == nil || !strings.Contains(err.Error(), "310000") {
+		t.Errorf("sendChat error = %v, want errcode 310000", err)
+	}
+}
+
+func TestChatSign(t *testing.T) {
+	if got := feishuSign("secret", 1718850000); got != "olQ/HmZdkSCU4O5YHqL1at900N2GTH41tM/kARa7BBA=" {
+		t.Errorf("feishuSign() = %s", got)
+	}
+	if got := dingTalkSign("secret", 1718850000000); got != "5U/t5XuFyd68KMNp7R6L0tWDOGFu+EHQSvtFnMvtD8o=" {
+		t.Errorf("dingTalkSign() = %s", got)
+	}
+}
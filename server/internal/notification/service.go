@@ -0,0 +1,287 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/mail"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+	"github.com/XRSec/Cslite/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// validTypes 支持的渠道类型
+var validTypes = map[string]bool{
+	models.ChannelTypeEmail:    true,
+	models.ChannelTypeSlack:    true,
+	models.ChannelTypeFeishu:   true,
+	models.ChannelTypeDingTalk: true,
+	models.ChannelTypeWeCom:    true,
+}
+
+// Service 通知服务
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建新的通知服务实例
+func NewService() *Service {
+	return &Service{
+		db: config.DB,
+	}
+}
+
+// ChannelInput 创建或更新通知渠道的参数，更新时未提供的字段保持不变
+type ChannelInput struct {
+	Name     *string
+	Type     *string
+	Target   *string
+	Secret   *string
+	Template *string
+	Enabled  *bool
+}
+
+// ListChannels 列出通知渠道，非管理员只能看到自己创建的渠道
+func (s *Service) ListChannels(userID uint, isAdmin bool) ([]*models.NotificationChannel, error) {
+	query := s.db.Order("id ASC")
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	var channels []*models.NotificationChannel
+	if err := query.Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// CreateChannel 创建通知渠道
+func (s *Service) CreateChannel(userID uint, input ChannelInput) (*models.NotificationChannel, error) {
+	channel := &models.NotificationChannel{
+		Enabled:   true,
+		CreatedBy: userID,
+	}
+	input.apply(channel)
+	if err := validateChannel(channel); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(channel).Error; err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+// UpdateChannel 更新通知渠道
+func (s *Service) UpdateChannel(channelID uint, userID uint, isAdmin bool, input ChannelInput) (*models.NotificationChannel, error) {
+	channel, err := s.GetChannel(channelID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	input.apply(channel)
+	if err := validateChannel(channel); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(channel).Error; err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+// DeleteChannel 删除通知渠道，引用该渠道的命令不再向其发送通知
+func (s *Service) DeleteChannel(channelID uint, userID uint, isAdmin bool) error {
+	channel, err := s.GetChannel(channelID, userID, isAdmin)
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(channel).Error
+}
+
+// GetChannel 获取通知渠道，非管理员只能获取自己创建的渠道
+func (s *Service) GetChannel(channelID uint, userID uint, isAdmin bool) (*models.NotificationChannel, error) {
+	query := s.db
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	var channel models.NotificationChannel
+	if err := query.First(&channel, channelID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChannelNotFound
+		}
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// Test 用示例数据立即通过渠道发送一条测试通知，停用的渠道也可测试
+func (s *Service) Test(channelID uint, userID uint, isAdmin bool) error {
+	channel, err := s.GetChannel(channelID, userID, isAdmin)
+	if err != nil {
+		return err
+	}
+
+	var creator models.User
+	if err := s.db.Select("id", "email").First(&creator, channel.CreatedBy).Error; err != nil {
+		return err
+	}
+	return s.send(channel, testMessage(), creator.Email)
+}
+
+// CheckChannels 确认渠道均存在且为用户本人创建，供命令设置通知时校验
+func (s *Service) CheckChannels(userID uint, channelIDs []uint) error {
+	if len(channelIDs) == 0 {
+		return nil
+	}
+
+	unique := make(map[uint]bool, len(channelIDs))
+	for _, id := range channelIDs {
+		unique[id] = true
+	}
+
+	var count int64
+	if err := s.db.Model(&models.NotificationChannel{}).
+		Where("id IN ? AND created_by = ?", channelIDs, userID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(unique) {
+		return ErrChannelNotFound
+	}
+	return nil
+}
+
+// ExecutionFinished 按命令的通知设置发送执行结束通知，results为每台设备最后一次执行的结果
+// 命令未指定渠道时发送邮件到创建者的邮箱；通知在后台发送，失败只记录日志
+func (s *Service) ExecutionFinished(execution *models.Execution, results []models.ExecutionResult) {
+	command := &execution.Command
+	switch command.NotifyOn {
+	case models.NotifyOnAlways:
+		if execution.Status != models.ExecutionStatusCompleted && execution.Status != models.ExecutionStatusFailed {
+			return
+		}
+	case models.NotifyOnFailure:
+		if execution.Status != models.ExecutionStatusFailed {
+			return
+		}
+	case models.NotifyOnSuccess:
+		if execution.Status != models.ExecutionStatusCompleted {
+			return
+		}
+	default:
+		return
+	}
+
+	var creator models.User
+	if err := s.db.Select("id", "email").First(&creator, command.CreatedBy).Error; err != nil {
+		logrus.Errorf("Failed to load creator of command %s for notification: %v", command.ID, err)
+		return
+	}
+
+	var channelIDs []uint
+	if len(command.NotifyChannels) > 0 {
+		json.Unmarshal(command.NotifyChannels, &channelIDs)
+	}
+	var channels []*models.NotificationChannel
+	if len(channelIDs) == 0 {
+		if config.AppConfig.SMTPHost == "" || creator.Email == "" {
+			return
+		}
+		channels = []*models.NotificationChannel{{Name: "default", Type: models.ChannelTypeEmail}}
+	} else if err := s.db.Where("id IN ? AND created_by = ? AND enabled = ?", channelIDs, command.CreatedBy, true).
+		Find(&channels).Error; err != nil {
+		logrus.Errorf("Failed to load notification channels of command %s: %v", command.ID, err)
+		return
+	}
+	if len(channels) == 0 {
+		return
+	}
+
+	msg := executionMessage(execution, results, s.deviceNames(results))
+	go func() {
+		for _, channel := range channels {
+			if err := s.send(channel, msg, creator.Email); err != nil {
+				logrus.Warnf("Failed to send %s notification via channel %q for execution %s: %v",
+					channel.Type, channel.Name, execution.ID, err)
+			}
+		}
+	}()
+}
+
+// deviceNames 查询失败设备的名称，已删除的设备同样返回
+func (s *Service) deviceNames(results []models.ExecutionResult) map[string]string {
+	var ids []string
+	for _, r := range results {
+		if r.Status != models.ResultStatusCompleted && r.Status != models.ResultStatusCancelled {
+			ids = append(ids, r.DeviceID)
+		}
+	}
+
+	names := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return names
+	}
+
+	var devices []models.Device
+	if err := s.db.Unscoped().Select("id", "name").Where("id IN ?", ids).Find(&devices).Error; err != nil {
+		logrus.Errorf("Failed to load device names for notification: %v", err)
+	}
+	for _, d := range devices {
+		names[d.ID] = d.Name
+	}
+	return names
+}
+
+func (input *ChannelInput) apply(channel *models.NotificationChannel) {
+	if input.Name != nil {
+		channel.Name = *input.Name
+	}
+	if input.Type != nil {
+		channel.Type = *input.Type
+	}
+	if input.Target != nil {
+		channel.Target = *input.Target
+	}
+	if input.Secret != nil {
+		channel.Secret = *input.Secret
+	}
+	if input.Template != nil {
+		channel.Template = *input.Template
+	}
+	if input.Enabled != nil {
+		channel.Enabled = *input.Enabled
+	}
+}
+
+// validateChannel 校验渠道参数：邮件的收件人须为合法地址列表，群聊须为http(s)地址，模板须能解析
+func validateChannel(channel *models.NotificationChannel) error {
+	if channel.Name == "" || len(channel.Name) > 100 || !validTypes[channel.Type] ||
+		len(channel.Target) > 500 || len(channel.Secret) > 100 || len(channel.Template) > maxTemplateSize {
+		return ErrInvalidChannel
+	}
+
+	if channel.Type == models.ChannelTypeEmail {
+		if channel.Target != "" {
+			if _, err := mail.ParseAddressList(channel.Target); err != nil {
+				return ErrInvalidChannel
+			}
+		}
+	} else {
+		// 群聊地址不能指向内网，发送时连接前还会再次校验
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout())
+		defer cancel()
+		if err := utils.CheckOutboundURL(ctx, channel.Target, config.AppConfig.AllowPrivateTargets); err != nil {
+			return ErrInvalidChannel
+		}
+	}
+
+	if _, err := parseTemplate(channel.Template); err != nil {
+		return ErrInvalidChannel
+	}
+	return nil
+}
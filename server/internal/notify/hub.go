@@ -0,0 +1,58 @@
+// notify 包提供进程内的设备唤醒通知，用于长轮询在有新任务时立即返回
+package notify
+
+import "sync"
+
+// Hub 按设备ID分发唤醒通知
+// 通知只在当前进程内有效，多实例部署时其他实例上的等待会在超时后返回
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+// Default 全局通知中心
+var Default = NewHub()
+
+// NewHub 创建新的通知中心实例
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe 订阅设备的唤醒通知，返回通知通道和取消订阅函数
+func (h *Hub) Subscribe(deviceID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	if h.subscribers[deviceID] == nil {
+		h.subscribers[deviceID] = make(map[chan struct{}]struct{})
+	}
+	h.subscribers[deviceID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subscribers[deviceID], ch)
+		if len(h.subscribers[deviceID]) == 0 {
+			delete(h.subscribers, deviceID)
+		}
+	}
+}
+
+// Notify 唤醒正在等待的设备，没有订阅者时直接忽略
+func (h *Hub) Notify(deviceIDs ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, deviceID := range deviceIDs {
+		for ch := range h.subscribers[deviceID] {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
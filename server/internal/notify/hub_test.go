@@ -0,0 +1,40 @@
+package notify
+
+import "testing"
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	wake1, cancel1 := hub.Subscribe("dev_1")
+	wake2, cancel2 := hub.Subscribe("dev_1")
+	other, cancelOther := hub.Subscribe("dev_2")
+	defer cancelOther()
+
+	// 多次通知合并为一次，不会阻塞
+	hub.Notify("dev_1", "dev_3")
+	hub.Notify("dev_1")
+
+	for i, wake := range []<-chan struct{}{wake1, wake2} {
+		select {
+		case <-wake:
+		default:
+			t.Errorf("subscriber %d not woken", i+1)
+		}
+		select {
+		case <-wake:
+			t.Errorf("subscriber %d woken twice", i+1)
+		default:
+		}
+	}
+	select {
+	case <-other:
+		t.Error("dev_2 woken by dev_1 notification")
+	default:
+	}
+
+	cancel1()
+	cancel2()
+	hub.Notify("dev_1")
+	if _, ok := hub.subscribers["dev_1"]; ok {
+		t.Error("subscribers not removed after cancel")
+	}
+}
@@ -0,0 +1,12 @@
+// retention 包提供了执行日志保留策略与后台清理服务
+package retention
+
+import "errors"
+
+// 日志保留相关的错误定义
+var (
+	ErrRuleNotFound  = errors.New("retention rule not found")                // 保留规则不存在
+	ErrRuleExists    = errors.New("retention rule already exists for group") // 分组已存在保留规则
+	ErrGroupNotFound = errors.New("group not found")                         // 分组不存在
+	ErrInvalidRule   = errors.New("invalid retention rule")                  // 保留规则参数无效
+)
@@ -0,0 +1,72 @@
+package retention
+
+import (
+	"sync"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Janitor 定期按保留策略清理过期的执行日志与记录
+type Janitor struct {
+	service  *Service
+	interval time.Duration
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewJanitor 创建新的日志清理实例
+func NewJanitor() *Janitor {
+	interval := config.AppConfig.RetentionInterval
+	if interval <= 0 {
+		interval = 3600
+	}
+
+	return &Janitor{
+		service:  NewService(),
+		interval: time.Duration(interval) * time.Second,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动清理循环
+func (j *Janitor) Start() {
+	j.wg.Add(1)
+	go j.loop()
+}
+
+// Stop 停止清理循环并等待退出
+func (j *Janitor) Stop() {
+	close(j.stopChan)
+	j.wg.Wait()
+}
+
+func (j *Janitor) loop() {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.sweep()
+		case <-j.stopChan:
+			return
+		}
+	}
+}
+
+func (j *Janitor) sweep() {
+	report, err := j.service.Apply()
+	if err != nil {
+		logrus.Error("Failed to apply log retention: ", err)
+		return
+	}
+
+	if report.DeletedResults > 0 {
+		logrus.Infof("Log retention removed %d results, %d executions, freed %d bytes",
+			report.DeletedResults, report.DeletedExecutions, report.FreedBytes)
+	}
+}
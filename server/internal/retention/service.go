@@ -0,0 +1,564 @@
+package retention
+
+import (
+	"errors"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/log"
+	"github.com/XRSec/Cslite/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 清理原因
+const (
+	ReasonKeepLast     = "keep_last"      // 超出每个命令保留的执行次数
+	ReasonMaxAge       = "max_age"        // 超出最长保留时间
+	ReasonMaxTotalSize = "max_total_size" // 日志总大小超出上限
+	ReasonOrphan       = "orphan"         // 没有设备结果引用的日志
+)
+
+// batchSize 每批处理的执行记录数
+const batchSize = 200
+
+// orphanGracePeriod 没有设备结果引用的日志至少保留的时间，避免清理刚上传、尚未随结果关联的日志
+const orphanGracePeriod = 24 * time.Hour
+
+// Policy 生效的保留策略，各字段为0时表示不限制
+type Policy struct {
+	MaxAgeDays     int   `json:"max_age_days"`
+	MaxTotalSizeMB int64 `json:"max_total_size_mb"`
+	KeepLast       int   `json:"keep_last"`
+}
+
+// RuleInput 创建或更新保留规则的参数，限制字段为空时沿用全局配置
+type RuleInput struct {
+	MaxAgeDays     *int
+	MaxTotalSizeMB *int64
+	KeepLast       *int
+	Enabled        *bool
+}
+
+// Item 一条将被清理的设备执行结果；ResultID为空时为没有设备结果的执行记录，ExecutionID也为空时为孤立日志
+type Item struct {
+	ResultID    string    `json:"result_id,omitempty"`
+	ExecutionID string    `json:"execution_id,omitempty"`
+	CommandID   string    `json:"command_id,omitempty"`
+	DeviceID    string    `json:"device_id,omitempty"`
+	GroupID     string    `json:"group_id,omitempty"`
+	LogID       string    `json:"log_id,omitempty"`
+	Size        int64     `json:"size"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Report 清理报告，试运行时仅列出将被清理的内容
+type Report struct {
+	DryRun            bool      `json:"dry_run"`
+	GeneratedAt       time.Time `json:"generated_at"`
+	Policy            Policy    `json:"policy"`
+	ScannedResults    int       `json:"scanned_results"`
+	DeletedResults    int       `json:"deleted_results"`
+	DeletedExecutions int       `json:"deleted_executions"`
+	DeletedOrphans    int       `json:"deleted_orphans"`
+	FreedBytes        int64     `json:"freed_bytes"`
+	Items             []*Item   `json:"items"`
+}
+
+// candidate 参与保留策略计算的已结束设备执行结果
+type candidate struct {
+	ResultID    string
+	ExecutionID string
+	CommandID   string
+	DeviceID    string
+	GroupID     string
+	LogPath     string
+	CreatedAt   time.Time
+}
+
+// Service 日志保留服务结构体
+type Service struct {
+	db   *gorm.DB     // 数据库连接
+	logs *log.Service // 日志存储服务
+}
+
+// NewService 创建新的日志保留服务实例
+func NewService() *Service {
+	return &Service{
+		db:   config.DB,
+		logs: log.NewService(),
+	}
+}
+
+// GlobalPolicy 返回配置中的全局保留策略
+func (s *Service) GlobalPolicy() Policy {
+	return Policy{
+		MaxAgeDays:     config.AppConfig.RetentionMaxAgeDays,
+		MaxTotalSizeMB: config.AppConfig.RetentionMaxSizeMB,
+		KeepLast:       config.AppConfig.RetentionKeepLast,
+	}
+}
+
+// ListRules 列出所有分组保留规则
+func (s *Service) ListRules() ([]*models.RetentionRule, error) {
+	var rules []*models.RetentionRule
+	if err := s.db.Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CreateRule 为分组创建保留规则，每个分组只能有一条规则
+func (s *Service) CreateRule(userID uint, groupID string, input RuleInput) (*models.RetentionRule, error) {
+	if err := validateInput(input); err != nil {
+		return nil, err
+	}
+
+	var group models.Group
+	if err := s.db.First(&group, "id = ?", groupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+
+	var count int64
+	if err := s.db.Model(&models.RetentionRule{}).Where("group_id = ?", groupID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrRuleExists
+	}
+
+	rule := &models.RetentionRule{
+		GroupID:        groupID,
+		MaxAgeDays:     input.MaxAgeDays,
+		MaxTotalSizeMB: input.MaxTotalSizeMB,
+		KeepLast:       input.KeepLast,
+		Enabled:        input.Enabled == nil || *input.Enabled,
+		CreatedBy:      userID,
+	}
+
+	if err := s.db.Create(rule).Error; err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// UpdateRule 更新保留规则，未提供的限制字段恢复为沿用全局配置
+func (s *Service) UpdateRule(ruleID uint, input RuleInput) (*models.RetentionRule, error) {
+	if err := validateInput(input); err != nil {
+		return nil, err
+	}
+
+	var rule models.RetentionRule
+	if err := s.db.First(&rule, ruleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRuleNotFound
+		}
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"max_age_days":      input.MaxAgeDays,
+		"max_total_size_mb": input.MaxTotalSizeMB,
+		"keep_last":         input.KeepLast,
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+
+	if err := s.db.Model(&rule).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.First(&rule, ruleID).Error; err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// DeleteRule 删除保留规则
+func (s *Service) DeleteRule(ruleID uint) error {
+	result := s.db.Delete(&models.RetentionRule{}, ruleID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// Plan 计算当前保留策略下需要清理的内容，不做任何修改
+func (s *Service) Plan() (*Report, error) {
+	return s.run(true)
+}
+
+// Apply 按保留策略删除过期的日志文件与执行记录
+func (s *Service) Apply() (*Report, error) {
+	return s.run(false)
+}
+
+func (s *Service) run(dryRun bool) (*Report, error) {
+	now := time.Now()
+	global := s.GlobalPolicy()
+
+	report := &Report{
+		DryRun:      dryRun,
+		GeneratedAt: now,
+		Policy:      global,
+		Items:       []*Item{},
+	}
+
+	policies, sizeScoped, err := s.groupPolicies(global)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &planner{
+		service:    s,
+		report:     report,
+		now:        now,
+		global:     global,
+		policies:   policies,
+		sizeScoped: sizeScoped,
+		ranks:      make(map[string]int),
+		used:       make(map[string]int64),
+		full:       make(map[string]bool),
+	}
+
+	// 按执行创建时间倒序分批处理，只在内存中保留各命令的执行计数与各范围的日志大小累计
+	var cursor *models.Execution
+	for {
+		executions, err := s.nextExecutions(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if len(executions) == 0 {
+			break
+		}
+
+		results, err := s.resultsOf(executions)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, execution := range executions {
+			if err := p.execution(execution, results[execution.ID]); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(executions) < batchSize {
+			break
+		}
+		cursor = executions[len(executions)-1]
+	}
+
+	if err := s.sweepOrphans(report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// planner 按保留策略逐条判断执行结果，已按执行创建时间倒序遍历
+type planner struct {
+	service    *Service
+	report     *Report
+	now        time.Time
+	global     Policy
+	policies   map[string]Policy // 各分组生效的策略
+	sizeScoped map[string]bool   // 单独限制日志大小的分组
+	ranks      map[string]int    // 各命令已遍历的执行数
+	used       map[string]int64  // 各范围保留的日志总大小
+	full       map[string]bool   // 已达到大小上限的范围，更早的日志均被清理
+}
+
+func (p *planner) policyOf(groupID string) Policy {
+	if policy, ok := p.policies[groupID]; ok {
+		return policy
+	}
+	return p.global
+}
+
+// execution 判断一次执行下的设备结果，结果全部被清理时删除执行记录；没有设备结果的执行按全局策略判断
+func (p *planner) execution(execution *models.Execution, candidates []*candidate) error {
+	rank := p.ranks[execution.CommandID]
+	p.ranks[execution.CommandID]++
+	p.report.ScannedResults += len(candidates)
+
+	if len(candidates) == 0 {
+		reason := p.reason(p.global, rank, execution.CreatedAt)
+		if reason == "" {
+			return nil
+		}
+		if !p.report.DryRun {
+			if err := p.service.db.Delete(&models.Execution{}, "id = ?", execution.ID).Error; err != nil {
+				logrus.Errorf("Failed to delete execution %s: %v", execution.ID, err)
+				return nil
+			}
+		}
+		p.report.Items = append(p.report.Items, &Item{
+			ExecutionID: execution.ID,
+			CommandID:   execution.CommandID,
+			Reason:      reason,
+			CreatedAt:   execution.CreatedAt,
+		})
+		p.report.DeletedExecutions++
+		return nil
+	}
+
+	remaining := len(candidates)
+	for _, c := range candidates {
+		policy := p.policyOf(c.GroupID)
+		reason := p.reason(policy, rank, c.CreatedAt)
+
+		var size int64
+		var err error
+		if reason == "" {
+			reason, size, err = p.sizeReason(c, policy)
+			if err != nil {
+				return err
+			}
+			if reason == "" {
+				continue
+			}
+		} else if size, err = p.service.logSize(c.LogPath); err != nil {
+			return err
+		}
+
+		if !p.report.DryRun {
+			if err := p.service.deleteResult(c); err != nil {
+				logrus.Errorf("Failed to delete execution result %s: %v", c.ResultID, err)
+				continue
+			}
+		}
+
+		p.report.Items = append(p.report.Items, &Item{
+			ResultID:    c.ResultID,
+			ExecutionID: c.ExecutionID,
+			CommandID:   c.CommandID,
+			DeviceID:    c.DeviceID,
+			GroupID:     c.GroupID,
+			LogID:       c.LogPath,
+			Size:        size,
+			Reason:      reason,
+			CreatedAt:   c.CreatedAt,
+		})
+		p.report.DeletedResults++
+		p.report.FreedBytes += size
+		remaining--
+	}
+
+	if remaining > 0 {
+		return nil
+	}
+
+	// 执行下所有设备结果均被清理后删除执行记录
+	if !p.report.DryRun {
+		if err := p.service.db.Delete(&models.Execution{}, "id = ?", execution.ID).Error; err != nil {
+			logrus.Errorf("Failed to delete execution %s: %v", execution.ID, err)
+			return nil
+		}
+	}
+	p.report.DeletedExecutions++
+	return nil
+}
+
+// reason 按执行次数与保留时间判断，rank为执行在所属命令中从新到旧的序号
+func (p *planner) reason(policy Policy, rank int, createdAt time.Time) string {
+	switch {
+	case policy.KeepLast > 0 && rank >= policy.KeepLast:
+		return ReasonKeepLast
+	case policy.MaxAgeDays > 0 && createdAt.Before(p.now.AddDate(0, 0, -policy.MaxAgeDays)):
+		return ReasonMaxAge
+	}
+	return ""
+}
+
+// sizeReason 按日志总大小判断：从新到旧累计保留的日志大小，超出上限后该范围内更早的日志全部清理
+// 设置了大小上限的分组单独计算，其余分组共用全局上限
+func (p *planner) sizeReason(c *candidate, policy Policy) (string, int64, error) {
+	limit := policy.MaxTotalSizeMB * 1024 * 1024
+	if limit <= 0 || c.LogPath == "" {
+		return "", 0, nil
+	}
+
+	size, err := p.service.logSize(c.LogPath)
+	if err != nil || size == 0 {
+		return "", size, err
+	}
+
+	scope := sizeScope(c, p.sizeScoped)
+	if !p.full[scope] && p.used[scope]+size <= limit {
+		p.used[scope] += size
+		return "", size, nil
+	}
+
+	p.full[scope] = true
+	return ReasonMaxTotalSize, size, nil
+}
+
+// groupPolicies 合并全局配置与分组规则，返回各分组生效的策略及单独限制日志大小的分组
+func (s *Service) groupPolicies(global Policy) (map[string]Policy, map[string]bool, error) {
+	var rules []*models.RetentionRule
+	if err := s.db.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return nil, nil, err
+	}
+
+	policies := make(map[string]Policy, len(rules))
+	sizeScoped := make(map[string]bool)
+	for _, rule := range rules {
+		policy := global
+		if rule.MaxAgeDays != nil {
+			policy.MaxAgeDays = *rule.MaxAgeDays
+		}
+		if rule.MaxTotalSizeMB != nil {
+			policy.MaxTotalSizeMB = *rule.MaxTotalSizeMB
+			sizeScoped[rule.GroupID] = true
+		}
+		if rule.KeepLast != nil {
+			policy.KeepLast = *rule.KeepLast
+		}
+		policies[rule.GroupID] = policy
+	}
+
+	return policies, sizeScoped, nil
+}
+
+// nextExecutions 按创建时间倒序读取cursor之后的一批已结束执行
+func (s *Service) nextExecutions(cursor *models.Execution) ([]*models.Execution, error) {
+	query := s.db.Select("id", "command_id", "created_at").
+		Where("status NOT IN ?", []string{models.ExecutionStatusPending, models.ExecutionStatusRunning})
+	if cursor != nil {
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	var executions []*models.Execution
+	if err := query.Order("created_at DESC, id DESC").Limit(batchSize).Find(&executions).Error; err != nil {
+		return nil, err
+	}
+	return executions, nil
+}
+
+// resultsOf 查询一批执行下的设备结果，按执行ID分组
+func (s *Service) resultsOf(executions []*models.Execution) (map[string][]*candidate, error) {
+	ids := make([]string, len(executions))
+	for i, execution := range executions {
+		ids[i] = execution.ID
+	}
+
+	var candidates []*candidate
+	err := s.db.Table("execution_results").
+		Select("execution_results.id AS result_id, execution_results.execution_id, executions.command_id, "+
+			"execution_results.device_id, IFNULL(devices.group_id, '') AS group_id, execution_results.log_path, "+
+			"executions.created_at AS created_at").
+		Joins("JOIN executions ON executions.id = execution_results.execution_id").
+		Joins("LEFT JOIN devices ON devices.id = execution_results.device_id").
+		Where("execution_results.execution_id IN ?", ids).
+		Order("execution_results.id ASC").
+		Scan(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string][]*candidate, len(executions))
+	for _, c := range candidates {
+		results[c.ExecutionID] = append(results[c.ExecutionID], c)
+	}
+	return results, nil
+}
+
+// logSize 返回日志大小，没有日志时为0
+func (s *Service) logSize(logID string) (int64, error) {
+	if logID == "" {
+		return 0, nil
+	}
+
+	object, err := s.logs.StatLog(logID)
+	if err == log.ErrLogNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return object.Size, nil
+}
+
+// deleteResult 删除设备结果的日志文件及记录，日志删除失败时保留记录以便下次重试
+func (s *Service) deleteResult(c *candidate) error {
+	if c.LogPath != "" {
+		if err := s.logs.DeleteLog(c.LogPath); err != nil {
+			return err
+		}
+	}
+	return s.db.Delete(&models.ExecutionResult{}, "id = ?", c.ResultID).Error
+}
+
+// sweepOrphans 分批遍历存储，清理没有设备结果引用且超过宽限期的日志
+// 这类日志来自被删除的命令或设备，或上传后未随结果上报关联的日志
+func (s *Service) sweepOrphans(report *Report) error {
+	cutoff := report.GeneratedAt.Add(-orphanGracePeriod)
+
+	return s.logs.WalkLogs("", func(objects []*log.LogObject) error {
+		ids := make([]string, len(objects))
+		for i, object := range objects {
+			ids[i] = object.LogID
+		}
+
+		var referenced []string
+		if err := s.db.Model(&models.ExecutionResult{}).Where("log_path IN ?", ids).
+			Pluck("log_path", &referenced).Error; err != nil {
+			return err
+		}
+		known := make(map[string]bool, len(referenced))
+		for _, id := range referenced {
+			known[id] = true
+		}
+
+		for _, object := range objects {
+			if known[object.LogID] || !object.ModTime.Before(cutoff) {
+				continue
+			}
+
+			if !report.DryRun {
+				if err := s.logs.DeleteLog(object.LogID); err != nil {
+					logrus.Errorf("Failed to delete orphaned log %s: %v", object.LogID, err)
+					continue
+				}
+			}
+
+			report.Items = append(report.Items, &Item{
+				LogID:     object.LogID,
+				Size:      object.Size,
+				Reason:    ReasonOrphan,
+				CreatedAt: object.ModTime,
+			})
+			report.DeletedOrphans++
+			report.FreedBytes += object.Size
+		}
+		return nil
+	})
+}
+
+// sizeScope 返回计算日志总大小时结果所属的范围，空字符串表示全局
+func sizeScope(c *candidate, sizeScoped map[string]bool) string {
+	if sizeScoped[c.GroupID] {
+		return c.GroupID
+	}
+	return ""
+}
+
+func validateInput(input RuleInput) error {
+	if (input.MaxAgeDays != nil && *input.MaxAgeDays < 0) ||
+		(input.MaxTotalSizeMB != nil && *input.MaxTotalSizeMB < 0) ||
+		(input.KeepLast != nil && *input.KeepLast < 0) {
+		return ErrInvalidRule
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package retention
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/gorm"
+)
+
+type fixture struct {
+	t       *testing.T
+	db      *gorm.DB
+	service *Service
+	now     time.Time
+}
+
+func newFixture(t *testing.T, policy Policy) *fixture {
+	config.AppConfig = &config.Config{
+		FileDir:             t.TempDir(),
+		RetentionMaxAgeDays: policy.MaxAgeDays,
+		RetentionMaxSizeMB:  policy.MaxTotalSizeMB,
+		RetentionKeepLast:   policy.KeepLast,
+	}
+	db := testutil.OpenDB(t)
+
+	return &fixture{t: t, db: db, service: NewService(), now: time.Now().Truncate(time.Second)}
+}
+
+func (f *fixture) device(id, groupID string) {
+	f.t.Helper()
+	if err := f.db.Create(&models.Device{ID: id, Name: id, Platform: "linux", OwnerID: 1, GroupID: groupID}).Error; err != nil {
+		f.t.Fatalf("create device: %v", err)
+	}
+}
+
+// execution 创建ageDays天前的已完成执行，每台设备一条结果，logSize大于0时写入对应大小的日志
+func (f *fixture) execution(id, commandID string, ageDays int, logSize int, deviceIDs ...string) {
+	f.t.Helper()
+	createdAt := f.now.AddDate(0, 0, -ageDays)
+	execution := &models.Execution{ID: id, CommandID: commandID, Status: models.ExecutionStatusCompleted, CreatedAt: createdAt}
+	if err := f.db.Create(execution).Error; err != nil {
+		f.t.Fatalf("create execution: %v", err)
+	}
+
+	for _, deviceID := range deviceIDs {
+		logID := ""
+		if logSize > 0 {
+			logID = id + "_" + deviceID + ".log"
+			if err := f.service.logs.AppendLog(logID, make([]byte, logSize)); err != nil {
+				f.t.Fatalf("write log: %v", err)
+			}
+		}
+		result := &models.ExecutionResult{
+			ID:          "res_" + id + "_" + deviceID,
+			ExecutionID: id,
+			DeviceID:    deviceID,
+			Status:      models.ResultStatusCompleted,
+			LogPath:     logID,
+			CreatedAt:   createdAt,
+		}
+		if err := f.db.Create(result).Error; err != nil {
+			f.t.Fatalf("create result: %v", err)
+		}
+	}
+}
+
+// reasons 返回报告中各执行结果（无结果时为执行、孤立日志时为日志ID）的清理原因
+func reasons(report *Report) map[string]string {
+	got := make(map[string]string)
+	for _, item := range report.Items {
+		switch {
+		case item.ResultID != "":
+			got[item.ResultID] = item.Reason
+		case item.ExecutionID != "":
+			got[item.ExecutionID] = item.Reason
+		default:
+			got[item.LogID] = item.Reason
+		}
+	}
+	return got
+}
+
+func assertReasons(t *testing.T, report *Report, want map[string]string) {
+	t.Helper()
+	got := reasons(report)
+	if len(got) != len(want) {
+		t.Errorf("report has %d items, want %d: %v", len(got), len(want), got)
+	}
+	for id, reason := range want {
+		if got[id] != reason {
+			t.Errorf("%s reason = %q, want %q", id, got[id], reason)
+		}
+	}
+}
+
+func TestPlanKeepLastAndMaxAge(t *testing.T) {
+	f := newFixture(t, Policy{MaxAgeDays: 30, KeepLast: 2})
+	f.device("dev_1", "")
+	f.device("dev_2", "")
+
+	f.execution("exec_a1", "cmd_a", 1, 0, "dev_1", "dev_2")
+	f.execution("exec_a2", "cmd_a", 2, 0, "dev_1")
+	f.execution("exec_a3", "cmd_a", 3, 0, "dev_1", "dev_2")
+	f.execution("exec_b1", "cmd_b", 40, 0, "dev_1")
+	f.execution("exec_b2", "cmd_b", 10, 0)
+	f.execution("exec_b3", "cmd_b", 50, 0)
+
+	// 执行中的记录不参与清理，也不计入保留次数
+	f.db.Create(&models.Execution{ID: "exec_running", CommandID: "cmd_b", Status: models.ExecutionStatusRunning, CreatedAt: f.now.AddDate(0, 0, -100)})
+
+	report, err := f.service.Plan()
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+
+	assertReasons(t, report, map[string]string{
+		"res_exec_a3_dev_1": ReasonKeepLast,
+		"res_exec_a3_dev_2": ReasonKeepLast,
+		"res_exec_b1_dev_1": ReasonMaxAge,
+		"exec_b3":           ReasonKeepLast,
+	})
+	if report.ScannedResults != 6 || report.DeletedResults != 3 || report.DeletedExecutions != 3 {
+		t.Errorf("report scanned %d, deleted %d results and %d executions, want 6, 3, 3",
+			report.ScannedResults, report.DeletedResults, report.DeletedExecutions)
+	}
+
+	var count int64
+	f.db.Model(&models.ExecutionResult{}).Count(&count)
+	if count != 6 {
+		t.Errorf("dry run deleted results, %d left", count)
+	}
+}
+
+func TestPlanGroupRules(t *testing.T) {
+	f := newFixture(t, Policy{MaxAgeDays: 30})
+	f.device("dev_web", "grp_web")
+	f.device("dev_db", "grp_db")
+	f.device("dev_other", "")
+
+	unlimited, short := 0, 5
+	f.service.db.Create(&models.RetentionRule{GroupID: "grp_web", MaxAgeDays: &unlimited, Enabled: true, CreatedBy: 1})
+	f.service.db.Create(&models.RetentionRule{GroupID: "grp_db", MaxAgeDays: &short, Enabled: true, CreatedBy: 1})
+	disabled := &models.RetentionRule{GroupID: "grp_other", MaxAgeDays: &short, CreatedBy: 1}
+	f.service.db.Create(disabled)
+
+	f.execution("exec_old", "cmd_a", 40, 0, "dev_web", "dev_db", "dev_other")
+	f.execution("exec_week", "cmd_a", 7, 0, "dev_web", "dev_db", "dev_other")
+
+	report, err := f.service.Plan()
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+
+	// 执行下仍有保留的结果时不删除执行记录
+	assertReasons(t, report, map[string]string{
+		"res_exec_old_dev_db":    ReasonMaxAge,
+		"res_exec_old_dev_other": ReasonMaxAge,
+		"res_exec_week_dev_db":   ReasonMaxAge,
+	})
+	if report.DeletedExecutions != 0 {
+		t.Errorf("deleted executions = %d, want 0", report.DeletedExecutions)
+	}
+}
+
+func TestPlanMaxTotalSize(t *testing.T) {
+	f := newFixture(t, Policy{MaxTotalSizeMB: 1})
+	f.device("dev_1", "")
+	f.device("dev_big", "grp_big")
+
+	limit := int64(2)
+	f.service.db.Create(&models.RetentionRule{GroupID: "grp_big", MaxTotalSizeMB: &limit, Enabled: true, CreatedBy: 1})
+
+	const kb = 1024
+	f.execution("exec_1", "cmd_a", 1, 600*kb, "dev_1", "dev_big")
+	f.execution("exec_2", "cmd_a", 2, 300*kb, "dev_1", "dev_big")
+	f.execution("exec_3", "cmd_a", 3, 300*kb, "dev_1", "dev_big")
+	f.execution("exec_4", "cmd_a", 4, 100*kb, "dev_1", "dev_big")
+
+	report, err := f.service.Plan()
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+
+	// 全局范围从新到旧累计 600K、900K，加上exec_3超出1MB后更早的日志也全部清理；grp_big单独按2MB计算
+	assertReasons(t, report, map[string]string{
+		"res_exec_3_dev_1": ReasonMaxTotalSize,
+		"res_exec_4_dev_1": ReasonMaxTotalSize,
+	})
+	if report.FreedBytes != 400*kb {
+		t.Errorf("freed bytes = %d, want %d", report.FreedBytes, 400*kb)
+	}
+}
+
+func TestApply(t *testing.T) {
+	f := newFixture(t, Policy{KeepLast: 1})
+	f.device("dev_1", "")
+
+	f.execution("exec_new", "cmd_a", 1, 10, "dev_1")
+	f.execution("exec_old", "cmd_a", 2, 10, "dev_1")
+	f.execution("exec_empty", "cmd_a", 3, 0)
+
+	// 没有结果引用的日志超过宽限期后清理
+	logDir := filepath.Join(config.AppConfig.FileDir, "logs")
+	f.service.logs.AppendLog("exec_gone_dev_1.log", []byte("orphan"))
+	f.service.logs.AppendLog("exec_fresh_dev_1.log", []byte("uploading"))
+	old := f.now.Add(-2 * orphanGracePeriod)
+	os.Chtimes(filepath.Join(logDir, "exec_gone_dev_1.log"), old, old)
+
+	report, err := f.service.Apply()
+	if err != nil {
+		t.Fatalf("Apply error: %v", err)
+	}
+	assertReasons(t, report, map[string]string{
+		"res_exec_old_dev_1":  ReasonKeepLast,
+		"exec_empty":          ReasonKeepLast,
+		"exec_gone_dev_1.log": ReasonOrphan,
+	})
+	if report.DeletedOrphans != 1 || report.FreedBytes != 10+int64(len("orphan")) {
+		t.Errorf("deleted orphans = %d, freed = %d", report.DeletedOrphans, report.FreedBytes)
+	}
+
+	var executions []string
+	f.db.Model(&models.Execution{}).Order("id").Pluck("id", &executions)
+	if strings.Join(executions, ",") != "exec_new" {
+		t.Errorf("executions left = %v, want [exec_new]", executions)
+	}
+
+	entries, _ := os.ReadDir(logDir)
+	var logs []string
+	for _, entry := range entries {
+		logs = append(logs, entry.Name())
+	}
+	if strings.Join(logs, ",") != "exec_fresh_dev_1.log,exec_new_dev_1.log" {
+		t.Errorf("logs left = %v", logs)
+	}
+
+	// 再次执行没有可清理的内容
+	report, err = f.service.Apply()
+	if err != nil || len(report.Items) != 0 {
+		t.Errorf("second Apply = %+v, %v", report, err)
+	}
+}
+
+func TestPlanPagesThroughExecutions(t *testing.T) {
+	f := newFixture(t, Policy{KeepLast: 1})
+	f.device("dev_1", "")
+
+	// 创建时间相同的执行按ID分页，不会跳过或重复
+	total := batchSize*2 + 10
+	for i := 0; i < total; i++ {
+		f.execution(fmt.Sprintf("exec_%04d", i), "cmd_a", 1, 0, "dev_1")
+	}
+
+	report, err := f.service.Plan()
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+	if report.ScannedResults != total || report.DeletedResults != total-1 {
+		t.Errorf("scanned %d, deleted %d, want %d, %d", report.ScannedResults, report.DeletedResults, total, total-1)
+	}
+	if got := reasons(report); got[fmt.Sprintf("res_exec_%04d_dev_1", total-1)] != "" {
+		t.Errorf("newest execution should be kept")
+	}
+}
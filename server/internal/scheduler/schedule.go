@@ -0,0 +1,52 @@
+// scheduler 包负责cron与once类型命令的服务端调度
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/XRSec/Cslite/models"
+	"github.com/robfig/cron/v3"
+)
+
+// 调度相关的错误定义
+var (
+	ErrInvalidSchedule = errors.New("invalid schedule") // 无效的调度表达式
+)
+
+// cronParser 使用标准五段式cron表达式（分 时 日 月 周）
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ValidateSchedule 校验命令类型对应的调度表达式
+func ValidateSchedule(cmdType, schedule string) error {
+	_, err := NextRun(cmdType, schedule, time.Now())
+	return err
+}
+
+// NextRun 计算命令在from之后的下次执行时间，返回nil表示不再调度
+func NextRun(cmdType, schedule string, from time.Time) (*time.Time, error) {
+	switch cmdType {
+	case models.CommandTypeCron:
+		sched, err := cronParser.Parse(schedule)
+		if err != nil {
+			return nil, ErrInvalidSchedule
+		}
+		next := sched.Next(from)
+		if next.IsZero() {
+			return nil, ErrInvalidSchedule
+		}
+		return &next, nil
+	case models.CommandTypeOnce:
+		// once类型未指定时间时立即执行
+		if schedule == "" {
+			return &from, nil
+		}
+		runAt, err := time.Parse(time.RFC3339, schedule)
+		if err != nil {
+			return nil, ErrInvalidSchedule
+		}
+		return &runAt, nil
+	default:
+		return nil, nil
+	}
+}
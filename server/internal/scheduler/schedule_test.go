@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/models"
+)
+
+func TestNextRun(t *testing.T) {
+	from := time.Date(2025, 6, 20, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		cmdType  string
+		schedule string
+		want     *time.Time
+		wantErr  bool
+	}{
+		{"cron every minute", models.CommandTypeCron, "* * * * *", timePtr(time.Date(2025, 6, 20, 10, 31, 0, 0, time.UTC)), false},
+		{"cron daily", models.CommandTypeCron, "0 3 * * *", timePtr(time.Date(2025, 6, 21, 3, 0, 0, 0, time.UTC)), false},
+		{"cron descriptor", models.CommandTypeCron, "@hourly", timePtr(time.Date(2025, 6, 20, 11, 0, 0, 0, time.UTC)), false},
+		{"cron six fields rejected", models.CommandTypeCron, "0 * * * * *", nil, true},
+		{"cron invalid", models.CommandTypeCron, "not a cron", nil, true},
+		{"cron empty", models.CommandTypeCron, "", nil, true},
+		{"once at time", models.CommandTypeOnce, "2025-07-01T08:00:00Z", timePtr(time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)), false},
+		{"once immediately", models.CommandTypeOnce, "", timePtr(from), false},
+		{"once invalid", models.CommandTypeOnce, "tomorrow", nil, true},
+		{"immediate not scheduled", models.CommandTypeImmediate, "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextRun(tt.cmdType, tt.schedule, from)
+			if tt.wantErr {
+				if err != ErrInvalidSchedule {
+					t.Fatalf("NextRun() error = %v, want ErrInvalidSchedule", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NextRun() unexpected error: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("NextRun() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
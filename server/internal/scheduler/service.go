@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/execution"
+	"github.com/XRSec/Cslite/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Scheduler 定时扫描到期的cron/once命令并创建执行记录，同时回收超时的设备结果
+type Scheduler struct {
+	db          *gorm.DB
+	executions  *execution.Service
+	cronEnabled bool
+	interval    time.Duration
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewScheduler 创建新的调度器实例
+func NewScheduler() *Scheduler {
+	interval := config.AppConfig.SchedulerInterval
+	if interval <= 0 {
+		interval = 10
+	}
+
+	return &Scheduler{
+		db:          config.DB,
+		executions:  execution.NewService(),
+		cronEnabled: config.AppConfig.CronEnabled,
+		interval:    time.Duration(interval) * time.Second,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start 启动调度循环
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// Stop 停止调度循环并等待退出
+func (s *Scheduler) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.tick()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.tick()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) tick() {
+	if s.cronEnabled {
+		s.fireDue()
+	}
+
+	if err := s.executions.ExpireTimedOut(); err != nil {
+		logrus.Error("Failed to expire timed out results: ", err)
+	}
+}
+
+func (s *Scheduler) fireDue() {
+	now := time.Now()
+
+	var commands []models.Command
+	if err := s.db.Where("type IN ? AND status IN ? AND next_run IS NOT NULL AND next_run <= ?",
+		[]string{models.CommandTypeCron, models.CommandTypeOnce},
+		[]string{models.CommandStatusPending, models.CommandStatusRunning},
+		now).Find(&commands).Error; err != nil {
+		logrus.Error("Failed to query due commands: ", err)
+		return
+	}
+
+	for i := range commands {
+		if err := s.fire(&commands[i], now); err != nil {
+			logrus.Errorf("Failed to schedule command %s: %v", commands[i].ID, err)
+		}
+	}
+}
+
+// fire 认领一次到期的调度并创建执行记录
+// 通过比较next_run做条件更新，保证重启或多实例时同一时刻只触发一次
+func (s *Scheduler) fire(command *models.Command, now time.Time) error {
+	// 停机期间错过的多次触发只补执行一次，下次时间从当前时刻重新计算
+	next, err := NextRun(command.Type, command.Schedule, now)
+	if err != nil {
+		logrus.Warnf("Command %s has invalid schedule %q, disabling", command.ID, command.Schedule)
+		next = nil
+	}
+	if command.Type == models.CommandTypeOnce {
+		next = nil
+	}
+
+	var dispatched *models.Execution
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Command{}).
+			Where("id = ? AND next_run = ?", command.ID, command.NextRun).
+			Updates(map[string]interface{}{
+				"next_run": next,
+				"last_run": now,
+				"status":   models.CommandStatusRunning,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 已被其他实例认领
+			return nil
+		}
+
+		var err error
+		if dispatched, err = s.executions.Dispatch(tx, command); err != nil {
+			return err
+		}
+
+		logrus.Infof("Scheduled command %s, execution %s", command.ID, dispatched.ID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.executions.NotifyTargets(dispatched)
+	return nil
+}
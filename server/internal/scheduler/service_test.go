@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/testutil"
+	"github.com/XRSec/Cslite/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func newTestScheduler(t *testing.T) (*Scheduler, *gorm.DB) {
+	config.AppConfig = &config.Config{FileDir: t.TempDir(), CronEnabled: true}
+	db := testutil.OpenDB(t)
+
+	db.Create(&models.User{ID: 1, Username: "admin", Password: "x", Role: models.RoleAdmin})
+	db.Create(&models.Device{ID: "dev_1", Name: "web-01", Platform: "linux", OwnerID: 1})
+	return NewScheduler(), db
+}
+
+func createCommand(t *testing.T, db *gorm.DB, id, cmdType, schedule string, nextRun time.Time) *models.Command {
+	t.Helper()
+	command := &models.Command{
+		ID:         id,
+		Name:       id,
+		Type:       cmdType,
+		Schedule:   schedule,
+		Content:    "uptime",
+		TargetType: models.TargetTypeDevices,
+		TargetIDs:  datatypes.JSON(`["dev_1"]`),
+		Status:     models.CommandStatusPending,
+		NextRun:    &nextRun,
+		CreatedBy:  1,
+	}
+	if err := db.Create(command).Error; err != nil {
+		t.Fatalf("create command: %v", err)
+	}
+	return command
+}
+
+func countExecutions(db *gorm.DB, commandID string) int64 {
+	var count int64
+	db.Model(&models.Execution{}).Where("command_id = ?", commandID).Count(&count)
+	return count
+}
+
+func TestFireClaimsOnce(t *testing.T) {
+	s, db := newTestScheduler(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	command := createCommand(t, db, "cmd_cron", models.CommandTypeCron, "*/5 * * * *", now.Add(-time.Hour))
+
+	// 同一个到期时间只能被认领一次，模拟多实例使用同一份过期的命令数据
+	stale := *command
+	if err := s.fire(command, now); err != nil {
+		t.Fatalf("fire error: %v", err)
+	}
+	if err := s.fire(&stale, now); err != nil {
+		t.Fatalf("second fire error: %v", err)
+	}
+	if got := countExecutions(db, "cmd_cron"); got != 1 {
+		t.Fatalf("executions = %d, want 1", got)
+	}
+
+	var fired models.Command
+	db.First(&fired, "id = ?", "cmd_cron")
+	want, _ := NextRun(models.CommandTypeCron, "*/5 * * * *", now)
+	if fired.NextRun == nil || !fired.NextRun.Equal(*want) {
+		t.Errorf("next_run = %v, want %v", fired.NextRun, want)
+	}
+	if fired.Status != models.CommandStatusRunning || fired.LastRun == nil {
+		t.Errorf("status = %s, last_run = %v", fired.Status, fired.LastRun)
+	}
+
+	var results int64
+	db.Model(&models.ExecutionResult{}).Where("device_id = ?", "dev_1").Count(&results)
+	if results != 1 {
+		t.Errorf("results = %d, want 1", results)
+	}
+}
+
+func TestFireDue(t *testing.T) {
+	s, db := newTestScheduler(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	createCommand(t, db, "cmd_once", models.CommandTypeOnce, now.Add(-time.Minute).Format(time.RFC3339), now.Add(-time.Minute))
+	createCommand(t, db, "cmd_future", models.CommandTypeCron, "0 0 * * *", now.Add(time.Hour))
+	paused := createCommand(t, db, "cmd_paused", models.CommandTypeCron, "* * * * *", now.Add(-time.Minute))
+	db.Model(paused).Update("status", models.CommandStatusPaused)
+
+	s.fireDue()
+
+	if countExecutions(db, "cmd_once") != 1 || countExecutions(db, "cmd_future") != 0 || countExecutions(db, "cmd_paused") != 0 {
+		t.Errorf("executions once = %d, future = %d, paused = %d, want 1, 0, 0",
+			countExecutions(db, "cmd_once"), countExecutions(db, "cmd_future"), countExecutions(db, "cmd_paused"))
+	}
+
+	// once命令触发后不再调度
+	var once models.Command
+	db.First(&once, "id = ?", "cmd_once")
+	if once.NextRun != nil {
+		t.Errorf("once next_run = %v, want nil", once.NextRun)
+	}
+
+	s.fireDue()
+	if got := countExecutions(db, "cmd_once"); got != 1 {
+		t.Errorf("once fired %d times", got)
+	}
+}
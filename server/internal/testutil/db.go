@@ -0,0 +1,38 @@
+// testutil 包提供了测试使用的辅助函数
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/XRSec/Cslite/config"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// OpenDB 创建临时SQLite数据库并完成迁移，同时设置为 config.DB，测试结束后自动关闭
+func OpenDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "cslite.db") + "?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=off"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get test database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	config.DB = db
+	return db
+}
@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+	"github.com/XRSec/Cslite/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// batchSize 每轮最多领取的推送记录数
+	batchSize = 50
+	// maxResponseBody 保存的响应内容上限（字节）
+	maxResponseBody = 1024
+	// maxBackoff 重试退避时间上限
+	maxBackoff = time.Hour
+)
+
+// Sign 计算推送签名：对"时间戳.请求体"做HMAC-SHA256，接收方用同一密钥校验
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff 第n次失败后的重试等待时间，从30秒开始翻倍，最长1小时
+func backoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// DeliverDue 推送到期的记录，返回本轮处理的记录数
+// 领取时以原next_attempt_at为条件推迟到超时之后，多实例部署时同一记录只会被一个实例推送
+func (s *Service) DeliverDue(now time.Time) (int, error) {
+	var due []*models.WebhookDelivery
+	if err := s.db.Where("status = ? AND next_attempt_at <= ?", models.DeliveryStatusPending, now).
+		Order("next_attempt_at ASC").Limit(batchSize).Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	lease := now.Add(s.timeout() + time.Minute)
+	handled := 0
+	for _, delivery := range due {
+		result := s.db.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, models.DeliveryStatusPending, delivery.NextAttemptAt).
+			Update("next_attempt_at", lease)
+		if result.Error != nil {
+			return handled, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		var webhook models.Webhook
+		if err := s.db.First(&webhook, delivery.WebhookID).Error; err != nil || !webhook.Enabled {
+			s.db.Model(delivery).Updates(map[string]interface{}{
+				"status":          models.DeliveryStatusFailed,
+				"next_attempt_at": nil,
+				"error":           "webhook deleted or disabled",
+			})
+			continue
+		}
+
+		if err := s.attempt(delivery, &webhook, false); err != nil {
+			logrus.Errorf("Failed to update webhook delivery %d: %v", delivery.ID, err)
+		}
+		handled++
+	}
+
+	return handled, nil
+}
+
+// attempt 发送一次推送并记录结果；final为true或尝试次数达到上限时失败即终止
+func (s *Service) attempt(delivery *models.WebhookDelivery, webhook *models.Webhook, final bool) error {
+	code, body, sendErr := s.send(delivery, webhook)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.ResponseBody = body
+	delivery.Error = ""
+	if sendErr != nil {
+		delivery.Error = truncate(sendErr.Error(), 500)
+	} else if code < 200 || code >= 300 {
+		delivery.Error = fmt.Sprintf("unexpected status code %d", code)
+	}
+
+	switch {
+	case delivery.Error == "":
+		delivery.Status = models.DeliveryStatusSuccess
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case final || delivery.Attempts >= s.maxAttempts():
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.NextAttemptAt = nil
+		logrus.Warnf("Webhook delivery %d to %s failed after %d attempts: %s", delivery.ID, webhook.URL, delivery.Attempts, delivery.Error)
+	default:
+		next := now.Add(backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+
+	return s.db.Model(delivery).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"response_code":   delivery.ResponseCode,
+		"response_body":   delivery.ResponseBody,
+		"error":           delivery.Error,
+		"delivered_at":    delivery.DeliveredAt,
+	}).Error
+}
+
+// send 以POST方式推送记录的内容，返回响应状态码与截断后的响应内容
+func (s *Service) send(delivery *models.WebhookDelivery, webhook *models.Webhook) (int, string, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Cslite-Webhook/1.0")
+	req.Header.Set("X-Cslite-Event", delivery.Event)
+	req.Header.Set("X-Cslite-Delivery", strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set("X-Cslite-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Cslite-Signature", Sign(webhook.Secret, timestamp, body))
+
+	client := utils.NewOutboundClient(s.timeout(), config.AppConfig.AllowPrivateTargets)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, string(respBody), nil
+}
+
+func (s *Service) timeout() time.Duration {
+	timeout := config.AppConfig.WebhookTimeout
+	if timeout <= 0 {
+		timeout = 10
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+func (s *Service) maxAttempts() int {
+	if config.AppConfig.WebhookMaxAttempts <= 0 {
+		return 6
+	}
+	return config.AppConfig.WebhookMaxAttempts
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,42 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"ping"}`)
+	want := "sha256=2028cd4257e207768945533877ddd99ae2bc824630b13859ba0f47864c7f6aff"
+
+	if got := Sign("whsec_test", 1718850000, body); got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+	if Sign("whsec_test", 1718850001, body) == want {
+		t.Error("Sign() should depend on the timestamp")
+	}
+	if Sign("whsec_other", 1718850000, body) == want {
+		t.Error("Sign() should depend on the secret")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
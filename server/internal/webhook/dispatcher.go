@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/sirupsen/logrus"
+)
+
+// pruneInterval 清理过期推送记录的间隔
+const pruneInterval = time.Hour
+
+// Dispatcher 定期推送到期的Webhook记录，有新事件发布时立即推送
+type Dispatcher struct {
+	service   *Service
+	interval  time.Duration
+	lastPrune time.Time
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewDispatcher 创建新的Webhook推送实例
+func NewDispatcher() *Dispatcher {
+	interval := config.AppConfig.WebhookInterval
+	if interval <= 0 {
+		interval = 5
+	}
+
+	return &Dispatcher{
+		service:  NewService(),
+		interval: time.Duration(interval) * time.Second,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动推送循环
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+	go d.loop()
+}
+
+// Stop 停止推送循环并等待退出
+func (d *Dispatcher) Stop() {
+	close(d.stopChan)
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) loop() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.run()
+		case <-wake:
+			d.run()
+		case <-d.stopChan:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) run() {
+	now := time.Now()
+	for {
+		// 一轮领取满批次时继续推送，直到没有到期记录
+		handled, err := d.service.DeliverDue(now)
+		if err != nil {
+			logrus.Error("Failed to deliver webhooks: ", err)
+			break
+		}
+		if handled < batchSize {
+			break
+		}
+	}
+
+	if now.Sub(d.lastPrune) >= pruneInterval {
+		d.lastPrune = now
+		pruned, err := d.service.prune(now)
+		if err != nil {
+			logrus.Error("Failed to prune webhook deliveries: ", err)
+		} else if pruned > 0 {
+			logrus.Infof("Pruned %d webhook deliveries", pruned)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+// webhook 包提供了出站Webhook的管理、事件发布与带重试的推送服务
+package webhook
+
+import "errors"
+
+// Webhook相关的错误定义
+var (
+	ErrWebhookNotFound = errors.New("webhook not found") // Webhook不存在
+	ErrInvalidWebhook  = errors.New("invalid webhook")   // Webhook参数无效
+	ErrGroupNotFound   = errors.New("group not found")   // 分组不存在
+)
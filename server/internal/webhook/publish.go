@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/XRSec/Cslite/models"
+	"github.com/sirupsen/logrus"
+)
+
+// maxFailedDevices 执行事件中列出的失败设备数上限
+const maxFailedDevices = 50
+
+// wake 通知推送循环有新的待推送记录
+var wake = make(chan struct{}, 1)
+
+// envelope 推送的JSON结构
+type envelope struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Publish 为订阅了事件的Webhook创建推送记录，由后台推送循环异步发送
+// ownerID为事件所属用户，只推送给该用户和管理员创建的Webhook；groupIDs为事件涉及设备所在的分组
+// 发布失败只记录日志，不影响触发事件的业务流程
+func (s *Service) Publish(event string, ownerID uint, groupIDs []string, data interface{}) {
+	var webhooks []*models.Webhook
+	if err := s.db.Preload("Creator").Where("enabled = ?", true).Find(&webhooks).Error; err != nil {
+		logrus.Errorf("Failed to load webhooks for %s: %v", event, err)
+		return
+	}
+
+	created := 0
+	for _, webhook := range webhooks {
+		if webhook.CreatedBy != ownerID && !webhook.Creator.IsAdmin() {
+			continue
+		}
+		if webhook.GroupID != "" && !contains(groupIDs, webhook.GroupID) {
+			continue
+		}
+		if !subscribed(webhook, event) {
+			continue
+		}
+
+		next := time.Now()
+		if _, err := s.enqueue(webhook, event, data, &next); err != nil {
+			logrus.Errorf("Failed to enqueue %s for webhook %d: %v", event, webhook.ID, err)
+			continue
+		}
+		created++
+	}
+
+	if created > 0 {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// enqueue 创建一条推送记录，nextAttemptAt为空时不会被推送循环领取
+func (s *Service) enqueue(webhook *models.Webhook, event string, data interface{}, nextAttemptAt *time.Time) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(envelope{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         event,
+		Payload:       string(payload),
+		Status:        models.DeliveryStatusPending,
+		NextAttemptAt: nextAttemptAt,
+	}
+	if err := s.db.Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ExecutionFinished 发布命令执行结束事件，results为每台设备最后一次执行的结果
+func (s *Service) ExecutionFinished(execution *models.Execution, results []models.ExecutionResult) {
+	var event string
+	switch execution.Status {
+	case models.ExecutionStatusCompleted:
+		event = models.WebhookEventExecutionCompleted
+	case models.ExecutionStatusFailed:
+		event = models.WebhookEventExecutionFailed
+	default:
+		return
+	}
+
+	deviceIDs := make([]string, len(results))
+	succeeded, failedCount := 0, 0
+	failed := make([]map[string]interface{}, 0)
+	for i, r := range results {
+		deviceIDs[i] = r.DeviceID
+		switch r.Status {
+		case models.ResultStatusCompleted:
+			succeeded++
+		case models.ResultStatusCancelled:
+		default:
+			failedCount++
+			if len(failed) < maxFailedDevices {
+				failed = append(failed, map[string]interface{}{
+					"device_id": r.DeviceID,
+					"status":    r.Status,
+					"exit_code": r.ExitCode,
+					"attempt":   r.Attempt,
+				})
+			}
+		}
+	}
+
+	s.Publish(event, execution.Command.CreatedBy, s.deviceGroups(deviceIDs), map[string]interface{}{
+		"execution_id":   execution.ID,
+		"command_id":     execution.CommandID,
+		"command_name":   execution.Command.Name,
+		"status":         execution.Status,
+		"total_devices":  len(results),
+		"succeeded":      succeeded,
+		"failed":         failedCount,
+		"failed_devices": failed,
+		"started_at":     execution.StartedAt,
+		"completed_at":   execution.CompletedAt,
+	})
+}
+
+// DeviceStatusChanged 发布设备离线或离线设备恢复上线的事件，其他状态变化不推送
+func (s *Service) DeviceStatusChanged(deviceID, from, to string) {
+	var event string
+	switch {
+	case to == models.StatusOffline:
+		event = models.WebhookEventDeviceOffline
+	case from == models.StatusOffline && to == models.StatusOnline:
+		event = models.WebhookEventDeviceOnline
+	default:
+		return
+	}
+
+	var device models.Device
+	if err := s.db.Select("id", "name", "platform", "owner_id", "group_id", "last_seen", "ip_address").
+		First(&device, "id = ?", deviceID).Error; err != nil {
+		logrus.Errorf("Failed to load device %s for %s: %v", deviceID, event, err)
+		return
+	}
+
+	s.Publish(event, device.OwnerID, []string{device.GroupID}, map[string]interface{}{
+		"device_id":  device.ID,
+		"name":       device.Name,
+		"platform":   device.Platform,
+		"group_id":   device.GroupID,
+		"from":       from,
+		"to":         to,
+		"last_seen":  device.LastSeen,
+		"ip_address": device.IPAddress,
+	})
+}
+
+// AgentRegistered 发布Agent注册了新设备的事件
+func (s *Service) AgentRegistered(agent *models.Agent, device *models.Device) {
+	s.Publish(models.WebhookEventAgentRegistered, device.OwnerID, []string{device.GroupID}, map[string]interface{}{
+		"agent_id":  agent.ID,
+		"device_id": device.ID,
+		"name":      device.Name,
+		"platform":  device.Platform,
+		"group_id":  device.GroupID,
+		"version":   agent.Version,
+	})
+}
+
+// deviceGroups 返回设备所在的分组ID列表
+func (s *Service) deviceGroups(deviceIDs []string) []string {
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+
+	var groupIDs []string
+	if err := s.db.Model(&models.Device{}).Unscoped().
+		Where("id IN ? AND group_id <> ''", deviceIDs).
+		Distinct().Pluck("group_id", &groupIDs).Error; err != nil {
+		logrus.Errorf("Failed to load device groups: %v", err)
+	}
+	return groupIDs
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
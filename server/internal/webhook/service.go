@@ -0,0 +1,280 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/models"
+	"github.com/XRSec/Cslite/utils"
+	"gorm.io/gorm"
+)
+
+// validEvents 可订阅的事件类型
+var validEvents = map[string]bool{
+	models.WebhookEventExecutionCompleted: true,
+	models.WebhookEventExecutionFailed:    true,
+	models.WebhookEventDeviceOffline:      true,
+	models.WebhookEventDeviceOnline:       true,
+	models.WebhookEventAgentRegistered:    true,
+}
+
+// Service Webhook服务
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建新的Webhook服务实例
+func NewService() *Service {
+	return &Service{
+		db: config.DB,
+	}
+}
+
+// Input 创建或更新Webhook的参数，更新时未提供的字段保持不变
+type Input struct {
+	Name    *string
+	URL     *string
+	Secret  *string
+	Events  []string
+	GroupID *string
+	Enabled *bool
+}
+
+// ListWebhooks 列出Webhook，非管理员只能看到自己创建的Webhook
+func (s *Service) ListWebhooks(userID uint, isAdmin bool) ([]*models.Webhook, error) {
+	query := s.db.Order("id ASC")
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	var webhooks []*models.Webhook
+	if err := query.Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// CreateWebhook 创建Webhook，未提供签名密钥时自动生成
+func (s *Service) CreateWebhook(userID uint, isAdmin bool, input Input) (*models.Webhook, error) {
+	webhook := &models.Webhook{
+		Enabled:   true,
+		CreatedBy: userID,
+	}
+	if err := s.apply(webhook, input, userID, isAdmin); err != nil {
+		return nil, err
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = generateSecret()
+	}
+
+	if err := s.db.Create(webhook).Error; err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// UpdateWebhook 更新Webhook
+func (s *Service) UpdateWebhook(webhookID uint, userID uint, isAdmin bool, input Input) (*models.Webhook, error) {
+	webhook, err := s.GetWebhook(webhookID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apply(webhook, input, userID, isAdmin); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(webhook).Error; err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook 删除Webhook及其推送记录
+func (s *Service) DeleteWebhook(webhookID uint, userID uint, isAdmin bool) error {
+	webhook, err := s.GetWebhook(webhookID, userID, isAdmin)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+}
+
+// GetWebhook 获取Webhook，非管理员只能获取自己创建的Webhook
+func (s *Service) GetWebhook(webhookID uint, userID uint, isAdmin bool) (*models.Webhook, error) {
+	query := s.db
+	if !isAdmin {
+		query = query.Where("created_by = ?", userID)
+	}
+
+	var webhook models.Webhook
+	if err := query.First(&webhook, webhookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// ListDeliveries 分页列出Webhook的推送记录，按创建时间倒序
+func (s *Service) ListDeliveries(webhookID uint, userID uint, isAdmin bool, status string, page, limit int) ([]*models.WebhookDelivery, int64, error) {
+	if _, err := s.GetWebhook(webhookID, userID, isAdmin); err != nil {
+		return nil, 0, err
+	}
+
+	query := s.db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var deliveries []*models.WebhookDelivery
+	offset := (page - 1) * limit
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// 响应内容只对管理员可见，避免通过推送读取目标服务的返回
+	if !isAdmin {
+		for _, d := range deliveries {
+			d.ResponseBody = ""
+		}
+	}
+
+	return deliveries, total, nil
+}
+
+// Test 立即向Webhook推送一次ping事件并返回推送记录，测试推送失败不重试
+func (s *Service) Test(webhookID uint, userID uint, isAdmin bool) (*models.WebhookDelivery, error) {
+	webhook, err := s.GetWebhook(webhookID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.enqueue(webhook, models.WebhookEventPing, map[string]interface{}{
+		"webhook_id": webhook.ID,
+		"name":       webhook.Name,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attempt(delivery, webhook, true); err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		delivery.ResponseBody = ""
+	}
+	return delivery, nil
+}
+
+// apply 将参数合并到Webhook并校验，分组须为当前用户创建（管理员不限）
+func (s *Service) apply(webhook *models.Webhook, input Input, userID uint, isAdmin bool) error {
+	if input.Name != nil {
+		webhook.Name = *input.Name
+	}
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Secret != nil && *input.Secret != "" {
+		webhook.Secret = *input.Secret
+	}
+	if input.Events != nil {
+		for _, event := range input.Events {
+			if !validEvents[event] {
+				return ErrInvalidWebhook
+			}
+		}
+		webhook.Events, _ = json.Marshal(input.Events)
+	}
+	if input.Enabled != nil {
+		webhook.Enabled = *input.Enabled
+	}
+
+	if webhook.Name == "" || len(webhook.Name) > 100 || len(webhook.Secret) > 100 || !validURL(webhook.URL) {
+		return ErrInvalidWebhook
+	}
+	// 地址不能指向内网，推送时连接前还会再次校验
+	if input.URL != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+		defer cancel()
+		if err := utils.CheckOutboundURL(ctx, webhook.URL, config.AppConfig.AllowPrivateTargets); err != nil {
+			return ErrInvalidWebhook
+		}
+	}
+
+	if input.GroupID != nil && *input.GroupID != webhook.GroupID {
+		if *input.GroupID != "" {
+			query := s.db.Model(&models.Group{}).Where("id = ?", *input.GroupID)
+			if !isAdmin {
+				query = query.Where("created_by = ?", userID)
+			}
+			var count int64
+			if err := query.Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrGroupNotFound
+			}
+		}
+		webhook.GroupID = *input.GroupID
+	}
+
+	return nil
+}
+
+func validURL(raw string) bool {
+	if len(raw) > 500 {
+		return false
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func generateSecret() string {
+	bytes := make([]byte, 24)
+	rand.Read(bytes)
+	return "whsec_" + hex.EncodeToString(bytes)
+}
+
+// subscribed 判断Webhook是否订阅了事件，未指定事件列表时订阅全部事件
+func subscribed(webhook *models.Webhook, event string) bool {
+	var events []string
+	if len(webhook.Events) == 0 || json.Unmarshal(webhook.Events, &events) != nil || len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// prune 删除超过保留天数且已结束的推送记录
+func (s *Service) prune(now time.Time) (int64, error) {
+	days := config.AppConfig.WebhookLogDays
+	if days <= 0 {
+		return 0, nil
+	}
+
+	result := s.db.Where("status <> ? AND created_at < ?", models.DeliveryStatusPending, now.AddDate(0, 0, -days)).
+		Delete(&models.WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
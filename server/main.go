@@ -7,6 +7,12 @@ import (
 
 	"github.com/XRSec/Cslite/api"
 	"github.com/XRSec/Cslite/config"
+	"github.com/XRSec/Cslite/internal/alert"
+	"github.com/XRSec/Cslite/internal/device"
+	"github.com/XRSec/Cslite/internal/metrics"
+	"github.com/XRSec/Cslite/internal/retention"
+	"github.com/XRSec/Cslite/internal/scheduler"
+	"github.com/XRSec/Cslite/internal/webhook"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -26,6 +32,30 @@ func main() {
 		logrus.Fatal("Failed to initialize database:", err)
 	}
 
+	// 启动后台调度器（定时命令调度与超时回收）
+	scheduler.NewScheduler().Start()
+
+	// 启动设备在线状态巡检
+	device.NewSweeper().Start()
+
+	// 启动告警规则评估
+	if config.AppConfig.AlertsEnabled {
+		alert.NewEvaluator().Start()
+	}
+
+	// 启动Webhook推送
+	webhook.NewDispatcher().Start()
+
+	// 启动日志保留清理
+	if config.AppConfig.RetentionEnabled {
+		retention.NewJanitor().Start()
+	}
+
+	// 启动设备指标历史汇总与清理
+	if config.AppConfig.MetricsEnabled {
+		metrics.NewRoller().Start()
+	}
+
 	// 在生产模式下设置Gin为发布模式
 	if config.AppConfig.Mode == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -33,6 +63,9 @@ func main() {
 
 	// 创建Gin路由器并设置API路由
 	router := gin.Default()
+	if err := api.SetupTrustedProxies(router, config.AppConfig.TrustedProxies); err != nil {
+		logrus.Fatal("Invalid trusted proxies:", err)
+	}
 	api.SetupRoutes(router)
 
 	// 构建服务器地址并启动服务器
@@ -0,0 +1,103 @@
+// models 包定义了应用程序的数据模型
+package models
+
+import (
+	"time"
+)
+
+// AlertRule 告警规则模型，按阈值持续评估目标设备最近一次心跳上报的指标
+type AlertRule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`                // 规则ID，主键
+	Name       string    `gorm:"size:100;not null" json:"name"`       // 规则名称
+	Metric     string    `gorm:"size:30;not null" json:"metric"`      // 评估的指标
+	Operator   string    `gorm:"size:2;not null" json:"operator"`     // 比较运算符（>、>=、<、<=）
+	Threshold  float64   `json:"threshold"`                           // 阈值
+	Duration   int       `gorm:"default:0" json:"duration"`           // 条件持续满足多少秒后触发
+	Severity   string    `gorm:"size:20;not null" json:"severity"`    // 告警级别
+	TargetType string    `gorm:"size:20;not null" json:"target_type"` // 目标类型（all/group/device）
+	TargetID   string    `gorm:"size:50" json:"target_id,omitempty"`  // 目标分组或设备ID
+	Enabled    bool      `gorm:"not null" json:"enabled"`             // 是否启用
+	CreatedBy  uint      `gorm:"not null;index" json:"created_by"`    // 创建者ID
+	CreatedAt  time.Time `json:"created_at"`                          // 创建时间
+	UpdatedAt  time.Time `json:"updated_at"`                          // 更新时间
+
+	// 关联关系
+	Creator User `gorm:"foreignKey:CreatedBy" json:"-"` // 规则创建者
+}
+
+// 告警指标常量
+const (
+	AlertMetricCPUUsage    = "cpu_usage"    // CPU使用率（%）
+	AlertMetricMemoryUsage = "memory_usage" // 内存使用率（%）
+	AlertMetricSwapUsage   = "swap_usage"   // swap使用率（%）
+	AlertMetricDiskUsage   = "disk_usage"   // 磁盘使用率（%），取所有挂载点中的最大值
+	AlertMetricLoad1       = "load_1"       // 1分钟平均负载
+	AlertMetricLoad5       = "load_5"       // 5分钟平均负载
+	AlertMetricLoad15      = "load_15"      // 15分钟平均负载
+	AlertMetricNetworkIn   = "network_in"   // 网络入流量（KB/s）
+	AlertMetricNetworkOut  = "network_out"  // 网络出流量（KB/s）
+	AlertMetricOffline     = "offline"      // 设备离线，不比较阈值
+)
+
+// 告警级别常量
+const (
+	AlertSeverityInfo     = "info"     // 提示
+	AlertSeverityWarning  = "warning"  // 警告
+	AlertSeverityCritical = "critical" // 严重
+)
+
+// 告警目标类型常量
+const (
+	AlertTargetAll    = "all"    // 规则创建者可见的所有设备
+	AlertTargetGroup  = "group"  // 指定分组内的设备
+	AlertTargetDevice = "device" // 指定设备
+)
+
+// Alert 告警模型，同一规则在同一设备上同时只有一条未恢复的告警
+type Alert struct {
+	ID              uint64     `gorm:"primaryKey" json:"id"`                                                     // 告警ID，主键
+	RuleID          uint       `gorm:"not null;index:idx_alert_rule_device,priority:1" json:"rule_id"`           // 关联的规则ID
+	DeviceID        string     `gorm:"size:50;not null;index:idx_alert_rule_device,priority:2" json:"device_id"` // 关联的设备ID
+	Status          string     `gorm:"size:20;not null;index" json:"status"`                                     // 告警状态
+	Value           float64    `json:"value"`                                                                    // 最近一次评估的指标值
+	Silenced        bool       `gorm:"not null;default:false" json:"silenced"`                                   // 是否被静默
+	StartsAt        time.Time  `json:"starts_at"`                                                                // 条件首次满足的时间
+	FiredAt         *time.Time `json:"fired_at,omitempty"`                                                       // 触发时间
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`                                                    // 恢复时间
+	LastEvaluatedAt time.Time  `json:"last_evaluated_at"`                                                        // 最近一次评估时间
+	CreatedAt       time.Time  `json:"created_at"`                                                               // 创建时间
+	UpdatedAt       time.Time  `json:"updated_at"`                                                               // 更新时间
+
+	// 关联关系
+	Rule AlertRule `gorm:"foreignKey:RuleID" json:"rule"` // 关联的规则
+}
+
+// 告警状态常量
+const (
+	AlertStatusPending  = "pending"  // 条件已满足，持续时间未到
+	AlertStatusFiring   = "firing"   // 已触发
+	AlertStatusResolved = "resolved" // 已恢复
+)
+
+// AlertSilence 告警静默模型，生效期间匹配的告警照常评估但标记为静默
+type AlertSilence struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`             // 静默ID，主键
+	RuleID    *uint     `gorm:"index" json:"rule_id"`             // 匹配的规则ID，为空时匹配所有规则
+	DeviceID  string    `gorm:"size:50" json:"device_id"`         // 匹配的设备ID，为空时匹配所有设备
+	StartsAt  time.Time `json:"starts_at"`                        // 生效时间
+	EndsAt    time.Time `gorm:"index" json:"ends_at"`             // 失效时间
+	Comment   string    `gorm:"size:255" json:"comment"`          // 备注
+	CreatedBy uint      `gorm:"not null;index" json:"created_by"` // 创建者ID
+	CreatedAt time.Time `json:"created_at"`                       // 创建时间
+}
+
+// Matches 判断静默在指定时间是否匹配规则与设备
+func (s *AlertSilence) Matches(ruleID uint, deviceID string, now time.Time) bool {
+	if now.Before(s.StartsAt) || !now.Before(s.EndsAt) {
+		return false
+	}
+	if s.RuleID != nil && *s.RuleID != ruleID {
+		return false
+	}
+	return s.DeviceID == "" || s.DeviceID == deviceID
+}
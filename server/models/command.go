@@ -13,15 +13,28 @@ type Command struct {
 	ID          string         `gorm:"primaryKey;size:50" json:"id"`                    // 命令ID，主键
 	Name        string         `gorm:"size:100;not null" json:"name"`                   // 命令名称
 	Type        string         `gorm:"size:20;not null" json:"type"`                    // 命令类型（once/cron/immediate）
-	Schedule    string         `gorm:"size:100" json:"schedule,omitempty"`              // 定时表达式（cron格式，客户端执行）
-	Content     string         `gorm:"type:text;not null" json:"content"`               // 命令内容
+	Schedule    string         `gorm:"size:100" json:"schedule,omitempty"`              // 定时表达式（cron为cron格式，once为RFC3339时间）
+	Interpreter string         `gorm:"size:20" json:"interpreter,omitempty"`            // 解释器（sh/bash/python/powershell/cmd/exec，为空时使用设备平台默认shell）
+	Content     string         `gorm:"type:text;not null" json:"content"`               // 命令内容（exec解释器为可执行文件路径）
+	Script      string         `gorm:"type:mediumtext" json:"script,omitempty"`         // 脚本内容，非空时以脚本文件方式执行
+	Args        datatypes.JSON `gorm:"type:json" json:"args,omitempty"`                 // 脚本或可执行文件的参数列表（JSON数组）
+	RunAs       string         `gorm:"size:64" json:"run_as,omitempty"`                 // 执行用户（用户名或UID，为空时以Agent自身身份执行）
+	RunAsGroup  string         `gorm:"size:64" json:"run_as_group,omitempty"`           // 执行用户组（组名或GID，为空时使用执行用户的主组）
+	WorkingDir  string         `gorm:"size:255" json:"working_dir,omitempty"`           // 工作目录（绝对路径）
+	Umask       string         `gorm:"size:4" json:"umask,omitempty"`                   // 文件创建掩码（八进制，如022）
+	ResourceLimits datatypes.JSON `gorm:"type:json" json:"resource_limits,omitempty"`   // 资源限制（JSON格式，Linux Agent通过cgroup v2执行）
 	TargetType  string         `gorm:"size:20;not null" json:"target_type"`             // 目标类型（devices/groups）
 	TargetIDs   datatypes.JSON `gorm:"type:json" json:"target_ids"`                     // 目标ID列表（JSON数组）
 	Timeout     int            `gorm:"default:1800" json:"timeout"`                     // 超时时间（秒）
 	RetryPolicy datatypes.JSON `gorm:"type:json" json:"retry_policy,omitempty"`         // 重试策略（JSON格式）
 	EnvVars     datatypes.JSON `gorm:"type:json" json:"env_vars,omitempty"`             // 环境变量（JSON格式）
+	Concurrency int            `gorm:"default:0" json:"concurrency"`                    // 同时执行的最大设备数（0表示不限制）
+	LockKey     string         `gorm:"size:100" json:"lock_key,omitempty"`              // 互斥锁键，同一设备上相同锁键的命令不会同时执行
+	NotifyOn    string         `gorm:"size:20" json:"notify_on,omitempty"`              // 执行结束时的通知时机（failure/success/always，为空不通知）
+	NotifyChannels datatypes.JSON `gorm:"type:json" json:"notify_channels,omitempty"`   // 通知渠道ID列表（JSON数组，为空时发送邮件给创建者）
 	Status      string         `gorm:"size:20;default:'pending'" json:"status"`         // 命令状态
-	// NextRun     *time.Time     `json:"next_run,omitempty"`                              // 下次执行时间（客户端计算）
+	NextRun     *time.Time     `gorm:"index" json:"next_run,omitempty"`                 // 下次执行时间（服务端调度器维护）
+	LastRun     *time.Time     `json:"last_run,omitempty"`                              // 上次触发时间
 	CreatedBy   uint           `gorm:"not null;index" json:"created_by"`                // 创建者ID
 	CreatedAt   time.Time      `json:"created_at"`                                      // 创建时间
 	UpdatedAt   time.Time      `json:"updated_at"`                                      // 更新时间
@@ -35,9 +48,16 @@ type Command struct {
 // 命令类型常量
 const (
 	CommandTypeOnce      = "once"      // 一次性命令
-	CommandTypeCron      = "cron"      // 定时命令（客户端执行）
+	CommandTypeCron      = "cron"      // 定时命令（服务端调度）
 	CommandTypeImmediate = "immediate" // 立即执行命令
 
+	InterpreterSh         = "sh"         // POSIX shell
+	InterpreterBash       = "bash"       // Bash
+	InterpreterPython     = "python"     // Python（优先python3）
+	InterpreterPowerShell = "powershell" // PowerShell（优先pwsh）
+	InterpreterCmd        = "cmd"        // Windows cmd.exe
+	InterpreterExec       = "exec"       // 不经过shell直接执行可执行文件
+
 	TargetTypeDevices = "devices" // 目标类型：设备
 	TargetTypeGroups  = "groups"  // 目标类型：组
 
@@ -47,10 +67,72 @@ const (
 	CommandStatusFailed    = "failed"    // 执行失败状态
 	CommandStatusPaused    = "paused"    // 暂停状态
 	CommandStatusCancelled = "cancelled" // 已取消状态
+
+	NotifyOnFailure = "failure" // 执行失败时通知
+	NotifyOnSuccess = "success" // 执行成功时通知
+	NotifyOnAlways  = "always"  // 执行结束时总是通知
+)
+
+// 重试退避默认值
+const (
+	DefaultRetryBackoff    = 30  // 首次重试等待时间（秒）
+	DefaultRetryMultiplier = 2   // 退避倍数
+	DefaultRetryMaxBackoff = 600 // 最长等待时间（秒）
 )
 
 // RetryPolicy 重试策略结构体
 type RetryPolicy struct {
-	Enabled     bool `json:"enabled"`     // 是否启用重试
-	MaxAttempts int  `json:"max_attempts"` // 最大重试次数
-}
\ No newline at end of file
+	Enabled           bool    `json:"enabled"`                       // 是否启用重试
+	MaxAttempts       int     `json:"max_attempts"`                  // 最大执行次数（含首次执行）
+	BackoffSeconds    int     `json:"backoff_seconds,omitempty"`     // 首次重试前等待时间（秒）
+	BackoffMultiplier float64 `json:"backoff_multiplier,omitempty"`  // 每次重试等待时间的倍数
+	MaxBackoffSeconds int     `json:"max_backoff_seconds,omitempty"` // 最长等待时间（秒）
+}
+
+// Backoff 返回第attempt次执行失败后，下一次重试前的等待时间
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.BackoffSeconds)
+	if p.BackoffSeconds == 0 {
+		backoff = DefaultRetryBackoff
+	}
+	multiplier := p.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = DefaultRetryMultiplier
+	}
+	maxBackoff := float64(p.MaxBackoffSeconds)
+	if p.MaxBackoffSeconds == 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= multiplier
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	return time.Duration(backoff) * time.Second
+}
+
+// CanRetry 判断第attempt次执行失败后是否还可以重试
+func (p *RetryPolicy) CanRetry(attempt int) bool {
+	return p != nil && p.Enabled && attempt < p.MaxAttempts
+}
+
+// ResourceLimits 命令执行的资源限制，为0的项不限制
+type ResourceLimits struct {
+	MemoryMaxMB int64 `json:"memory_max_mb,omitempty"` // 内存上限（MB），超出时进程被OOM终止
+	CPUPercent  int   `json:"cpu_percent,omitempty"`   // CPU配额，占单核的百分比（如150表示1.5核）
+	PidsMax     int   `json:"pids_max,omitempty"`      // 最大进程/线程数
+	IOWeight    int   `json:"io_weight,omitempty"`     // IO权重（1-10000）
+}
+
+// IsZero 判断是否未设置任何限制
+func (l *ResourceLimits) IsZero() bool {
+	return l == nil || (l.MemoryMaxMB == 0 && l.CPUPercent == 0 && l.PidsMax == 0 && l.IOWeight == 0)
+}
+
+// Valid 校验资源限制取值
+func (l *ResourceLimits) Valid() bool {
+	return l.MemoryMaxMB >= 0 && l.CPUPercent >= 0 && l.PidsMax >= 0 && l.IOWeight >= 0 && l.IOWeight <= 10000
+}
@@ -4,6 +4,7 @@ package models
 import (
 	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -17,6 +18,9 @@ type Device struct {
 	Status    string         `gorm:"size:20;default:'offline'" json:"status"` // 设备状态
 	LastSeen  time.Time      `json:"last_seen"`                              // 最后在线时间
 	IPAddress string         `gorm:"size:45" json:"ip_address,omitempty"`    // 设备IP地址
+	MaxConcurrency int       `gorm:"default:0" json:"max_concurrency"`       // 设备同时执行的最大任务数（0表示不限制）
+	HeartbeatInterval int    `gorm:"default:0" json:"heartbeat_interval,omitempty"` // Agent上报的心跳间隔（秒，0表示旧版Agent未上报）
+	EnvVars   datatypes.JSON `gorm:"type:json" json:"env_vars,omitempty"`    // 设备执行命令的默认环境变量（JSON格式）
 	CreatedAt time.Time      `json:"created_at"`                             // 创建时间
 	UpdatedAt time.Time      `json:"updated_at"`                             // 更新时间
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`                         // 软删除时间戳
@@ -31,6 +35,7 @@ const (
 	StatusOnline  = "online"  // 在线状态
 	StatusOffline = "offline" // 离线状态
 	StatusBusy    = "busy"    // 忙碌状态
+	StatusStale   = "stale"   // 失联状态（错过多次心跳，尚未判定离线）
 )
 
 // Agent 代理模型，表示设备上运行的代理程序
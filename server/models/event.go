@@ -0,0 +1,29 @@
+// models 包定义了应用程序的数据模型
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// DeviceEvent 设备事件模型，记录设备状态变化等事件
+type DeviceEvent struct {
+	ID        uint64         `gorm:"primaryKey" json:"id"`                                                // 事件ID，主键
+	DeviceID  string         `gorm:"size:50;not null;index:idx_device_event,priority:1" json:"device_id"` // 关联的设备ID
+	Type      string         `gorm:"size:30;not null;index" json:"type"`                                  // 事件类型
+	Message   string         `gorm:"size:255" json:"message"`                                             // 事件描述
+	Details   datatypes.JSON `gorm:"type:json" json:"details,omitempty"`                                  // 事件详情（JSON格式）
+	CreatedAt time.Time      `gorm:"index:idx_device_event,priority:2" json:"created_at"`                 // 发生时间
+}
+
+// 设备事件类型常量
+const (
+	DeviceEventRegister        = "register"         // 设备注册
+	DeviceEventHeartbeatGap    = "heartbeat_gap"    // 心跳中断后恢复
+	DeviceEventStatusChange    = "status_change"    // 在线状态变化
+	DeviceEventCommandDispatch = "command_dispatch" // 命令下发到设备
+	DeviceEventCommandResult   = "command_result"   // 命令执行结果
+	DeviceEventGroupChange     = "group_change"     // 所属分组变化
+	DeviceEventDelete          = "delete"           // 设备删除
+)
@@ -3,6 +3,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/datatypes"
 )
 
 // Execution 执行记录模型，表示命令的执行实例
@@ -26,19 +28,30 @@ const (
 	ExecutionStatusRunning   = "running"   // 执行中状态
 	ExecutionStatusCompleted = "completed" // 已完成状态
 	ExecutionStatusFailed    = "failed"    // 执行失败状态
+	ExecutionStatusCancelled = "cancelled" // 已取消状态
 )
 
 // ExecutionResult 执行结果模型，表示单个设备上的命令执行结果
 type ExecutionResult struct {
 	ID          string     `gorm:"primaryKey;size:50" json:"id"`                    // 结果ID，主键
-	ExecutionID string     `gorm:"size:50;not null;index" json:"execution_id"`      // 关联的执行ID
-	DeviceID    string     `gorm:"size:50;not null;index" json:"device_id"`         // 关联的设备ID
+	ExecutionID string     `gorm:"size:50;not null;index;uniqueIndex:idx_result_attempt" json:"execution_id"` // 关联的执行ID
+	DeviceID    string     `gorm:"size:50;not null;index;uniqueIndex:idx_result_attempt" json:"device_id"`    // 关联的设备ID
+	Attempt     int        `gorm:"not null;default:1;uniqueIndex:idx_result_attempt" json:"attempt"`          // 第几次执行（重试时递增）
+	NotBefore   *time.Time `json:"not_before,omitempty"`                           // 重试最早下发时间
+	DeliveryState string   `gorm:"size:20;not null;default:'queued';index" json:"delivery_state"` // 下发状态
+	DeliveryCount int      `gorm:"default:0" json:"delivery_count"`                 // 已下发给Agent的次数
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`                          // 最近一次下发时间
+	LeaseUntil  *time.Time `json:"lease_until,omitempty"`                           // 下发租约到期时间，到期未确认则重新下发
+	AckedAt     *time.Time `json:"acked_at,omitempty"`                              // Agent确认收到的时间
 	Status      string     `gorm:"size:20;not null" json:"status"`                  // 执行状态
 	ExitCode    int        `gorm:"default:0" json:"exit_code"`                      // 退出码
-	Output      string     `gorm:"type:text" json:"output,omitempty"`               // 命令输出
+	Output      string     `gorm:"type:mediumtext" json:"output,omitempty"`         // 命令输出（运行中持续追加）
+	OutputSeq   int        `gorm:"default:0" json:"-"`                              // 已追加的最后一个输出分片序号
 	LogPath     string     `gorm:"size:255" json:"log_path,omitempty"`              // 日志文件路径
+	ResourceUsage datatypes.JSON `gorm:"type:json" json:"resource_usage,omitempty"` // 资源使用峰值（设置了资源限制时由Agent上报）
 	StartedAt   time.Time  `json:"started_at"`                                       // 开始执行时间
 	CompletedAt *time.Time `json:"completed_at,omitempty"`                          // 完成时间
+	ReportedAt  *time.Time `json:"reported_at,omitempty"`                           // Agent上报最终结果的时间
 	CreatedAt   time.Time  `json:"created_at"`                                       // 创建时间
 
 	// 关联关系
@@ -49,8 +62,30 @@ type ExecutionResult struct {
 // 结果状态常量
 const (
 	ResultStatusPending   = "pending"   // 待执行状态
+	ResultStatusRunning   = "running"   // 执行中（已开始上报输出）
 	ResultStatusCompleted = "completed" // 执行完成
 	ResultStatusFailed    = "failed"    // 执行失败
 	ResultStatusTimeout   = "timeout"   // 执行超时
 	ResultStatusCancelled = "cancelled" // 执行取消
-)
\ No newline at end of file
+	ResultStatusLost      = "lost"      // 设备离线，结果丢失
+
+	ResultStatusInterpreterUnavailable = "interpreter_unavailable" // 设备上没有可用的解释器
+	ResultStatusOOMKilled              = "oom_killed"              // 超出内存限制被终止
+)
+
+// 下发状态常量
+const (
+	DeliveryStateQueued       = "queued"       // 等待下发
+	DeliveryStateDelivered    = "delivered"    // 已随拉取响应下发，等待Agent确认
+	DeliveryStateAcknowledged = "acknowledged" // Agent已确认收到
+	DeliveryStateRunning      = "running"      // Agent已开始上报输出
+	DeliveryStateDone         = "done"         // 已结束（上报结果、超时或取消）
+)
+
+// ResourceUsage 命令执行期间的资源使用情况
+type ResourceUsage struct {
+	MemoryPeakBytes int64 `json:"memory_peak_bytes"` // 内存使用峰值（字节）
+	CPUUsageUsec    int64 `json:"cpu_usage_usec"`    // 累计CPU时间（微秒）
+	PidsPeak        int   `json:"pids_peak"`         // 进程/线程数峰值
+	OOMKills        int   `json:"oom_kills"`         // 被OOM终止的进程数
+}
\ No newline at end of file
@@ -4,6 +4,7 @@ package models
 import (
 	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -12,6 +13,7 @@ type Group struct {
 	ID          string         `gorm:"primaryKey;size:50" json:"id"`           // 组ID，主键
 	Name        string         `gorm:"size:100;not null" json:"name"`          // 组名称
 	Description string         `gorm:"size:500" json:"description"`            // 组描述
+	EnvVars     datatypes.JSON `gorm:"type:json" json:"env_vars,omitempty"`    // 组内设备执行命令的默认环境变量（JSON格式）
 	CreatedBy   uint           `gorm:"not null;index" json:"created_by"`       // 创建者ID
 	CreatedAt   time.Time      `json:"created_at"`                             // 创建时间
 	UpdatedAt   time.Time      `json:"updated_at"`                             // 更新时间
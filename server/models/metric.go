@@ -0,0 +1,32 @@
+// models 包定义了应用程序的数据模型
+package models
+
+import (
+	"time"
+)
+
+// MetricSample 设备指标历史样本
+// 原始样本由每次心跳写入，5分钟与1小时样本由后台按时间桶汇总生成，汇总值为所含原始样本的平均值
+type MetricSample struct {
+	ID          uint64    `gorm:"primaryKey" json:"-"`                                                                                            // 样本ID，主键
+	DeviceID    string    `gorm:"size:50;not null;uniqueIndex:idx_metric_sample,priority:1" json:"-"`                                             // 设备ID
+	Resolution  string    `gorm:"size:10;not null;uniqueIndex:idx_metric_sample,priority:2;index:idx_metric_resolution_time,priority:1" json:"-"` // 粒度（raw/5m/1h）
+	Timestamp   time.Time `gorm:"not null;uniqueIndex:idx_metric_sample,priority:3;index:idx_metric_resolution_time,priority:2" json:"timestamp"` // 采样时间，汇总样本为时间桶起点
+	CPUUsage    float64   `json:"cpu_usage"`                                                                                                      // CPU使用率（%）
+	CPUMax      float64   `json:"cpu_max"`                                                                                                        // 时间桶内CPU使用率峰值（%）
+	MemoryUsed  int       `json:"memory_used"`                                                                                                    // 内存使用量（MB）
+	MemoryTotal int       `json:"memory_total"`                                                                                                   // 内存总量（MB）
+	SwapUsed    int       `json:"swap_used"`                                                                                                      // swap使用量（MB）
+	DiskUsage   float64   `json:"disk_usage"`                                                                                                     // 根分区磁盘使用率（%）
+	NetworkIn   int       `json:"network_in"`                                                                                                     // 网络入流量（KB/s）
+	NetworkOut  int       `json:"network_out"`                                                                                                    // 网络出流量（KB/s）
+	Load1       float64   `json:"load_1"`                                                                                                         // 1分钟平均负载
+	Samples     int       `gorm:"not null;default:1" json:"samples"`                                                                              // 包含的原始样本数
+}
+
+// 指标粒度常量
+const (
+	MetricResolutionRaw = "raw" // 原始样本
+	MetricResolution5m  = "5m"  // 5分钟汇总
+	MetricResolution1h  = "1h"  // 1小时汇总
+)
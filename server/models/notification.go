@@ -0,0 +1,30 @@
+// models 包定义了应用程序的数据模型
+package models
+
+import "time"
+
+// NotificationChannel 通知渠道模型，命令执行结束时按命令的通知设置发送邮件或群聊消息
+type NotificationChannel struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`                // 渠道ID，主键
+	Name      string    `gorm:"size:100;not null" json:"name"`       // 名称
+	Type      string    `gorm:"size:20;not null" json:"type"`        // 渠道类型
+	Target    string    `gorm:"size:500" json:"target"`              // 邮件为收件人列表（逗号分隔，为空时发给创建者），群聊为机器人Webhook地址
+	Secret    string    `gorm:"size:100" json:"-"`                   // 飞书、钉钉机器人的签名密钥
+	Template  string    `gorm:"type:text" json:"template,omitempty"` // 消息模板（Go text/template），为空时使用默认模板
+	Enabled   bool      `gorm:"not null" json:"enabled"`             // 是否启用
+	CreatedBy uint      `gorm:"not null;index" json:"created_by"`    // 创建者ID
+	CreatedAt time.Time `json:"created_at"`                          // 创建时间
+	UpdatedAt time.Time `json:"updated_at"`                          // 更新时间
+
+	// 关联关系
+	Creator User `gorm:"foreignKey:CreatedBy" json:"-"` // 创建者
+}
+
+// 通知渠道类型常量
+const (
+	ChannelTypeEmail    = "email"    // SMTP邮件
+	ChannelTypeSlack    = "slack"    // Slack Incoming Webhook
+	ChannelTypeFeishu   = "feishu"   // 飞书群机器人
+	ChannelTypeDingTalk = "dingtalk" // 钉钉群机器人
+	ChannelTypeWeCom    = "wecom"    // 企业微信群机器人
+)
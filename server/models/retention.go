@@ -0,0 +1,23 @@
+// models 包定义了应用程序的数据模型
+package models
+
+import (
+	"time"
+)
+
+// RetentionRule 日志保留规则模型，按设备分组覆盖全局保留策略
+// 各限制字段为空时沿用全局配置，为0时表示不限制
+type RetentionRule struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`                         // 规则ID，主键
+	GroupID        string    `gorm:"size:50;not null;uniqueIndex" json:"group_id"` // 适用的分组ID
+	MaxAgeDays     *int      `json:"max_age_days"`                                 // 执行记录最长保留天数
+	MaxTotalSizeMB *int64    `json:"max_total_size_mb"`                            // 分组日志总大小上限（MB）
+	KeepLast       *int      `json:"keep_last"`                                    // 每个命令保留最近N次执行
+	Enabled        bool      `gorm:"not null" json:"enabled"`                      // 是否启用
+	CreatedBy      uint      `gorm:"not null" json:"created_by"`                   // 创建者ID
+	CreatedAt      time.Time `json:"created_at"`                                   // 创建时间
+	UpdatedAt      time.Time `json:"updated_at"`                                   // 更新时间
+
+	// 关联关系
+	Group Group `gorm:"foreignKey:GroupID" json:"-"` // 关联的分组
+}
@@ -0,0 +1,59 @@
+// models 包定义了应用程序的数据模型
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Webhook 出站Webhook模型，事件发生时向URL推送HMAC签名的JSON
+type Webhook struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`                    // Webhook ID，主键
+	Name      string         `gorm:"size:100;not null" json:"name"`           // 名称
+	URL       string         `gorm:"size:500;not null" json:"url"`            // 推送地址
+	Secret    string         `gorm:"size:100;not null" json:"-"`              // 签名密钥
+	Events    datatypes.JSON `gorm:"type:json" json:"events"`                 // 订阅的事件类型列表，为空时订阅全部事件
+	GroupID   string         `gorm:"size:50;index" json:"group_id,omitempty"` // 只推送该分组内设备的事件，为空时不限制
+	Enabled   bool           `gorm:"not null" json:"enabled"`                 // 是否启用
+	CreatedBy uint           `gorm:"not null;index" json:"created_by"`        // 创建者ID
+	CreatedAt time.Time      `json:"created_at"`                              // 创建时间
+	UpdatedAt time.Time      `json:"updated_at"`                              // 更新时间
+
+	// 关联关系
+	Creator User `gorm:"foreignKey:CreatedBy" json:"-"` // 创建者
+}
+
+// Webhook事件类型常量
+const (
+	WebhookEventExecutionCompleted = "execution.completed" // 命令执行完成
+	WebhookEventExecutionFailed    = "execution.failed"    // 命令执行失败（至少一台设备失败）
+	WebhookEventDeviceOffline      = "device.offline"      // 设备离线
+	WebhookEventDeviceOnline       = "device.online"       // 离线设备恢复上线
+	WebhookEventAgentRegistered    = "agent.registered"    // Agent注册了新设备
+	WebhookEventPing               = "ping"                // 测试推送
+)
+
+// WebhookDelivery Webhook推送记录，失败后按退避时间重试
+type WebhookDelivery struct {
+	ID            uint64     `gorm:"primaryKey" json:"id"`                                                       // 推送ID，主键
+	WebhookID     uint       `gorm:"not null;index" json:"webhook_id"`                                           // 关联的Webhook ID
+	Event         string     `gorm:"size:50;not null" json:"event"`                                              // 事件类型
+	Payload       string     `gorm:"type:mediumtext" json:"payload"`                                             // 推送的JSON内容
+	Status        string     `gorm:"size:20;not null;index:idx_webhook_delivery_due,priority:1" json:"status"`   // 推送状态
+	Attempts      int        `gorm:"default:0" json:"attempts"`                                                  // 已尝试次数
+	NextAttemptAt *time.Time `gorm:"index:idx_webhook_delivery_due,priority:2" json:"next_attempt_at,omitempty"` // 下次尝试时间
+	ResponseCode  int        `json:"response_code,omitempty"`                                                    // 最近一次响应状态码
+	ResponseBody  string     `gorm:"type:text" json:"response_body,omitempty"`                                   // 最近一次响应内容（截断）
+	Error         string     `gorm:"size:500" json:"error,omitempty"`                                            // 最近一次错误
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`                                                     // 推送成功时间
+	CreatedAt     time.Time  `gorm:"index" json:"created_at"`                                                    // 创建时间
+	UpdatedAt     time.Time  `json:"updated_at"`                                                                 // 更新时间
+}
+
+// Webhook推送状态常量
+const (
+	DeliveryStatusPending = "pending" // 等待推送或重试
+	DeliveryStatusSuccess = "success" // 推送成功
+	DeliveryStatusFailed  = "failed"  // 重试耗尽
+)
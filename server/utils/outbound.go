@@ -0,0 +1,94 @@
+// utils 包提供了通用的工具函数
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrForbiddenAddress 目标地址为回环、内网、链路本地等不允许访问的地址
+var ErrForbiddenAddress = errors.New("destination address is not allowed")
+
+// cgnatRange 运营商级NAT地址段100.64.0.0/10，与内网地址同样不允许访问
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP 判断是否为可访问的公网地址：排除回环、内网、链路本地（含169.254.169.254元数据地址）、组播与未指定地址
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || cgnatRange.Contains(ip))
+}
+
+// CheckOutboundURL 校验出站地址为http(s)，且主机名解析出的地址均为公网地址；allowPrivate为true时不检查地址
+func CheckOutboundURL(ctx context.Context, raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrForbiddenAddress
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !IsPublicIP(ip.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// NewOutboundClient 创建访问用户提供地址的HTTP客户端：不跟随重定向、不使用代理，
+// 并在连接时校验解析出的地址，防止通过DNS重绑定访问内网；allowPrivate为true时不检查地址
+func NewOutboundClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if allowPrivate {
+				return dialer.DialContext(ctx, network, addr)
+			}
+
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				if !IsPublicIP(ip.IP) {
+					return nil, ErrForbiddenAddress
+				}
+			}
+			if len(ips) == 0 {
+				return nil, ErrForbiddenAddress
+			}
+
+			// 直接连接已校验的地址，避免再次解析得到不同结果
+			return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+		},
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOutboundURL(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{"http://127.0.0.1:8080/hook", false, true},
+		{"http://169.254.169.254/latest/meta-data", false, true},
+		{"http://[::1]/hook", false, true},
+		{"http://localhost/hook", false, true},
+		{"https://8.8.8.8/hook", false, false},
+		{"http://127.0.0.1:8080/hook", true, false},
+		{"ftp://8.8.8.8/file", false, true},
+		{"file:///etc/passwd", true, true},
+		{"not a url", false, true},
+	}
+
+	for _, tt := range tests {
+		err := CheckOutboundURL(ctx, tt.url, tt.allowPrivate)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckOutboundURL(%s, %v) error = %v, wantErr %v", tt.url, tt.allowPrivate, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewOutboundClient(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	// 连接时拒绝回环地址
+	_, err := NewOutboundClient(time.Second, false).Get(target.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Get(loopback) error = %v, want ErrForbiddenAddress", err)
+	}
+
+	// 允许内网时可以访问，但不跟随重定向
+	resp, err := NewOutboundClient(time.Second, true).Get(redirect.URL)
+	if err != nil {
+		t.Fatalf("Get(redirect) error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Get(redirect) status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+}